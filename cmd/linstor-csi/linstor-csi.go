@@ -19,61 +19,155 @@ along with this program; if not, see <http://www.gnu.org/licenses/>.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
-	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	lapi "github.com/LINBIT/golinstor/client"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"github.com/piraeusdatastore/linstor-csi/pkg/client"
 	"github.com/piraeusdatastore/linstor-csi/pkg/driver"
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/credentials"
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/failover"
 	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/metrics"
+	"github.com/piraeusdatastore/linstor-csi/pkg/reconciler"
+	"github.com/piraeusdatastore/linstor-csi/pkg/tracing"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+	"github.com/piraeusdatastore/linstor-csi/pkg/webhook"
 )
 
+// endpointHealthCheckInterval is the time between health checks of the active LINSTOR endpoint, if multiple
+// endpoints are configured.
+const endpointHealthCheckInterval = 30 * time.Second
+
+// tracingShutdownTimeout limits the time spent exporting the remaining spans on shutdown.
+const tracingShutdownTimeout = 5 * time.Second
+
+// serverReadHeaderTimeout limits the time clients of the metrics and webhook servers may take to send request headers.
+const serverReadHeaderTimeout = 10 * time.Second
+
 func main() {
 	var (
-		lsEndpoint            = flag.String("linstor-endpoint", "http://localhost:3070", "Controller API endpoint for LINSTOR")
+		lsEndpoint            = flag.String("linstor-endpoint", "http://localhost:3070", "Controller API endpoint for LINSTOR. Multiple endpoints can be given as a comma separated list, requests are sent to the one that responds")
 		lsSkipTLSVerification = flag.Bool("linstor-skip-tls-verification", false, "If true, do not verify tls")
 		csiEndpoint           = flag.String("csi-endpoint", "unix:///var/lib/kubelet/plugins/linstor.csi.linbit.com/csi.sock", "CSI endpoint")
 		node                  = flag.String("node", "", "Node ID to pass to node service")
 		logLevel              = flag.String("log-level", "info", "Enable debug log output. Choose from: panic, fatal, error, warn, info, debug")
+		logFormat             = flag.String("log-format", logging.FormatText, "Format of the log output. Choose from: text, json")
 		rps                   = flag.Float64("linstor-api-requests-per-second", 0, "Maximum allowed number of LINSTOR API requests per second. Default: Unlimited")
 		burst                 = flag.Int("linstor-api-burst", 1, "Maximum number of API requests allowed before being limited by requests-per-second. Default: 1 (no bursting)")
-		bearerTokenFile       = flag.String("bearer-token", "", "Read the bearer token from the given file and use it for authentication.")
+		bearerTokenFile       = flag.String("bearer-token", "", "Read the bearer token from the given file and use it for authentication. The file is read again when it changes.")
+		clientCertFile        = flag.String("linstor-client-cert-file", "", "PEM encoded client certificate for TLS authentication with LINSTOR. Reloaded when the file changes. Overrides LS_USER_CERTIFICATE")
+		clientKeyFile         = flag.String("linstor-client-key-file", "", "PEM encoded key of the client certificate. Reloaded when the file changes. Overrides LS_USER_KEY")
+		rootCAFile            = flag.String("linstor-root-ca-file", "", "PEM encoded CA certificates used to verify the LINSTOR API. Reloaded when the file changes. Overrides LS_ROOT_CA")
+		metricsAddress        = flag.String("metrics-address", "", "Serve Prometheus metrics on the given address, for example ':9090'. Default: disabled")
+		reconcileInterval     = flag.Duration("reconcile-interval", 0, "Periodically remove leftover temporary resources, snapshots and resource groups from LINSTOR, and create scheduled backups. Only enable on the controller. Without --reconcile-leader-election, the controller must run with a single replica. Default: disabled")
+		reconcileElection     = flag.Bool("reconcile-leader-election", false, "Only run the reconciler in the replica holding the 'linstor-csi-reconciler' Lease in the namespace of the pod. Requires permissions to manage leases")
+		snapshotMaxAge        = flag.Duration("reconcile-snapshot-max-age", time.Hour, "Age after which temporary snapshots used for cloning volumes are removed by the reconciler")
+		otlpEndpoint          = flag.String("otlp-endpoint", "", "Export traces via OTLP over HTTP to the given endpoint, for example 'http://otel-collector:4318'. Default: disabled")
+		nfsExportRoot         = flag.String("nfs-export-root", driver.DefaultNFSExportRoot, "Directory where volumes shared over NFS are mounted on the NFS server node. Needs to be shared with the host using bidirectional mount propagation")
+		nfsExportClients      = flag.String("nfs-export-clients", "", "Comma separated list of networks in CIDR notation allowed to mount volumes shared over NFS. Default: the addresses of all LINSTOR nodes")
+		nfsReconcileInterval  = flag.Duration("nfs-reconcile-interval", 0, "Periodically start and stop serving volumes shared over NFS on this node, and take over volumes whose NFS server is offline. Only enable on nodes. Default: disabled")
+		nfsFloatingAddresses  = flag.String("nfs-floating-addresses", "", "Network in CIDR notation from which every volume shared over NFS gets a floating address that moves with the NFS server. Default: clients use the address of the NFS server node")
+		nfsFloatingInterface  = flag.String("nfs-floating-address-interface", "", "Network interface the NFS floating addresses are assigned to on the NFS server node")
+		ephemeralRGs          = flag.String("ephemeral-resource-groups", "", "Comma separated list of existing LINSTOR resource groups CSI ephemeral inline volumes may be created in. The first one is the default. Default: ephemeral volumes are disabled")
+		ephemeralMaxSize      = flag.String("ephemeral-max-size", "10Gi", "Largest size of a CSI ephemeral inline volume")
+		webhookAddress        = flag.String("webhook-address", "", "Run as validating admission webhook for storage and snapshot classes on the given address, for example ':9443', instead of running the CSI driver")
+		webhookCertFile       = flag.String("webhook-tls-cert-file", "", "PEM encoded certificate served by the admission webhook. Reloaded when the file changes")
+		webhookKeyFile        = flag.String("webhook-tls-key-file", "", "PEM encoded key of the admission webhook certificate. Reloaded when the file changes")
 	)
 
 	flag.Var(&volume.DefaultRemoteAccessPolicy, "default-remote-access-policy", "")
 
 	flag.Parse()
 
-	// TODO: Take log outputs and options from the command line.
 	logOut := os.Stderr
-	logFmt := &log.TextFormatter{}
+	logFmt, err := logging.NewFormatter(*logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Setup logging incase there are errors external to the driver/client.
 	log.SetFormatter(logFmt)
 	log.SetOutput(logOut)
 
+	// Exit only after all other deferred functions ran, so the remaining traces are exported.
+	exitCode := 0
+	defer func() { os.Exit(exitCode) }()
+
+	// Kubernetes sends SIGTERM when stopping the pod.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if *otlpEndpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), *otlpEndpoint, driver.Version)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+			defer cancel()
+
+			if err := shutdown(ctx); err != nil {
+				log.WithError(err).Warn("failed to flush traces")
+			}
+		}()
+	}
+
+	// The webhook only validates parameters, it does not need access to LINSTOR.
+	if *webhookAddress != "" {
+		err := runWebhook(ctx, *webhookAddress, *webhookCertFile, *webhookKeyFile,
+			webhook.LogFmt(logFmt),
+			webhook.LogLevel(*logLevel),
+			webhook.LogOut(logOut),
+		)
+		if err != nil {
+			log.WithError(err).Error("admission webhook failed")
+
+			exitCode = 1
+		}
+
+		return
+	}
+
 	// Setup API Client and High-Level Client.
-	u, err := url.Parse(*lsEndpoint)
-	if err != nil {
-		log.Fatal(err)
+	var endpoints []*url.URL
+
+	for _, ep := range strings.Split(*lsEndpoint, ",") {
+		u, err := url.Parse(strings.TrimSpace(ep))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		endpoints = append(endpoints, u)
 	}
+
 	r := rate.Limit(*rps)
 	if r <= 0 {
 		r = rate.Inf
 	}
 
 	// Setup HTTP client with optional TLS mutual auth.
-	h := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *lsSkipTLSVerification}}}
+	tlsConfig := &tls.Config{InsecureSkipVerify: *lsSkipTLSVerification}
 	certPEM, cert := os.LookupEnv("LS_USER_CERTIFICATE")
 	keyPEM, key := os.LookupEnv("LS_USER_KEY")
 	caPEM, ca := os.LookupEnv("LS_ROOT_CA")
@@ -87,24 +181,70 @@ func main() {
 		if !ok {
 			log.Fatal("failed to get a valid certificate from LS_ROOT_CA")
 		}
-		h = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{keyPair}, RootCAs: caPool, InsecureSkipVerify: *lsSkipTLSVerification}}}
+		tlsConfig.Certificates = []tls.Certificate{keyPair}
+		tlsConfig.RootCAs = caPool
+	}
+
+	// Certificates from files take precedence, and are reloaded when the files change.
+	if *clientCertFile != "" || *clientKeyFile != "" {
+		clientCert, err := credentials.NewKeyPair(*clientCertFile, *clientKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tlsConfig.Certificates = nil
+		tlsConfig.GetClientCertificate = clientCert.GetClientCertificate
+	}
+
+	var dialTLS func(ctx context.Context, network, addr string) (net.Conn, error)
+	if *rootCAFile != "" && !*lsSkipTLSVerification {
+		rootCAs, err := credentials.NewRootCAs(*rootCAFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The static RootCAs can't be replaced once in use, so every connection is dialed with the current CA instead.
+		dialTLS = rootCAs.DialTLSContext(tlsConfig)
 	}
 
+	h := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DialTLSContext: dialTLS}}
+
 	headers := make(http.Header)
 	headers.Set("User-Agent", "linstor-csi/"+driver.Version)
 
+	var authenticated http.RoundTripper = &additionalHeaderRoundTripper{
+		RoundTripper:      h.Transport,
+		additionalHeaders: headers,
+	}
+
 	if *bearerTokenFile != "" {
-		token, err := ioutil.ReadFile(*bearerTokenFile)
+		token, err := credentials.NewBearerToken(*bearerTokenFile)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		headers.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		authenticated = token.RoundTripper(authenticated)
 	}
 
-	h.Transport = &additionalHeaderRoundTripper{
-		RoundTripper:      h.Transport,
-		additionalHeaders: headers,
+	// The failover round tripper sends requests, including its health checks, with TLS and authentication configured.
+	endpointSelector, err := failover.NewRoundTripper(authenticated, endpoints, log.NewEntry(log.StandardLogger()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(endpoints) > 1 {
+		go endpointSelector.Watch(ctx, endpointHealthCheckInterval)
+	}
+
+	var traced http.RoundTripper = endpointSelector
+	if *otlpEndpoint != "" {
+		traced = tracing.RoundTripper(traced)
+	}
+
+	// Rate limiting happens in the HTTP client instead of via lapi.Limit, so the time spent waiting can be observed.
+	h.Transport = &rateLimitRoundTripper{
+		RoundTripper: metrics.InstrumentRoundTripper(traced),
+		limiter:      rate.NewLimiter(r, *burst),
 	}
 
 	logger := log.NewEntry(log.New())
@@ -116,19 +256,35 @@ func main() {
 	logger.Logger.SetOutput(logOut)
 	logger.Logger.SetFormatter(logFmt)
 
+	basicAuth := &lapi.BasicAuthCfg{Username: os.Getenv("LS_USERNAME"), Password: os.Getenv("LS_PASSWORD")}
+
 	c, err := lc.NewHighLevelClient(
-		lapi.BaseURL(u),
-		lapi.BasicAuth(&lapi.BasicAuthCfg{Username: os.Getenv("LS_USERNAME"), Password: os.Getenv("LS_PASSWORD")}),
+		// The actual endpoint is chosen by the failover round tripper.
+		lapi.BaseURL(endpoints[0]),
+		lapi.BasicAuth(basicAuth),
 		lapi.HTTPClient(h),
-		lapi.Limit(r, *burst),
 		lapi.Log(logger),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	c.MultiSnapshots = &lc.MultiSnapshotService{Client: h, BaseURL: endpoints[0], BasicAuth: basicAuth}
+	c.ResourceGroupMover = &lc.ResourceGroupMoveService{Client: h, BaseURL: endpoints[0], BasicAuth: basicAuth}
+	c.EncryptedVolumeDefinitions = &lc.EncryptedVolumeDefinitionService{Client: h, BaseURL: endpoints[0], BasicAuth: basicAuth}
+
+	var nfsClients []string
+	if *nfsExportClients != "" {
+		for _, cidr := range strings.Split(*nfsExportClients, ",") {
+			nfsClients = append(nfsClients, strings.TrimSpace(cidr))
+		}
+	}
+
 	linstorClient, err := client.NewLinstor(
 		client.APIClient(c),
+		client.NFSClients(nfsClients),
+		client.NFSFloatingAddresses(*nfsFloatingAddresses),
+		client.NFSFloatingAddressInterface(*nfsFloatingInterface),
 		client.LogFmt(logFmt),
 		client.LogLevel(*logLevel),
 		client.LogOut(logOut),
@@ -137,29 +293,208 @@ func main() {
 		log.Fatal(err)
 	}
 
+	var ephemeralResourceGroups []string
+	if *ephemeralRGs != "" {
+		for _, rg := range strings.Split(*ephemeralRGs, ",") {
+			ephemeralResourceGroups = append(ephemeralResourceGroups, strings.TrimSpace(rg))
+		}
+	}
+
+	ephemeralSize, err := resource.ParseQuantity(*ephemeralMaxSize)
+	if err != nil {
+		log.Fatalf("invalid --ephemeral-max-size: %v", err)
+	}
+
 	drv, err := driver.NewDriver(
 		driver.Assignments(linstorClient),
 		driver.Endpoint(*csiEndpoint),
+		driver.LogFmt(logFmt),
 		driver.LogLevel(*logLevel),
 		driver.LogOut(logOut),
 		driver.Mounter(linstorClient),
 		driver.NodeID(*node),
 		driver.Snapshots(linstorClient),
+		driver.GroupSnapshots(linstorClient),
 		driver.Storage(linstorClient),
 		driver.VolumeStatter(linstorClient),
 		driver.Expander(linstorClient),
+		driver.Modifier(linstorClient),
 		driver.NodeInformer(linstorClient),
+		driver.NFSExporter(linstorClient),
+		driver.NFSExportRoot(*nfsExportRoot),
+		driver.EphemeralResourceGroups(ephemeralResourceGroups),
+		driver.EphemeralMaxSize(ephemeralSize.Value()),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	//nolint:errcheck
-	defer drv.Stop()
+	if *metricsAddress != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
 
-	if err := drv.Run(); err != nil {
-		log.Fatal(err)
+			server := &http.Server{
+				Addr:              *metricsAddress,
+				Handler:           mux,
+				ReadHeaderTimeout: serverReadHeaderTimeout,
+			}
+
+			log.WithField("address", *metricsAddress).Info("serving metrics")
+
+			log.Fatal(server.ListenAndServe())
+		}()
+	}
+
+	if *nfsReconcileInterval > 0 {
+		go drv.RunNFSServer(ctx, *nfsReconcileInterval)
 	}
+
+	if *reconcileInterval > 0 {
+		opts := []func(*reconciler.Reconciler) error{
+			reconciler.Interval(*reconcileInterval),
+			reconciler.SnapshotMaxAge(*snapshotMaxAge),
+			reconciler.LogFmt(logFmt),
+			reconciler.LogLevel(*logLevel),
+			reconciler.LogOut(logOut),
+		}
+
+		kubeClient, dynamicClient, err := inClusterClients()
+		if err != nil && *reconcileElection {
+			log.WithError(err).Fatal("reconciler leader election requires access to Kubernetes")
+		}
+
+		if err != nil {
+			log.WithError(err).Warn("reconciler running without access to Kubernetes, only resources no longer marked as published are considered detached, scheduled backups are disabled")
+		} else {
+			opts = append(opts,
+				reconciler.Attachments(&reconciler.KubernetesAttachments{
+					Client:     kubeClient,
+					DriverName: "linstor.csi.linbit.com",
+				}),
+				reconciler.ScheduledBackups(linstorClient, &reconciler.KubernetesBackupClasses{
+					Client:     kubeClient,
+					Dynamic:    dynamicClient,
+					DriverName: "linstor.csi.linbit.com",
+				}),
+			)
+		}
+
+		if *reconcileElection {
+			namespace, identity, err := leaderElectionIdentity()
+			if err != nil {
+				log.WithError(err).Fatal("failed to determine reconciler leader election identity")
+			}
+
+			opts = append(opts, reconciler.LeaderElection(kubeClient, namespace, "linstor-csi-reconciler", identity))
+		}
+
+		rec, err := reconciler.NewReconciler(linstorClient, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go rec.Run(ctx)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- drv.Run() }()
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		log.Info("received signal, waiting for running calls to finish")
+
+		//nolint:errcheck
+		drv.Stop()
+
+		err = <-errs
+	}
+
+	if err != nil {
+		log.WithError(err).Error("driver failed")
+
+		exitCode = 1
+	}
+}
+
+func inClusterClients() (kubernetes.Interface, dynamic.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kubeClient, dynamicClient, nil
+}
+
+// leaderElectionIdentity returns the namespace and name of the pod the driver is running in.
+func leaderElectionIdentity() (string, string, error) {
+	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return "", "", err
+	}
+
+	// The hostname of a pod is its name.
+	identity, err := os.Hostname()
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(string(namespace)), identity, nil
+}
+
+// runWebhook serves the admission webhook on the given address until the server fails or the context is done.
+func runWebhook(ctx context.Context, address, certFile, keyFile string, options ...func(*webhook.Validator) error) error {
+	if certFile == "" || keyFile == "" {
+		return errors.New("admission webhook requires a TLS certificate and key")
+	}
+
+	cert, err := credentials.NewKeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	validator, err := webhook.NewValidator("linstor.csi.linbit.com", options...)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/validate", validator)
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		TLSConfig:         &tls.Config{GetCertificate: cert.GetCertificate},
+	}
+
+	log.WithField("address", address).Info("serving admission webhook")
+
+	go func() {
+		<-ctx.Done()
+
+		//nolint:errcheck
+		server.Shutdown(context.Background())
+	}()
+
+	// Certificates are provided by TLSConfig.GetCertificate, so they can be reloaded.
+	err = server.ListenAndServeTLS("", "")
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
 }
 
 // additionalHeaderRoundTripper adds additional headers to every request.
@@ -175,3 +510,23 @@ func (a *additionalHeaderRoundTripper) RoundTrip(req *http.Request) (*http.Respo
 
 	return a.RoundTripper.RoundTrip(req)
 }
+
+// rateLimitRoundTripper delays requests according to the rate limit, recording the time spent waiting.
+type rateLimitRoundTripper struct {
+	http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	metrics.RateLimiterWaitStarted()
+	err := r.limiter.Wait(req.Context())
+	metrics.RateLimiterWaitDone(time.Since(start))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.RoundTripper.RoundTrip(req)
+}
@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	lapiconsts "github.com/LINBIT/golinstor"
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/sirupsen/logrus"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/slice"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+var _ volume.BackupScheduler = &Linstor{}
+
+// ReconcileScheduledBackups creates S3 backups of all volumes that opted in to scheduled backups using the given
+// snapshot class, and deletes scheduled backups exceeding the retention of the class.
+//
+// Volumes opt in by setting linstor.PropertyBackupClass on their resource definition. Backups are incremental if the
+// class allows it. Only backups of snapshots created by the schedule are considered for deletion, so backups taken for
+// a VolumeSnapshot are never removed.
+func (s *Linstor) ReconcileScheduledBackups(ctx context.Context, class string, params *volume.SnapshotParameters) (int, int, error) {
+	if params.Type != volume.SnapshotTypeS3 || params.BackupSchedule <= 0 {
+		return 0, 0, fmt.Errorf("snapshot class %s has no S3 backup schedule", class)
+	}
+
+	rds, err := s.client.ResourceDefinitions.GetAll(ctx, lapi.RDGetAllRequest{
+		Props: []string{linstor.PropertyBackupClass + "=" + class},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list resource definitions: %w", err)
+	}
+
+	var resources []string
+
+	for i := range rds {
+		if rds[i].Props[linstor.PropertyBackupClass] != class || slice.ContainsString(rds[i].Flags, lapiconsts.FlagDelete) {
+			continue
+		}
+
+		resources = append(resources, rds[i].Name)
+	}
+
+	if len(resources) == 0 {
+		return 0, 0, nil
+	}
+
+	err = s.reconcileRemote(ctx, params)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	backups, err := s.client.Backup.GetAll(ctx, params.RemoteName, "", "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list backups on remote %s: %w", params.RemoteName, err)
+	}
+
+	scheduled := make(map[string][]lapi.Backup)
+
+	for _, b := range backups.Linstor {
+		if strings.HasPrefix(b.OriginSnap, linstor.ScheduledBackupPrefix) {
+			scheduled[b.OriginRsc] = append(scheduled[b.OriginRsc], b)
+		}
+	}
+
+	now := time.Now()
+	created, deleted := 0, 0
+
+	for _, rsc := range resources {
+		log := s.logger(ctx).WithFields(logrus.Fields{
+			logging.FieldVolume: rsc,
+			"remote":            params.RemoteName,
+		})
+
+		if backupDue(scheduled[rsc], params.BackupSchedule, now) {
+			snapName := linstor.ScheduledBackupPrefix + now.UTC().Format("20060102-150405")
+
+			// Retention removes whole chains of incremental backups, so chains are limited to the retention.
+			incremental := params.AllowIncremental && !chainExceedsRetention(scheduled[rsc], params.BackupRetentionCount, params.BackupRetentionAge, now)
+
+			_, err := s.client.Backup.Create(ctx, params.RemoteName, lapi.BackupCreate{
+				RscName:     rsc,
+				SnapName:    snapName,
+				Incremental: incremental,
+			})
+			if err != nil {
+				return created, deleted, fmt.Errorf("failed to create scheduled backup of %s: %w", rsc, err)
+			}
+
+			log.WithField(logging.FieldSnapshot, snapName).Info("created scheduled backup")
+
+			created++
+		}
+
+		for _, b := range expiredBackups(scheduled[rsc], params.BackupRetentionCount, params.BackupRetentionAge, now) {
+			err := s.client.Backup.DeleteAll(ctx, params.RemoteName, lapi.BackupDeleteOpts{ID: b.Id})
+			if nil404(err) != nil {
+				return created, deleted, fmt.Errorf("failed to delete expired backup %s of %s: %w", b.Id, rsc, err)
+			}
+
+			// The local snapshot is no longer needed as base for incremental backups.
+			err = s.client.Resources.DeleteSnapshot(ctx, rsc, b.OriginSnap)
+			if nil404(err) != nil {
+				return created, deleted, fmt.Errorf("failed to delete snapshot %s of expired backup: %w", b.OriginSnap, err)
+			}
+
+			log.WithField("backup", b.Id).Info("deleted expired scheduled backup")
+
+			deleted++
+		}
+	}
+
+	return created, deleted, nil
+}
+
+// backupDue returns true if the last of the given backups was started at least one schedule interval ago. No new
+// backup is due while a backup is still shipping.
+func backupDue(backups []lapi.Backup, schedule time.Duration, now time.Time) bool {
+	var latest time.Time
+
+	for i := range backups {
+		if backups[i].Shipping {
+			return false
+		}
+
+		if backups[i].StartTimestamp != nil && backups[i].StartTimestamp.After(latest) {
+			latest = backups[i].StartTimestamp.Time
+		}
+	}
+
+	return now.Sub(latest) >= schedule
+}
+
+// chainExceedsRetention returns true if another incremental backup based on the latest of the given backups would make
+// its chain longer than the retention count, or span more than the retention age. A new full backup has to be created
+// instead, so the old chain can expire.
+func chainExceedsRetention(backups []lapi.Backup, count int, maxAge time.Duration, now time.Time) bool {
+	chains := backupChains(backups)
+	if len(chains) == 0 {
+		return false
+	}
+
+	latest := chains[0]
+	base := latest[len(latest)-1]
+
+	if count > 0 && len(latest) >= count {
+		return true
+	}
+
+	return maxAge > 0 && now.Sub(base.StartTimestamp.Time) >= maxAge
+}
+
+// expiredBackups returns the backups exceeding the retention count or age, newest first. Incremental backups are
+// only restorable together with the backups they are based on, so backups expire as whole chains: a chain is kept
+// until the newer chains hold enough backups, or until its newest backup is too old. The newest chain is always kept.
+func expiredBackups(backups []lapi.Backup, count int, maxAge time.Duration, now time.Time) []lapi.Backup {
+	if count == 0 && maxAge == 0 {
+		return nil
+	}
+
+	kept := 0
+	expired := make(map[string]struct{})
+
+	for i, chain := range backupChains(backups) {
+		tooMany := count > 0 && kept >= count
+		tooOld := maxAge > 0 && now.Sub(chain[0].StartTimestamp.Time) >= maxAge
+
+		if i > 0 && (tooMany || tooOld) {
+			for _, b := range chain {
+				expired[b.Id] = struct{}{}
+			}
+
+			continue
+		}
+
+		kept += len(chain)
+	}
+
+	var result []lapi.Backup
+
+	for _, b := range sortedBackups(backups) {
+		if _, ok := expired[b.Id]; ok {
+			result = append(result, b)
+		}
+	}
+
+	return result
+}
+
+// backupChains groups the finished backups into chains of a full backup and the incremental backups based on it.
+// Chains and the backups in each chain are sorted newest first.
+func backupChains(backups []lapi.Backup) [][]lapi.Backup {
+	sorted := sortedBackups(backups)
+
+	byID := make(map[string]*lapi.Backup)
+	for i := range sorted {
+		byID[sorted[i].Id] = &sorted[i]
+	}
+
+	root := func(b *lapi.Backup) string {
+		for byID[b.BasedOnId] != nil {
+			b = byID[b.BasedOnId]
+		}
+
+		return b.Id
+	}
+
+	var chains [][]lapi.Backup
+
+	index := make(map[string]int)
+
+	for i := range sorted {
+		r := root(&sorted[i])
+
+		idx, ok := index[r]
+		if !ok {
+			idx = len(chains)
+			index[r] = idx
+			chains = append(chains, nil)
+		}
+
+		chains[idx] = append(chains[idx], sorted[i])
+	}
+
+	return chains
+}
+
+// sortedBackups returns the finished backups, newest first.
+func sortedBackups(backups []lapi.Backup) []lapi.Backup {
+	var result []lapi.Backup
+
+	for i := range backups {
+		if !backups[i].Shipping && backups[i].StartTimestamp != nil {
+			result = append(result, backups[i])
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTimestamp.After(result[j].StartTimestamp.Time)
+	})
+
+	return result
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	lapiconsts "github.com/LINBIT/golinstor"
+	lapi "github.com/LINBIT/golinstor/client"
+)
+
+// DefaultMaxOversubscriptionRatio is the ratio LINSTOR uses for thin pools if MaxOversubscriptionRatio is not set.
+const DefaultMaxOversubscriptionRatio = 20.0
+
+func isThinPool(sp lapi.StoragePool) bool {
+	switch sp.ProviderKind {
+	case lapi.LVM_THIN, lapi.ZFS_THIN, lapi.FILE_THIN:
+		return true
+	default:
+		return false
+	}
+}
+
+// oversubscriptionRatios returns a function reporting the MaxOversubscriptionRatio of a storage pool. Like in LINSTOR,
+// the property is taken from the storage pool, the storage pool definition or the controller, in that order.
+// Definitions and controller properties are only fetched if a thin pool does not set the ratio itself.
+func (s *Linstor) oversubscriptionRatios(ctx context.Context, pools []lapi.StoragePool) (func(lapi.StoragePool) float64, error) {
+	needsDefaults := false
+
+	for _, sp := range pools {
+		if _, ok := sp.Props[lapiconsts.KeyStorPoolDfnMaxOversubscriptionRatio]; isThinPool(sp) && !ok {
+			needsDefaults = true
+			break
+		}
+	}
+
+	spdProps := make(map[string]map[string]string)
+
+	var controllerProps map[string]string
+
+	if needsDefaults {
+		spds, err := s.client.StoragePoolDefinitions.GetAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list storage pool definitions: %w", err)
+		}
+
+		for _, spd := range spds {
+			spdProps[spd.StoragePoolName] = spd.Props
+		}
+
+		controllerProps, err = s.client.Controller.GetProps(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get controller properties: %w", err)
+		}
+	}
+
+	return func(sp lapi.StoragePool) float64 {
+		for _, props := range []map[string]string{sp.Props, spdProps[sp.StoragePoolName], controllerProps} {
+			v, ok := props[lapiconsts.KeyStorPoolDfnMaxOversubscriptionRatio]
+			if !ok {
+				continue
+			}
+
+			ratio, err := strconv.ParseFloat(v, 64)
+			if err != nil || ratio <= 0 {
+				s.log.WithField("storagePool", sp.StoragePoolName).WithField("value", v).Warn("ignoring invalid MaxOversubscriptionRatio")
+				continue
+			}
+
+			return ratio
+		}
+
+		return DefaultMaxOversubscriptionRatio
+	}, nil
+}
+
+// reservedCapacities returns a function reporting the capacity in KiB already provisioned in a thin storage pool, i.e.
+// the sum of the sizes of all volumes placed in the pool. The resource view is only fetched if there are thin pools.
+func (s *Linstor) reservedCapacities(ctx context.Context, pools []lapi.StoragePool) (func(lapi.StoragePool) int64, error) {
+	reserved := make(map[[2]string]int64)
+
+	if slices.ContainsFunc(pools, isThinPool) {
+		cached := true
+
+		ress, err := s.client.Resources.GetResourceView(ctx, &lapi.ListOpts{Cached: &cached})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list resources: %w", err)
+		}
+
+		for _, res := range ress {
+			for _, vol := range res.Volumes {
+				reserved[[2]string{res.NodeName, vol.StoragePoolName}] += vol.UsableSizeKib
+			}
+		}
+	}
+
+	return func(sp lapi.StoragePool) int64 {
+		return reserved[[2]string{sp.NodeName, sp.StoragePoolName}]
+	}, nil
+}
+
+// thinCapacity returns the capacity of a thin pool, taking oversubscription into account: the free space may be
+// provisioned ratio times, but the total provisioned size never exceeds ratio times the total capacity of the pool.
+func thinCapacity(sp lapi.StoragePool, ratio float64, reserved int64) int64 {
+	free := int64(float64(sp.FreeCapacity) * ratio)
+
+	limit := int64(float64(sp.TotalCapacity)*ratio) - reserved
+	if limit < free {
+		free = limit
+	}
+
+	if free < 0 {
+		return 0
+	}
+
+	return free
+}
+
+// largestPlaceable returns the largest capacity available on placementCount distinct nodes.
+func largestPlaceable(perNode map[string]int64, placementCount int32) int64 {
+	if placementCount < 1 {
+		placementCount = 1
+	}
+
+	if int(placementCount) > len(perNode) {
+		return 0
+	}
+
+	free := make([]int64, 0, len(perNode))
+	for _, f := range perNode {
+		free = append(free, f)
+	}
+
+	sort.Slice(free, func(i, j int) bool { return free[i] > free[j] })
+
+	return free[placementCount-1]
+}
@@ -11,3 +11,29 @@ type DeleteInProgressError struct {
 func (d *DeleteInProgressError) Error() string {
 	return fmt.Sprintf("'%s' failed, %s %s is being deleted", d.Operation, d.Kind, d.Name)
 }
+
+// GroupSnapshotMismatchError is returned if a group snapshot ID is already used for a different set of volumes, or if a
+// snapshot does not belong to the group.
+type GroupSnapshotMismatchError struct {
+	ID         string
+	SnapshotID string
+}
+
+func (g *GroupSnapshotMismatchError) Error() string {
+	if g.SnapshotID != "" {
+		return fmt.Sprintf("snapshot %s is not part of group snapshot %s", g.SnapshotID, g.ID)
+	}
+
+	return fmt.Sprintf("group snapshot %s already exists for a different set of volumes", g.ID)
+}
+
+// ResyncInProgressError is returned if a modification has to wait for a replica to finish its initial sync. Calling
+// the modification again continues where it stopped.
+type ResyncInProgressError struct {
+	Name string
+	Node string
+}
+
+func (r *ResyncInProgressError) Error() string {
+	return fmt.Sprintf("replica of %s on %s is not UpToDate yet, resync in progress", r.Name, r.Node)
+}
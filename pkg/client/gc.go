@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	lapiconsts "github.com/LINBIT/golinstor"
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/slice"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+var _ volume.GarbageCollector = &Linstor{}
+
+// generatedResourceGroupName matches the names of resource groups generated by volume.NewParameters.
+var generatedResourceGroupName = regexp.MustCompile("^" + linstor.GeneratedResourceGroupPrefix + "[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$")
+
+// temporaryResourceGracePeriod protects temporary resources of an Attach call that is still running: the CO creates
+// its attachment record before calling Attach, but the record may not have been visible when listing attachments.
+var temporaryResourceGracePeriod = 5 * time.Minute
+
+// resourceGroupGracePeriod protects resource groups created by a CreateVolume call that is still running: the resource
+// group is created before the resource definition using it.
+var resourceGroupGracePeriod = 5 * time.Minute
+
+// RemoveOrphanedTemporaryResources removes diskless resources created by Attach that are no longer attached.
+//
+// Normally, Detach removes these resources. If the CO never calls Detach, for example because the VolumeAttachment
+// was removed by hand, they stay around forever. Resources that are in use, or that were converted to diskful
+// resources, or that belong to an ephemeral volume, are never removed.
+func (s *Linstor) RemoveOrphanedTemporaryResources(ctx context.Context, attachments map[volume.Attachment]struct{}) (int, error) {
+	ress, err := s.client.Resources.GetResourceView(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	// Ephemeral volumes are never attached by the CO, their temporary resources are removed once unpublished.
+	ephemeral, err := s.client.ResourceDefinitions.GetAll(ctx, lapi.RDGetAllRequest{
+		Props: []string{linstor.PropertyCreatedFor + "=" + linstor.CreatedForEphemeralVolume},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list ephemeral volumes: %w", err)
+	}
+
+	skip := make(map[string]struct{}, len(ephemeral))
+	for i := range ephemeral {
+		if ephemeral[i].Props[linstor.PropertyCreatedFor] == linstor.CreatedForEphemeralVolume {
+			skip[ephemeral[i].Name] = struct{}{}
+		}
+	}
+
+	removed := 0
+
+	for i := range ress {
+		res := &ress[i]
+
+		if _, ok := skip[res.Name]; ok {
+			continue
+		}
+
+		if !orphanedTemporaryResource(res, attachments) {
+			continue
+		}
+
+		log := s.logger(ctx).WithFields(logrus.Fields{
+			logging.FieldVolume: res.Name,
+			logging.FieldNode:   res.NodeName,
+		})
+
+		err := s.client.Resources.Delete(ctx, res.Name, res.NodeName)
+		if nil404(err) != nil {
+			return removed, fmt.Errorf("failed to remove temporary resource %s on %s: %w", res.Name, res.NodeName, err)
+		}
+
+		log.Info("removed orphaned temporary resource")
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+func orphanedTemporaryResource(res *lapi.ResourceWithVolumes, attachments map[volume.Attachment]struct{}) bool {
+	if len(res.Volumes) != 1 {
+		return false
+	}
+
+	vol := &res.Volumes[0]
+
+	if vol.Props[linstor.PropertyCreatedFor] != linstor.CreatedForTemporaryDisklessAttach || vol.ProviderKind != lapi.DISKLESS {
+		return false
+	}
+
+	if slice.ContainsString(res.Flags, lapiconsts.FlagDelete) || res.State.InUse {
+		return false
+	}
+
+	if res.CreateTimestamp == nil || time.Since(res.CreateTimestamp.Time) < temporaryResourceGracePeriod {
+		return false
+	}
+
+	if attachments == nil {
+		// Without information from the CO, we can only rely on our own marker, which is removed by Detach.
+		_, published := vol.Props[linstor.PublishedReadOnlyKey]
+
+		return !published
+	}
+
+	_, attached := attachments[volume.Attachment{VolumeID: res.Name, Node: res.NodeName}]
+
+	return !attached
+}
+
+// RemoveOrphanedTemporarySnapshots removes snapshots created to clone a volume that are older than maxAge.
+//
+// CreateVolume removes these snapshots once the clone is complete, or on the next retry if removal failed. If the
+// CO gives up on creating the volume, the snapshot is left behind.
+func (s *Linstor) RemoveOrphanedTemporarySnapshots(ctx context.Context, maxAge time.Duration) (int, error) {
+	snaps, err := s.client.Resources.GetSnapshotView(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	removed := 0
+
+	for i := range snaps {
+		snap := &snaps[i]
+
+		if !strings.HasPrefix(snap.Name, linstor.TemporarySnapshotPrefix) || slice.ContainsString(snap.Flags, lapiconsts.FlagDelete) {
+			continue
+		}
+
+		created, ok := snapshotCreationTime(snap)
+		if !ok || time.Since(created) < maxAge {
+			continue
+		}
+
+		err := s.SnapDelete(ctx, &csi.Snapshot{SnapshotId: snap.Name, SourceVolumeId: snap.ResourceName})
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove temporary snapshot %s of %s: %w", snap.Name, snap.ResourceName, err)
+		}
+
+		s.logger(ctx).WithFields(logrus.Fields{
+			logging.FieldSnapshot: snap.Name,
+			logging.FieldVolume:   snap.ResourceName,
+			"created":             created,
+		}).Info("removed orphaned temporary snapshot")
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// snapshotCreationTime returns the time the first node took the snapshot.
+func snapshotCreationTime(snap *lapi.Snapshot) (time.Time, bool) {
+	var created time.Time
+
+	for _, n := range snap.Snapshots {
+		if n.CreateTimestamp == nil {
+			continue
+		}
+
+		if created.IsZero() || n.CreateTimestamp.Before(created) {
+			created = n.CreateTimestamp.Time
+		}
+	}
+
+	return created, !created.IsZero()
+}
+
+// RemoveOrphanedResourceGroups removes resource groups generated for storage classes that are no longer used by any
+// resource definition.
+//
+// Deleting a volume also tries to remove its resource group, but errors are not reported to the CO. Resource groups
+// configured in a storage class via the resourceGroup parameter, and recently created resource groups, are never
+// removed.
+func (s *Linstor) RemoveOrphanedResourceGroups(ctx context.Context) (int, error) {
+	rgs, err := s.client.ResourceGroups.GetAll(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list resource groups: %w", err)
+	}
+
+	rds, err := s.client.ResourceDefinitions.GetAll(ctx, lapi.RDGetAllRequest{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list resource definitions: %w", err)
+	}
+
+	used := make(map[string]struct{})
+	for i := range rds {
+		used[rds[i].ResourceGroupName] = struct{}{}
+	}
+
+	removed := 0
+
+	for i := range rgs {
+		name := rgs[i].Name
+
+		if !generatedResourceGroupName.MatchString(name) {
+			continue
+		}
+
+		if _, ok := used[name]; ok {
+			continue
+		}
+
+		if recentlyCreated(&rgs[i]) {
+			continue
+		}
+
+		err := s.client.ResourceGroups.Delete(ctx, name)
+		if err != nil {
+			if lapi.IsApiCallError(err, lapiconsts.FailExistsRscDfn) {
+				// A volume was created in the meantime.
+				continue
+			}
+
+			if nil404(err) != nil {
+				return removed, fmt.Errorf("failed to remove resource group %s: %w", name, err)
+			}
+		}
+
+		s.logger(ctx).WithField("resourceGroup", name).Info("removed orphaned resource group")
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// recentlyCreated returns true if the resource group was created by the driver within the grace period. Resource
+// groups created before the creation time was recorded are considered old.
+func recentlyCreated(rg *lapi.ResourceGroup) bool {
+	created, err := time.Parse(time.RFC3339, rg.Props[linstor.PropertyCreatedAt])
+	if err != nil {
+		return false
+	}
+
+	return time.Since(created) < resourceGroupGracePeriod
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+var _ volume.GroupSnapshotCreateDeleter = &Linstor{}
+
+// CompatibleGroupSnapshotId returns an ID unique to the suggested name.
+func (s *Linstor) CompatibleGroupSnapshotId(name string) string {
+	invalid := validResourceName(name)
+	if invalid == nil {
+		return name
+	}
+
+	s.log.WithField("reason", invalid).Debug("group snapshot name is invalid, will generate fallback")
+
+	uuidv5 := uuid.NewSHA1([]byte("linstor.csi.linbit.com"), []byte(name))
+
+	return fmt.Sprintf("groupsnapshot-%s", uuidv5.String())
+}
+
+// groupMemberSnapshotId returns the name of the snapshot of a single volume in a group snapshot. Snapshot IDs need
+// to be unique, so every member gets its own name derived from the group and the volume.
+func groupMemberSnapshotId(groupId, sourceVolId string) string {
+	uuidv5 := uuid.NewSHA1([]byte("linstor.csi.linbit.com"), []byte(groupId+"/"+sourceVolId))
+
+	return fmt.Sprintf("snapshot-%s", uuidv5.String())
+}
+
+// GroupSnapCreate creates snapshots of all source volumes using LINSTOR's multi-snapshot API, so all snapshots are
+// taken at the same DRBD point in time. Every snapshot records the volumes of its group. If all snapshots of the group
+// already exist, they are returned as is. If only some snapshots of the same set of volumes exist, they are removed and
+// the group is created again. A group with the same ID taken of a different set of volumes is never modified.
+func (s *Linstor) GroupSnapCreate(ctx context.Context, id string, sourceVolIds []string, params *volume.SnapshotParameters) (*csi.VolumeGroupSnapshot, error) {
+	log := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldSnapshot: id,
+		"sourceVolumes":       sourceVolIds,
+	})
+
+	if params.Type != volume.SnapshotTypeInCluster {
+		return nil, fmt.Errorf("group snapshots of type `%s` are not supported", params.Type)
+	}
+
+	if s.client.MultiSnapshots == nil {
+		return nil, errors.New("group snapshots are not supported by this client")
+	}
+
+	sorted := slices.Clone(sourceVolIds)
+	slices.Sort(sorted)
+	memberList := strings.Join(sorted, ",")
+
+	snaps := make([]lapi.Snapshot, len(sourceVolIds))
+	for i, vol := range sourceVolIds {
+		snaps[i] = lapi.Snapshot{
+			Name:         groupMemberSnapshotId(id, vol),
+			ResourceName: vol,
+			Props:        map[string]string{linstor.PropertyGroupSnapshotMembers: memberList},
+		}
+	}
+
+	existing, err := s.existingGroupMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snap := range existing {
+		if !slices.Contains(sourceVolIds, snap.ResourceName) {
+			return nil, &GroupSnapshotMismatchError{ID: id}
+		}
+	}
+
+	switch {
+	case len(existing) == len(snaps):
+		log.Debug("group snapshot already exists")
+	case len(existing) == 0:
+		log.Debug("creating multi-snapshot")
+
+		err := s.client.MultiSnapshots.CreateMultiple(ctx, snaps...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create multi-snapshot: %w", err)
+		}
+	default:
+		// Only some snapshots of the group exist. If they were taken for the same set of volumes, the group is
+		// incomplete: they are removed, so the whole group is taken again at the same point in time. Otherwise, the
+		// group was created for a different set of volumes.
+		for _, snap := range existing {
+			if snap.Props[linstor.PropertyGroupSnapshotMembers] != memberList {
+				return nil, &GroupSnapshotMismatchError{ID: id}
+			}
+		}
+
+		for _, snap := range existing {
+			log.WithField("member", snap.Name).Info("removing snapshot of incomplete group snapshot")
+
+			err := s.client.Resources.DeleteSnapshot(ctx, snap.ResourceName, snap.Name)
+			if nil404(err) != nil {
+				return nil, fmt.Errorf("failed to remove snapshot of %s: %w", snap.ResourceName, err)
+			}
+		}
+
+		log.Debug("creating multi-snapshot")
+
+		err := s.client.MultiSnapshots.CreateMultiple(ctx, snaps...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create multi-snapshot: %w", err)
+		}
+	}
+
+	members := make([]*lapi.Snapshot, len(snaps))
+
+	for i := range snaps {
+		lsnap, err := s.client.Resources.GetSnapshot(ctx, snaps[i].ResourceName, snaps[i].Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch snapshot of %s: %w", snaps[i].ResourceName, err)
+		}
+
+		members[i] = &lsnap
+	}
+
+	return linstorGroupSnapshotToCSI(id, members)
+}
+
+// existingGroupMembers returns all snapshots belonging to the group, regardless of the volumes requested.
+func (s *Linstor) existingGroupMembers(ctx context.Context, id string) ([]*lapi.Snapshot, error) {
+	snaps, err := s.client.Resources.GetSnapshotView(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var members []*lapi.Snapshot
+
+	for i := range snaps {
+		if snaps[i].Name == groupMemberSnapshotId(id, snaps[i].ResourceName) {
+			members = append(members, &snaps[i])
+		}
+	}
+
+	return members, nil
+}
+
+// GroupSnapGet returns the group snapshot made up of the given snapshots. It returns false if one of the snapshots
+// does not exist. Group snapshots are not stored in LINSTOR, so without snapshots there is no group snapshot.
+func (s *Linstor) GroupSnapGet(ctx context.Context, id string, snapshotIds []string) (*csi.VolumeGroupSnapshot, bool, error) {
+	members, err := s.groupMembers(ctx, id, snapshotIds)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(members) == 0 || len(members) != len(snapshotIds) {
+		return nil, false, nil
+	}
+
+	group, err := linstorGroupSnapshotToCSI(id, members)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return group, true, nil
+}
+
+// GroupSnapDelete deletes the given snapshots of the group. Snapshots that no longer exist are ignored.
+func (s *Linstor) GroupSnapDelete(ctx context.Context, id string, snapshotIds []string) error {
+	members, err := s.groupMembers(ctx, id, snapshotIds)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		err := s.SnapDelete(ctx, &csi.Snapshot{SnapshotId: m.Name, SourceVolumeId: m.ResourceName})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// groupMembers returns the existing snapshots with the given IDs. All of them need to belong to the group.
+func (s *Linstor) groupMembers(ctx context.Context, id string, snapshotIds []string) ([]*lapi.Snapshot, error) {
+	snaps, err := s.client.Resources.GetSnapshotView(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	byName := make(map[string]*lapi.Snapshot, len(snaps))
+	for i := range snaps {
+		byName[snaps[i].Name] = &snaps[i]
+	}
+
+	var members []*lapi.Snapshot
+
+	for _, snapId := range snapshotIds {
+		lsnap, ok := byName[snapId]
+		if !ok {
+			continue
+		}
+
+		if groupMemberSnapshotId(id, lsnap.ResourceName) != snapId {
+			return nil, &GroupSnapshotMismatchError{ID: id, SnapshotID: snapId}
+		}
+
+		members = append(members, lsnap)
+	}
+
+	return members, nil
+}
+
+func linstorGroupSnapshotToCSI(id string, members []*lapi.Snapshot) (*csi.VolumeGroupSnapshot, error) {
+	group := &csi.VolumeGroupSnapshot{GroupSnapshotId: id, ReadyToUse: true}
+
+	for _, m := range members {
+		snap, err := linstorSnapshotToCSI(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert LINSTOR to CSI snapshot: %w", err)
+		}
+
+		snap.GroupSnapshotId = id
+		group.Snapshots = append(group.Snapshots, snap)
+		group.ReadyToUse = group.ReadyToUse && snap.ReadyToUse
+
+		if group.CreationTime == nil || snap.CreationTime.AsTime().Before(group.CreationTime.AsTime()) {
+			group.CreationTime = snap.CreationTime
+		}
+	}
+
+	return group, nil
+}
@@ -25,15 +25,19 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	lapiconsts "github.com/LINBIT/golinstor"
 	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/LINBIT/golinstor/clonestatus"
 	"github.com/LINBIT/golinstor/devicelayerkind"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/haySwim/data"
@@ -47,14 +51,18 @@ import (
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
 	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/util"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
 	"github.com/piraeusdatastore/linstor-csi/pkg/slice"
 	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
 	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
-	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/autoplace"
-	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/autoplacetopology"
-	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/balancer"
-	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/followtopology"
-	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/manual"
+	"github.com/piraeusdatastore/linstor-csi/pkg/tracing"
+	// Register the built-in volume schedulers.
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/autoplace"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/autoplacetopology"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/balancer"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/followtopology"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/manual"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/scored"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
@@ -64,6 +72,13 @@ type Linstor struct {
 	fallbackPrefix string
 	client         *lc.HighLevelClient
 	mounter        *mount.SafeFormatAndMount
+	nfsClients     []string
+	// nfsAddresses is the network floating addresses of NFS exported volumes are allocated from.
+	nfsAddresses *net.IPNet
+	// nfsInterface is the network interface floating addresses are assigned to.
+	nfsInterface string
+	// nfsAddressLock serializes the allocation of floating addresses.
+	nfsAddressLock sync.Mutex
 }
 
 // NewLinstor returns a high-level linstor client for CSI applications to interact with
@@ -98,14 +113,16 @@ func NewLinstor(options ...func(*Linstor) error) (*Linstor, error) {
 		Exec:      utilexec.New(),
 	}
 
-	l.log.WithFields(logrus.Fields{
-		"APIClient":       fmt.Sprintf("%+v", l.client),
-		"highLevelClient": fmt.Sprintf("%+v", l),
-	}).Debug("generated new linstor client")
+	l.log.Debug("generated new linstor client")
 
 	return l, nil
 }
 
+// logger returns the client's logger with the request scoped fields from the context.
+func (s *Linstor) logger(ctx context.Context) *logrus.Entry {
+	return logging.FromContext(ctx, s.log)
+}
+
 // APIClient the configured LINSTOR API client that will be used to communicate
 // with the LINSTOR cluster.
 func APIClient(c *lc.HighLevelClient) func(*Linstor) error {
@@ -180,7 +197,7 @@ func (s *Linstor) ListAll(ctx context.Context) ([]*volume.Info, error) {
 // satisfy the requiredBytes.
 func (s *Linstor) AllocationSizeKiB(requiredBytes, limitBytes int64) (int64, error) {
 	requestedSize := data.ByteSize(requiredBytes)
-	minVolumeSize := data.ByteSize(4096)
+	minVolumeSize := data.ByteSize(volume.MinimumSizeBytes)
 	maxVolumeSize := data.ByteSize(limitBytes)
 	unlimited := maxVolumeSize == 0
 	if minVolumeSize > maxVolumeSize && !unlimited {
@@ -233,8 +250,8 @@ func (s *Linstor) resourceDefinitionToVolume(resDef lapi.ResourceDefinitionWithV
 // FindByID retrieves a volume.Info that has an id that matches the CSI volume
 // id. Matches the LINSTOR resource name.
 func (s *Linstor) FindByID(ctx context.Context, id string) (*volume.Info, error) {
-	s.log.WithFields(logrus.Fields{
-		"csiVolumeID": id,
+	s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: id,
 	}).Debug("looking up resource by CSI volume id")
 
 	res, err := s.client.ResourceDefinitions.Get(ctx, id)
@@ -279,9 +296,7 @@ func (s *Linstor) CompatibleVolumeId(name, pvcNamespace, pvcName string) string
 // Create creates the resource definition, volume definition, and assigns the
 // resulting resource to LINSTOR nodes.
 func (s *Linstor) Create(ctx context.Context, vol *volume.Info, params *volume.Parameters, topologies *csi.TopologyRequirement) error {
-	logger := s.log.WithFields(logrus.Fields{
-		"volume": fmt.Sprintf("%+v", vol),
-	})
+	logger := s.logger(ctx).WithFields(vol.LogFields())
 
 	logger.Debug("reconcile resource group from storage class")
 	rGroup, err := s.reconcileResourceGroup(ctx, params)
@@ -300,7 +315,7 @@ func (s *Linstor) Create(ctx context.Context, vol *volume.Info, params *volume.P
 
 	logger.Debug("reconcile volume definition for volume")
 
-	_, err = s.reconcileVolumeDefinition(ctx, vol)
+	_, err = s.reconcileVolumeDefinition(ctx, vol, params.LuksPassphrase)
 	if err != nil {
 		logger.Debugf("reconcile volume definition failed: %v", err)
 		return err
@@ -316,7 +331,10 @@ func (s *Linstor) Create(ctx context.Context, vol *volume.Info, params *volume.P
 
 	logger.Debug("reconcile extra properties")
 
-	err = s.client.ResourceDefinitions.Modify(ctx, vol.ID, lapi.GenericPropsModify{OverrideProps: vol.Properties})
+	propsCtx, span := tracing.Start(ctx, "reconcileExtraProperties")
+	err = s.client.ResourceDefinitions.Modify(propsCtx, vol.ID, lapi.GenericPropsModify{OverrideProps: vol.Properties})
+	tracing.End(span, err)
+
 	if err != nil {
 		logger.Debugf("reconcile extra properties failed: %v", err)
 		return err
@@ -331,8 +349,8 @@ func (s *Linstor) Create(ctx context.Context, vol *volume.Info, params *volume.P
 // the actual resources are gone. An elegant way to go about this is by simply deleting the volume definition. This
 // hides
 func (s *Linstor) Delete(ctx context.Context, volId string) error {
-	s.log.WithFields(logrus.Fields{
-		"volume": volId,
+	s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
 	}).Info("deleting volume")
 
 	// Delete the volume definition. This marks a resources as being in the process of deletion.
@@ -372,7 +390,7 @@ func (s *Linstor) Delete(ctx context.Context, volId string) error {
 // AccessibleTopologies returns a list of pointers to csi.Topology from where the
 // volume is reachable, based on the localStoragePolicy reported by the volume.
 func (s *Linstor) AccessibleTopologies(ctx context.Context, volId string, params *volume.Parameters) ([]*csi.Topology, error) {
-	volumeScheduler, err := s.schedulerByPlacementPolicy(params.PlacementPolicy)
+	volumeScheduler, err := scheduler.New(params.PlacementPolicy, s.client, s.logger(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -380,23 +398,6 @@ func (s *Linstor) AccessibleTopologies(ctx context.Context, volId string, params
 	return volumeScheduler.AccessibleTopologies(ctx, volId, params.AllowRemoteVolumeAccess)
 }
 
-func (s *Linstor) schedulerByPlacementPolicy(policy topology.PlacementPolicy) (scheduler.Interface, error) {
-	switch policy {
-	case topology.AutoPlace:
-		return autoplace.NewScheduler(s.client), nil
-	case topology.Manual:
-		return manual.NewScheduler(s.client), nil
-	case topology.FollowTopology:
-		return followtopology.NewScheduler(s.client, s.log), nil
-	case topology.Balanced:
-		return balancer.NewScheduler(s.client, s.log)
-	case topology.AutoPlaceTopology:
-		return autoplacetopology.NewScheduler(s.client, s.log), nil
-	default:
-		return nil, fmt.Errorf("unsupported volume scheduler: %s", policy)
-	}
-}
-
 func (s *Linstor) GetLegacyVolumeParameters(ctx context.Context, volId string) (*volume.Parameters, error) {
 	rd, err := s.client.ResourceDefinitions.Get(ctx, volId)
 	if err != nil {
@@ -425,11 +426,92 @@ func (s *Linstor) GetLegacyVolumeParameters(ctx context.Context, volId string) (
 	return &params, nil
 }
 
+// ResourceGroupParameters returns parameters matching the existing resource group, so creating a volume with them
+// does not change the resource group.
+func (s *Linstor) ResourceGroupParameters(ctx context.Context, rgName string) (*volume.Parameters, error) {
+	rg, err := s.client.ResourceGroups.Get(ctx, rgName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource group %s: %w", rgName, err)
+	}
+
+	params, err := volume.NewParameters(map[string]string{linstor.ParameterNamespace + "/resourceGroup": rgName})
+	if err != nil {
+		return nil, err
+	}
+
+	params.PlacementCount = rg.SelectFilter.PlaceCount
+	params.ReplicasOnSame = rg.SelectFilter.ReplicasOnSame
+	params.ReplicasOnDifferent = rg.SelectFilter.ReplicasOnDifferent
+	params.DoNotPlaceWithRegex = rg.SelectFilter.NotPlaceWithRscRegex
+	params.Disklessonremaining = rg.SelectFilter.DisklessOnRemaining
+
+	// The storage pool is only reconciled if set, so it is left empty unless both places agree.
+	if rg.SelectFilter.StoragePool != "" && rg.SelectFilter.StoragePool == rg.Props[lapiconsts.KeyStorPoolName] {
+		params.StoragePool = rg.SelectFilter.StoragePool
+	}
+
+	params.LayerList = make([]devicelayerkind.DeviceLayerKind, 0, len(rg.SelectFilter.LayerStack))
+	for _, l := range rg.SelectFilter.LayerStack {
+		params.LayerList = append(params.LayerList, devicelayerkind.DeviceLayerKind(l))
+	}
+
+	return &params, nil
+}
+
+// Adopt adds the properties set on volumes provisioned by the plugin to an existing resource definition.
+//
+// Properties already present on the resource definition are kept as is. The parameters are stored in the legacy
+// parameter property, from where they are read when the volume is staged without volume context.
+func (s *Linstor) Adopt(ctx context.Context, vol *volume.Info, rawParams map[string]string) error {
+	s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: vol.ID,
+		"fsType":            vol.FsType,
+	}).Info("adopting existing volume")
+
+	rd, err := s.client.ResourceDefinitions.Get(ctx, vol.ID)
+	if err != nil {
+		return err
+	}
+
+	props := make(map[string]string)
+
+	fsTypeKey := lapiconsts.NamespcFilesystem + "/" + lapiconsts.KeyFsType
+	if _, ok := rd.Props[fsTypeKey]; !ok && vol.FsType != "" {
+		props[fsTypeKey] = vol.FsType
+	}
+
+	if _, ok := rd.Props[linstor.LegacyParameterPassKey]; !ok && len(rawParams) != 0 {
+		encoded, err := json.Marshal(struct {
+			Parameters map[string]string `json:"parameters"`
+		}{Parameters: rawParams})
+		if err != nil {
+			return fmt.Errorf("failed to encode volume parameters: %w", err)
+		}
+
+		props[linstor.LegacyParameterPassKey] = string(encoded)
+	}
+
+	for k, v := range vol.Properties {
+		if _, ok := rd.Props[k]; !ok {
+			props[k] = v
+		}
+	}
+
+	if len(props) == 0 {
+		return nil
+	}
+
+	return s.client.ResourceDefinitions.Modify(ctx, vol.ID, lapi.GenericPropsModify{OverrideProps: props})
+}
+
 // Attach idempotently creates a resource on the given node.
-func (s *Linstor) Attach(ctx context.Context, volId, node string, readOnly bool) error {
-	s.log.WithFields(logrus.Fields{
-		"volume":     volId,
-		"targetNode": node,
+//
+// If multiWriter is set and the volume is already published read-write on another node, DRBD is configured to allow
+// two primaries, so both nodes can open the device at the same time.
+func (s *Linstor) Attach(ctx context.Context, volId, node string, readOnly, multiWriter bool) error {
+	s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		logging.FieldNode:   node,
 	}).Info("attaching volume")
 
 	ress, err := s.client.Resources.GetResourceView(ctx, &lapi.ListOpts{Resource: []string{volId}})
@@ -487,14 +569,14 @@ func (s *Linstor) Attach(ctx context.Context, volId, node string, readOnly bool)
 			}
 		}
 
-		s.log.Infof("volume %s does not exist on node %s, creating new resource", volId, node)
+		s.logger(ctx).Infof("volume %s does not exist on node %s, creating new resource", volId, node)
 
 		// If only half of the expected resources are available, we need a diskfull deployment to have any hope
 		// of achieving quorum on the node. See the comment above availableDiskfullResources.
 		shouldDeployDiskful := availableDiskfullResources > 0 && unavailableDiskfullResources >= availableDiskfullResources
 
 		if shouldDeployDiskful {
-			s.log.Infof("%d replicas of %d are apparently not reachable, create a new diskfull resource for quorum", unavailableDiskfullResources, unavailableDiskfullResources+availableDiskfullResources)
+			s.logger(ctx).Infof("%d replicas of %d are apparently not reachable, create a new diskfull resource for quorum", unavailableDiskfullResources, unavailableDiskfullResources+availableDiskfullResources)
 
 			err = s.client.Resources.MakeAvailable(ctx, volId, node, lapi.ResourceMakeAvailable{Diskful: true})
 		} else {
@@ -504,7 +586,7 @@ func (s *Linstor) Attach(ctx context.Context, volId, node string, readOnly bool)
 		if errors.Is(err, lapi.NotFoundError) {
 			// Make-available honors replica-on-same and replicas-on-different. We do not, as the import parts of that
 			// are already covered in the allowed topology bits.
-			s.log.WithError(err).Info("fall back to manual diskless creation after make-available refused")
+			s.logger(ctx).WithError(err).Info("fall back to manual diskless creation after make-available refused")
 
 			rCreate := lapi.ResourceCreate{Resource: lapi.Resource{
 				Name:     volId,
@@ -532,6 +614,28 @@ func (s *Linstor) Attach(ctx context.Context, volId, node string, readOnly bool)
 		existingRes = &newRsc
 	}
 
+	if multiWriter && !readOnly {
+		writers := writablePublishedNodes(ress, node)
+		if len(writers) > 1 {
+			return fmt.Errorf("volume %s is already published read-write on nodes %v: %w", volId, writers, volume.ErrTooManyWriters)
+		}
+
+		if len(writers) == 1 {
+			s.logger(ctx).WithFields(logrus.Fields{
+				logging.FieldVolume: volId,
+				logging.FieldNode:   node,
+				"otherWriter":       writers[0],
+			}).Info("volume published read-write on two nodes, allowing two primaries")
+
+			err := s.client.ResourceDefinitions.Modify(ctx, volId, lapi.GenericPropsModify{OverrideProps: map[string]string{
+				linstor.PropertyAllowTwoPrimaries: "yes",
+			}})
+			if err != nil {
+				return fmt.Errorf("failed to allow two primaries: %w", err)
+			}
+		}
+	}
+
 	err = s.client.Resources.ModifyVolume(ctx, volId, node, 0, propsModify)
 	if err != nil {
 		return err
@@ -610,9 +714,9 @@ func inspectExistingResource(resource *lapi.Resource) (*bool, string) {
 
 // Detach removes a volume from the node.
 func (s *Linstor) Detach(ctx context.Context, volId, node string) error {
-	log := s.log.WithFields(logrus.Fields{
-		"volume":     volId,
-		"targetNode": node,
+	log := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		logging.FieldNode:   node,
 	})
 
 	vols, err := s.client.Resources.GetVolumes(ctx, volId, node)
@@ -624,6 +728,19 @@ func (s *Linstor) Detach(ctx context.Context, volId, node string) error {
 		return fmt.Errorf("expected exactly 1 volume, got %d instead", len(vols))
 	}
 
+	if _, ok := vols[0].Props[linstor.PublishedReadOnlyKey]; ok {
+		// Clear the marker set by Attach, so the volume is no longer reported as published on this node.
+		err := s.client.Resources.ModifyVolume(ctx, volId, node, 0, lapi.GenericPropsModify{DeleteProps: []string{linstor.PublishedReadOnlyKey}})
+		if err != nil {
+			return nil404(err)
+		}
+	}
+
+	err = s.resetAllowTwoPrimaries(ctx, volId, node)
+	if err != nil {
+		return fmt.Errorf("failed to reset allow-two-primaries: %w", err)
+	}
+
 	createdFor, ok := vols[0].Props[linstor.PropertyCreatedFor]
 	if !ok || createdFor != linstor.CreatedForTemporaryDisklessAttach {
 		log.Info("resource not temporary (not created by Attach) not deleting")
@@ -640,9 +757,160 @@ func (s *Linstor) Detach(ctx context.Context, volId, node string) error {
 	return nil404(s.client.Resources.Delete(ctx, volId, node))
 }
 
-// CapacityBytes returns the amount of free space in the storage pool specified by the params and topology.
-func (s *Linstor) CapacityBytes(ctx context.Context, storagePool string, segments map[string]string) (int64, error) {
-	log := s.log.WithField("storage-pool", storagePool).WithField("segments", segments)
+// resetAllowTwoPrimaries removes the DRBD option set by Attach once the volume is no longer published read-write on
+// two nodes.
+func (s *Linstor) resetAllowTwoPrimaries(ctx context.Context, volId, node string) error {
+	rd, err := s.client.ResourceDefinitions.Get(ctx, volId)
+	if err != nil {
+		return nil404(err)
+	}
+
+	if _, ok := rd.Props[linstor.PropertyAllowTwoPrimaries]; !ok {
+		return nil
+	}
+
+	ress, err := s.client.Resources.GetResourceView(ctx, &lapi.ListOpts{Resource: []string{volId}})
+	if err != nil {
+		return nil404(err)
+	}
+
+	if len(writablePublishedNodes(ress, node)) > 1 {
+		return nil
+	}
+
+	s.logger(ctx).WithField(logging.FieldVolume, volId).Info("volume no longer published read-write on two nodes, resetting allow-two-primaries")
+
+	return s.client.ResourceDefinitions.Modify(ctx, volId, lapi.GenericPropsModify{DeleteProps: []string{linstor.PropertyAllowTwoPrimaries}})
+}
+
+// writablePublishedNodes returns the nodes, except the given node, on which the volume is published read-write.
+func writablePublishedNodes(ress []lapi.ResourceWithVolumes, node string) []string {
+	var result []string
+
+	for i := range ress {
+		if ress[i].NodeName == node || len(ress[i].Volumes) == 0 {
+			continue
+		}
+
+		if ress[i].Volumes[0].Props[linstor.PublishedReadOnlyKey] == "false" {
+			result = append(result, ress[i].NodeName)
+		}
+	}
+
+	return result
+}
+
+// Status returns the nodes a volume is published on and its current health.
+//
+// A volume is considered abnormal if any of its DRBD replicas are Outdated, Inconsistent or StandAlone, or if
+// fewer diskful replicas exist than requested by the place count of the resource group.
+func (s *Linstor) Status(ctx context.Context, volId string) ([]string, *csi.VolumeCondition, error) {
+	ress, err := s.client.Resources.GetResourceView(ctx, &lapi.ListOpts{Resource: []string{volId}})
+	if nil404(err) != nil {
+		return nil, nil, err
+	}
+
+	rd, err := s.client.ResourceDefinitions.Get(ctx, volId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch resource definition: %w", err)
+	}
+
+	rg, err := s.client.ResourceGroups.Get(ctx, rd.ResourceGroupName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch resource group: %w", err)
+	}
+
+	var (
+		publishedNodes []string
+		problems       []string
+	)
+
+	diskfulReplicas := 0
+
+	for i := range ress {
+		res := &ress[i]
+
+		if len(res.Volumes) > 0 {
+			if _, ok := res.Volumes[0].Props[linstor.PublishedReadOnlyKey]; ok {
+				publishedNodes = append(publishedNodes, res.NodeName)
+			}
+		}
+
+		if !slice.ContainsString(res.Flags, lapiconsts.FlagDiskless) {
+			diskfulReplicas++
+		}
+
+		problems = append(problems, inspectResourceHealth(&res.Resource)...)
+	}
+
+	placeCount := int(rg.SelectFilter.PlaceCount)
+	if diskfulReplicas < placeCount {
+		problems = append(problems, fmt.Sprintf("only %d of %d replicas deployed", diskfulReplicas, placeCount))
+	}
+
+	sort.Strings(publishedNodes)
+
+	if len(problems) != 0 {
+		return publishedNodes, &csi.VolumeCondition{Abnormal: true, Message: strings.Join(problems, "; ")}, nil
+	}
+
+	return publishedNodes, &csi.VolumeCondition{Abnormal: false, Message: "all replicas healthy"}, nil
+}
+
+// DRBD states reported in the layer data that indicate a degraded replica.
+const (
+	drbdDiskStateOutdated     = "Outdated"
+	drbdDiskStateInconsistent = "Inconsistent"
+	drbdConnectionStandAlone  = "StandAlone"
+)
+
+// inspectResourceHealth walks the layers of a resource, just like inspectExistingResource, and reports problems
+// with the DRBD disk and connection states.
+func inspectResourceHealth(resource *lapi.Resource) []string {
+	layer := &resource.LayerObject
+
+	for layer != nil {
+		if layer.Type == devicelayerkind.Drbd {
+			var problems []string
+
+			for _, vol := range layer.Drbd.DrbdVolumes {
+				switch vol.DiskState {
+				case drbdDiskStateOutdated, drbdDiskStateInconsistent:
+					problems = append(problems, fmt.Sprintf("replica on %s is %s", resource.NodeName, vol.DiskState))
+				}
+			}
+
+			peers := make([]string, 0, len(layer.Drbd.Connections))
+			for peer := range layer.Drbd.Connections {
+				peers = append(peers, peer)
+			}
+
+			sort.Strings(peers)
+
+			for _, peer := range peers {
+				if layer.Drbd.Connections[peer].Message == drbdConnectionStandAlone {
+					problems = append(problems, fmt.Sprintf("replica on %s is %s towards %s", resource.NodeName, drbdConnectionStandAlone, peer))
+				}
+			}
+
+			return problems
+		}
+
+		if len(layer.Children) != 1 {
+			break
+		}
+
+		layer = &layer.Children[0]
+	}
+
+	return nil
+}
+
+// CapacityBytes returns the size of the largest volume that can be provisioned in the storage pool specified by the
+// params and topology. Every one of the placementCount replicas needs a storage pool with enough free capacity on a
+// distinct node. Capacity of thin pools is increased by the MaxOversubscriptionRatio configured in LINSTOR.
+func (s *Linstor) CapacityBytes(ctx context.Context, storagePool string, placementCount int32, segments map[string]string) (int64, error) {
+	log := s.logger(ctx).WithField("storage-pool", storagePool).WithField("segments", segments)
 
 	var requestedStoragePools []string
 
@@ -668,9 +936,10 @@ func (s *Linstor) CapacityBytes(ctx context.Context, storagePool string, segment
 		return 0, fmt.Errorf("unable to get capacity: %w", err)
 	}
 
-	var total int64
+	var candidates []lapi.StoragePool
+
 	for _, sp := range pools {
-		log := log.WithField("pool-to-check", sp.StoragePoolName).WithField("node", sp.NodeName)
+		log := log.WithField("pool-to-check", sp.StoragePoolName).WithField(logging.FieldNode, sp.NodeName)
 
 		if !slice.ContainsString(requestedNodes, sp.NodeName) {
 			log.Trace("not an allowed node")
@@ -682,12 +951,44 @@ func (s *Linstor) CapacityBytes(ctx context.Context, storagePool string, segment
 			continue
 		}
 
+		if sp.ProviderKind == lapi.DISKLESS {
+			log.Trace("diskless storage pool")
+			continue
+		}
+
 		if storagePool == "" || storagePool == sp.StoragePoolName {
-			log.Trace("adding storage pool capacity")
-			total += sp.FreeCapacity
+			candidates = append(candidates, sp)
+		}
+	}
+
+	ratio, err := s.oversubscriptionRatios(ctx, candidates)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get capacity: %w", err)
+	}
+
+	reserved, err := s.reservedCapacities(ctx, candidates)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get capacity: %w", err)
+	}
+
+	// A replica is placed in a single storage pool, so a node can hold a volume as large as its largest pool.
+	perNode := make(map[string]int64)
+
+	for _, sp := range candidates {
+		free := sp.FreeCapacity
+		if isThinPool(sp) {
+			free = thinCapacity(sp, ratio(sp), reserved(sp))
+		}
+
+		log.WithField("pool-to-check", sp.StoragePoolName).WithField(logging.FieldNode, sp.NodeName).WithField("free", free).Trace("adding storage pool capacity")
+
+		if free > perNode[sp.NodeName] {
+			perNode[sp.NodeName] = free
 		}
 	}
 
+	total := largestPlaceable(perNode, placementCount)
+
 	return int64(data.NewKibiByte(data.KiB * data.ByteSize(total)).To(data.B)), nil
 }
 
@@ -724,7 +1025,7 @@ func (s *Linstor) SnapCreate(ctx context.Context, id, sourceVolId string, params
 }
 
 func (s *Linstor) createInClusterSnapshot(ctx context.Context, id, sourceVolId string) (*lapi.Snapshot, error) {
-	log := s.log.WithField("resource", sourceVolId).WithField("id", id)
+	log := s.logger(ctx).WithField("resource", sourceVolId).WithField("id", id)
 
 	log.Debug("Creating in-cluster snapshot")
 
@@ -749,12 +1050,15 @@ func (s *Linstor) createInClusterSnapshot(ctx context.Context, id, sourceVolId s
 }
 
 // reconcileBackup ensure a backup exists at the given remote
-func (s *Linstor) reconcileBackup(ctx context.Context, id, sourceVolId string, params *volume.SnapshotParameters) (*lapi.Snapshot, error) {
-	log := s.log.WithField("resource", sourceVolId).WithField("id", id)
+func (s *Linstor) reconcileBackup(ctx context.Context, id, sourceVolId string, params *volume.SnapshotParameters) (_ *lapi.Snapshot, err error) {
+	ctx, span := tracing.Start(ctx, "reconcileBackup")
+	defer func() { tracing.End(span, err) }()
+
+	log := s.logger(ctx).WithField("resource", sourceVolId).WithField("id", id)
 
 	log.Debug("reconcile remote")
 
-	err := s.reconcileRemote(ctx, params)
+	err = s.reconcileRemote(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -787,14 +1091,124 @@ func (s *Linstor) reconcileBackup(ctx context.Context, id, sourceVolId string, p
 
 		return &snap, nil
 	case volume.SnapshotTypeLinstor:
-		return nil, fmt.Errorf("linstor-to-linstor snapshots not implemented")
+		return s.shipSnapshot(ctx, id, sourceVolId, params)
 	default:
 		return nil, fmt.Errorf("unsupported snapshot type '%s', don't know how to create a backup", params.Type)
 	}
 }
 
-func (s *Linstor) reconcileRemote(ctx context.Context, params *volume.SnapshotParameters) error {
-	log := s.log.WithField("remote-name", params.RemoteName)
+// shipSnapshot ships the volume to a LINSTOR remote.
+//
+// Shipping to another LINSTOR cluster does not let us choose the name of the snapshot LINSTOR takes for shipping. That
+// snapshot is used as CSI snapshot, so the local snapshot holds exactly the data that was shipped, and is reported
+// ready to use once shipping completed. The shipped copy is stored in the target cluster in a resource definition
+// named after the requested ID. The requested ID is mapped to the snapshot name on the resource definition, so
+// retries and lookups by the requested ID find the same snapshot.
+func (s *Linstor) shipSnapshot(ctx context.Context, id, sourceVolId string, params *volume.SnapshotParameters) (*lapi.Snapshot, error) {
+	log := s.logger(ctx).WithField("resource", sourceVolId).WithField("id", id)
+
+	rd, err := s.client.ResourceDefinitions.Get(ctx, sourceVolId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching resource definition: %w", err)
+	}
+
+	key := linstor.PropertyShippedSnapshotPrefix + id
+
+	if name, ok := rd.Props[key]; ok {
+		snap, err := s.client.Resources.GetSnapshot(ctx, sourceVolId, name)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching shipped snapshot %s: %w", name, err)
+		}
+
+		return &snap, nil
+	}
+
+	log.Debug("ship snapshot to LINSTOR remote")
+
+	err = s.client.Backup.Ship(ctx, params.RemoteName, lapi.BackupShipRequest{
+		SrcRscName:  sourceVolId,
+		DstRscName:  id,
+		DstStorPool: params.LinstorTargetStoragePool,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error shipping snapshot to LINSTOR remote: %w", err)
+	}
+
+	snap, err := s.newestUnmappedShippedSnapshot(ctx, sourceVolId, params.RemoteName, rd.Props)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.client.ResourceDefinitions.Modify(ctx, sourceVolId, lapi.GenericPropsModify{
+		OverrideProps: map[string]string{key: snap.Name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error recording shipped snapshot %s: %w", snap.Name, err)
+	}
+
+	log.WithField(logging.FieldSnapshot, snap.Name).Info("shipping snapshot to LINSTOR remote")
+
+	return snap, nil
+}
+
+// newestUnmappedShippedSnapshot returns the most recent snapshot taken to ship the resource to the remote that is not
+// yet mapped to a CSI snapshot ID. Snapshots of backups to other remotes and of scheduled backups are ignored. The
+// caller must ensure no other snapshot of the resource is shipped at the same time.
+func (s *Linstor) newestUnmappedShippedSnapshot(ctx context.Context, sourceVolId, remote string, rdProps map[string]string) (*lapi.Snapshot, error) {
+	mapped := make(map[string]struct{})
+
+	for k, v := range rdProps {
+		if strings.HasPrefix(k, linstor.PropertyShippedSnapshotPrefix) {
+			mapped[v] = struct{}{}
+		}
+	}
+
+	snaps, err := s.client.Resources.GetSnapshots(ctx, sourceVolId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots: %w", err)
+	}
+
+	var newest *lapi.Snapshot
+
+	for i := range snaps {
+		if !slice.ContainsString(snaps[i].Flags, lapiconsts.FlagBackup) || strings.HasPrefix(snaps[i].Name, linstor.ScheduledBackupPrefix) {
+			continue
+		}
+
+		if target, ok := snaps[i].Props[linstor.PropertyBackupTargetRemote]; ok && target != remote {
+			continue
+		}
+
+		if _, ok := mapped[snaps[i].Name]; ok {
+			continue
+		}
+
+		if newest == nil || snapshotCreated(&snaps[i]).After(snapshotCreated(newest)) {
+			newest = &snaps[i]
+		}
+	}
+
+	if newest == nil {
+		return nil, fmt.Errorf("no snapshot found for shipping %s", sourceVolId)
+	}
+
+	return newest, nil
+}
+
+// snapshotCreated returns the time the snapshot was taken, or the zero time if not known.
+func snapshotCreated(snap *lapi.Snapshot) time.Time {
+	if len(snap.Snapshots) == 0 || snap.Snapshots[0].CreateTimestamp == nil {
+		return time.Time{}
+	}
+
+	return snap.Snapshots[0].CreateTimestamp.Time
+}
+
+func (s *Linstor) reconcileRemote(ctx context.Context, params *volume.SnapshotParameters) (err error) {
+	ctx, span := tracing.Start(ctx, "reconcileRemote")
+	defer func() { tracing.End(span, err) }()
+
+	log := s.logger(ctx).WithField("remote-name", params.RemoteName)
 
 	switch params.Type {
 	case volume.SnapshotTypeS3:
@@ -829,7 +1243,36 @@ func (s *Linstor) reconcileRemote(ctx context.Context, params *volume.SnapshotPa
 
 		return nil
 	case volume.SnapshotTypeLinstor:
-		return fmt.Errorf("Linstor-to-Linstor snapshots not implemented")
+		log.Debug("search for LINSTOR remote with matching name")
+
+		remotes, err := s.client.Remote.GetAllLinstor(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list existing remotes: %w", err)
+		}
+
+		for _, r := range remotes {
+			if r.RemoteName == params.RemoteName {
+				log.WithField("remote", r).Debug("found existing LINSTOR remote with matching name")
+				return nil
+			}
+		}
+
+		if params.LinstorTargetUrl == "" {
+			return fmt.Errorf("no LINSTOR remote named '%s' exists, and no %s/linstor-target-url was specified to create one", params.RemoteName, linstor.SnapshotParameterNamespace)
+		}
+
+		log.Debug("No existing remote found, creating a new one")
+
+		err = s.client.Remote.CreateLinstor(ctx, lapi.LinstorRemote{
+			RemoteName: params.RemoteName,
+			Url:        params.LinstorTargetUrl,
+			ClusterId:  params.LinstorTargetClusterID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create new LINSTOR remote: %w", err)
+		}
+
+		return nil
 	default:
 		return fmt.Errorf("unsupported snapshot type '%s', don't know how to configure remote", params.Type)
 	}
@@ -837,7 +1280,7 @@ func (s *Linstor) reconcileRemote(ctx context.Context, params *volume.SnapshotPa
 
 // SnapDelete calls LINSTOR to delete the snapshot based on the CSI Snapshot ID.
 func (s *Linstor) SnapDelete(ctx context.Context, snap *csi.Snapshot) error {
-	log := s.log.WithField("snapshot", snap)
+	log := s.logger(ctx).WithField("snapshot", snap)
 
 	log.Debug("deleting snapshot")
 
@@ -846,17 +1289,46 @@ func (s *Linstor) SnapDelete(ctx context.Context, snap *csi.Snapshot) error {
 		return fmt.Errorf("failed to remove snaphsot: %v", err)
 	}
 
+	err = s.removeShippedSnapshotMapping(ctx, snap.GetSourceVolumeId(), snap.GetSnapshotId())
+	if err != nil {
+		return err
+	}
+
 	err = s.deleteResourceDefinitionAndGroupIfUnused(ctx, snap.GetSourceVolumeId())
 
 	return nil
 }
 
+// removeShippedSnapshotMapping removes the mapping of a requested snapshot ID to the deleted shipped snapshot.
+func (s *Linstor) removeShippedSnapshotMapping(ctx context.Context, rdName, snapName string) error {
+	rd, err := s.client.ResourceDefinitions.Get(ctx, rdName)
+	if nil404(err) != nil {
+		return fmt.Errorf("failed to fetch resource definition: %w", err)
+	}
+
+	var keys []string
+
+	for k, v := range rd.Props {
+		if strings.HasPrefix(k, linstor.PropertyShippedSnapshotPrefix) && v == snapName {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err = s.client.ResourceDefinitions.Modify(ctx, rdName, lapi.GenericPropsModify{DeleteProps: keys})
+	if nil404(err) != nil {
+		return fmt.Errorf("failed to remove shipped snapshot mapping: %w", err)
+	}
+
+	return nil
+}
+
 // VolFromSnap creates the volume using the data contained within the snapshot.
 func (s *Linstor) VolFromSnap(ctx context.Context, snap *csi.Snapshot, vol *volume.Info, params *volume.Parameters, topologies *csi.TopologyRequirement) error {
-	logger := s.log.WithFields(logrus.Fields{
-		"volume":   fmt.Sprintf("%+v", vol),
-		"snapshot": fmt.Sprintf("%+v", snap),
-	})
+	logger := s.logger(ctx).WithFields(vol.LogFields()).WithField(logging.FieldSnapshot, snap.GetSnapshotId())
 
 	logger.Debug("find requisite nodes")
 
@@ -909,7 +1381,7 @@ func (s *Linstor) VolFromSnap(ctx context.Context, snap *csi.Snapshot, vol *volu
 
 	logger.Debug("reconcile volume definition from request (may expand volume)")
 
-	_, err = s.reconcileVolumeDefinition(ctx, vol)
+	_, err = s.reconcileVolumeDefinition(ctx, vol, "")
 	if err != nil {
 		return err
 	}
@@ -923,19 +1395,148 @@ func (s *Linstor) VolFromSnap(ctx context.Context, snap *csi.Snapshot, vol *volu
 
 	logger.Debug("reconcile extra properties")
 
-	err = s.client.ResourceDefinitions.Modify(ctx, vol.ID, lapi.GenericPropsModify{OverrideProps: vol.Properties})
+	propsCtx, span := tracing.Start(ctx, "reconcileExtraProperties")
+	err = s.client.ResourceDefinitions.Modify(propsCtx, vol.ID, lapi.GenericPropsModify{OverrideProps: vol.Properties})
+	tracing.End(span, err)
+
+	if err != nil {
+		logger.Debugf("reconcile extra properties failed: %v", err)
+		return err
+	}
+
+	logger.Debug("success")
+	return nil
+}
+
+// cloneCleanup removes the properties a clone copies from its source that must not apply to the clone.
+var cloneCleanup = lapi.GenericPropsModify{
+	DeleteProps:      []string{linstor.PropertyProvisioningCompletedBy, linstor.PropertyNFSServer, linstor.PropertyNFSAddress},
+	DeleteNamespaces: []string{strings.TrimSuffix(linstor.PropertyNFSClientPrefix, "/")},
+}
+
+// VolFromVol creates the volume as a clone of the source volume, using the clone operation of LINSTOR.
+//
+// The storage driver copies the data, so the new volume does not depend on the source, not even on ZFS. The clone
+// inherits the resource group of the source, so volume.ErrCloneNotSupported is returned if the requested resource
+// group differs. It is also returned if the LINSTOR controller does not support cloning.
+func (s *Linstor) VolFromVol(ctx context.Context, sourceVol, vol *volume.Info, params *volume.Parameters, topologies *csi.TopologyRequirement) error {
+	logger := s.logger(ctx).WithFields(vol.LogFields()).WithField("source", sourceVol.ID)
+
+	if sourceVol.ResourceGroup != params.ResourceGroup {
+		return fmt.Errorf("%w: resource group '%s' differs from source resource group '%s'", volume.ErrCloneNotSupported, params.ResourceGroup, sourceVol.ResourceGroup)
+	}
+
+	logger.Debug("check for existing clone")
+
+	cloneStatus, err := s.client.ResourceDefinitions.CloneStatus(ctx, sourceVol.ID, vol.ID)
+	if nil404(err) != nil {
+		return fmt.Errorf("failed to check clone status: %w", err)
+	}
+
+	if err != nil {
+		logger.Debug("start clone")
+
+		_, err := s.client.ResourceDefinitions.Clone(ctx, sourceVol.ID, lapi.ResourceDefinitionCloneRequest{Name: vol.ID})
+		if err == lapi.NotFoundError {
+			// Older LINSTOR controllers don't know about the clone endpoint.
+			return fmt.Errorf("%w: %v", volume.ErrCloneNotSupported, err)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to start clone: %w", err)
+		}
+
+		cloneStatus.Status = clonestatus.Cloning
+	}
+
+	if cloneStatus.Status != clonestatus.Complete {
+		// The clone copies all properties of the source, including the marker that provisioning completed. Remove it
+		// until the clone completed, so a retried CreateVolume does not report the volume as ready too early. The
+		// marker is set again together with the other properties below. The NFS server, address and clients of the
+		// source are removed for good, the clone is exported on its own once published.
+		logger.Debug("remove provisioning marker and NFS export copied from source")
+
+		err = s.client.ResourceDefinitions.Modify(ctx, vol.ID, cloneCleanup)
+		if err != nil {
+			return fmt.Errorf("failed to remove properties copied from source: %w", err)
+		}
+	}
+
+	logger.Debug("wait for clone to complete")
+
+	err = s.waitCloneComplete(ctx, sourceVol.ID, vol.ID, cloneStatus)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("reconcile volume definition from request (may expand volume)")
+
+	_, err = s.reconcileVolumeDefinition(ctx, vol, "")
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("reconcile resource placement after clone")
+
+	err = s.reconcileResourcePlacement(ctx, vol, params, topologies)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("reconcile extra properties")
+
+	propsCtx, span := tracing.Start(ctx, "reconcileExtraProperties")
+	err = s.client.ResourceDefinitions.Modify(propsCtx, vol.ID, lapi.GenericPropsModify{OverrideProps: vol.Properties})
+	tracing.End(span, err)
+
 	if err != nil {
 		logger.Debugf("reconcile extra properties failed: %v", err)
 		return err
 	}
 
 	logger.Debug("success")
+
 	return nil
 }
 
+// cloneStatusPollInterval is the time between checks of a running clone operation.
+var cloneStatusPollInterval = 5 * time.Second
+
+func (s *Linstor) waitCloneComplete(ctx context.Context, sourceId, targetId string, cloneStatus lapi.ResourceDefinitionCloneStatus) error {
+	logger := s.logger(ctx).WithField("source", sourceId).WithField("target", targetId)
+
+	for {
+		switch cloneStatus.Status {
+		case clonestatus.Complete:
+			logger.Debug("clone complete")
+			return nil
+		case clonestatus.Failed:
+			return fmt.Errorf("failed to clone '%s' to '%s', check the LINSTOR error reports for details", sourceId, targetId)
+		}
+
+		logger.Debugf("clone in progress, wait %s", cloneStatusPollInterval)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cloneStatusPollInterval):
+		}
+
+		var err error
+
+		cloneStatus, err = s.client.ResourceDefinitions.CloneStatus(ctx, sourceId, targetId)
+		if err != nil {
+			return fmt.Errorf("failed to wait for clone: %w", err)
+		}
+	}
+}
+
 // reconcileSnapshot ensures that the snapshot exists on a node in the cluster.
-func (s *Linstor) reconcileSnapshot(ctx context.Context, sourceVolId, snapId string, nodes []string, targetPool string) error {
-	logger := s.log.WithField("snapshot", snapId).WithField("source", sourceVolId)
+func (s *Linstor) reconcileSnapshot(ctx context.Context, sourceVolId, snapId string, nodes []string, targetPool string) (err error) {
+	ctx, span := tracing.Start(ctx, "reconcileSnapshot")
+	defer func() { tracing.End(span, err) }()
+
+	logger := s.logger(ctx).WithField(logging.FieldSnapshot, snapId).WithField("source", sourceVolId)
 
 	logger.Debug("checking for existing local snapshot")
 
@@ -980,7 +1581,7 @@ func (s *Linstor) reconcileSnapshot(ctx context.Context, sourceVolId, snapId str
 			break
 		}
 
-		logger.WithError(err).WithField("node", node).Info("failed to restore backup to node")
+		logger.WithError(err).WithField(logging.FieldNode, node).Info("failed to restore backup to node")
 	}
 
 	if err != nil {
@@ -996,7 +1597,7 @@ func (s *Linstor) reconcileSnapshot(ctx context.Context, sourceVolId, snapId str
 }
 
 func (s *Linstor) waitLocalSnapshotSuccessful(ctx context.Context, snap *lapi.Snapshot) error {
-	logger := s.log.WithField("snap", snap.Name)
+	logger := s.logger(ctx).WithField("snap", snap.Name)
 
 	snapshotReady := func(snap *lapi.Snapshot) bool {
 		if !slice.ContainsString(snap.Flags, lapiconsts.FlagSuccessful) {
@@ -1057,8 +1658,11 @@ func (s *Linstor) findBackupInfo(ctx context.Context, sourceVolId, snapId string
 	return "", nil, nil
 }
 
-func (s *Linstor) reconcileSnapshotVolumeDefinitions(ctx context.Context, snapshot *csi.Snapshot, targetRD string) error {
-	logger := s.log.WithFields(logrus.Fields{"snapshot": snapshot, "target": targetRD})
+func (s *Linstor) reconcileSnapshotVolumeDefinitions(ctx context.Context, snapshot *csi.Snapshot, targetRD string) (err error) {
+	ctx, span := tracing.Start(ctx, "reconcileSnapshotVolumeDefinitions")
+	defer func() { tracing.End(span, err) }()
+
+	logger := s.logger(ctx).WithFields(logrus.Fields{logging.FieldSnapshot: snapshot, "target": targetRD})
 
 	logger.Debug("checking for existing volume definitions")
 	vdefs, err := s.client.ResourceDefinitions.GetVolumeDefinitions(ctx, targetRD)
@@ -1079,8 +1683,11 @@ func (s *Linstor) reconcileSnapshotVolumeDefinitions(ctx context.Context, snapsh
 	return nil
 }
 
-func (s *Linstor) reconcileSnapshotResources(ctx context.Context, snapshot *csi.Snapshot, targetRD string, preferredNodes []string) error {
-	logger := s.log.WithFields(logrus.Fields{"snapshot": snapshot, "target": targetRD})
+func (s *Linstor) reconcileSnapshotResources(ctx context.Context, snapshot *csi.Snapshot, targetRD string, preferredNodes []string) (err error) {
+	ctx, span := tracing.Start(ctx, "reconcileSnapshotResources")
+	defer func() { tracing.End(span, err) }()
+
+	logger := s.logger(ctx).WithFields(logrus.Fields{logging.FieldSnapshot: snapshot, "target": targetRD})
 
 	logger.Debug("checking for existing resources")
 	resources, err := s.client.Resources.GetAll(ctx, targetRD)
@@ -1132,8 +1739,11 @@ func (s *Linstor) fallbackNameUUIDNew() string {
 }
 
 // Reconcile a ResourceGroup based on the values passed to the StorageClass
-func (s *Linstor) reconcileResourceGroup(ctx context.Context, params *volume.Parameters) (*lapi.ResourceGroup, error) {
-	logger := s.log.WithFields(logrus.Fields{
+func (s *Linstor) reconcileResourceGroup(ctx context.Context, params *volume.Parameters) (_ *lapi.ResourceGroup, err error) {
+	ctx, span := tracing.Start(ctx, "reconcileResourceGroup")
+	defer func() { tracing.End(span, err) }()
+
+	logger := s.logger(ctx).WithFields(logrus.Fields{
 		"params": params,
 	})
 
@@ -1149,7 +1759,7 @@ func (s *Linstor) reconcileResourceGroup(ctx context.Context, params *volume.Par
 		// just create the minimal RG/VG, we sync all the props then anyways.
 		resourceGroup := lapi.ResourceGroup{
 			Name:         rgName,
-			Props:        make(map[string]string),
+			Props:        map[string]string{linstor.PropertyCreatedAt: time.Now().UTC().Format(time.RFC3339)},
 			SelectFilter: lapi.AutoSelectFilter{},
 		}
 		volumeGroup := lapi.VolumeGroup{}
@@ -1185,9 +1795,12 @@ func (s *Linstor) reconcileResourceGroup(ctx context.Context, params *volume.Par
 	return &rg, nil
 }
 
-func (s *Linstor) reconcileResourceDefinition(ctx context.Context, volId, rgName, fsType, mkfsOpts string) (*lapi.ResourceDefinition, error) {
-	logger := s.log.WithFields(logrus.Fields{
-		"volume": volId,
+func (s *Linstor) reconcileResourceDefinition(ctx context.Context, volId, rgName, fsType, mkfsOpts string) (_ *lapi.ResourceDefinition, err error) {
+	ctx, span := tracing.Start(ctx, "reconcileResourceDefinition")
+	defer func() { tracing.End(span, err) }()
+
+	logger := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
 	})
 	logger.Info("reconcile resource definition for volume")
 
@@ -1234,9 +1847,12 @@ func (s *Linstor) reconcileResourceDefinition(ctx context.Context, volId, rgName
 	return &rd, nil
 }
 
-func (s *Linstor) reconcileVolumeDefinition(ctx context.Context, info *volume.Info) (*lapi.VolumeDefinition, error) {
-	logger := s.log.WithFields(logrus.Fields{
-		"volume": info.ID,
+func (s *Linstor) reconcileVolumeDefinition(ctx context.Context, info *volume.Info, passphrase volume.Secret) (_ *lapi.VolumeDefinition, err error) {
+	ctx, span := tracing.Start(ctx, "reconcileVolumeDefinition")
+	defer func() { tracing.End(span, err) }()
+
+	logger := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: info.ID,
 	})
 	logger.Info("reconcile volume definition for volume")
 
@@ -1252,7 +1868,7 @@ func (s *Linstor) reconcileVolumeDefinition(ctx context.Context, info *volume.In
 			},
 		}
 
-		err = s.client.ResourceDefinitions.CreateVolumeDefinition(ctx, info.ID, vdCreate)
+		err = s.createVolumeDefinition(ctx, info.ID, vdCreate, passphrase)
 		if err != nil {
 			return nil, err
 		}
@@ -1276,14 +1892,32 @@ func (s *Linstor) reconcileVolumeDefinition(ctx context.Context, info *volume.In
 	return &vDef, nil
 }
 
-func (s *Linstor) reconcileResourcePlacement(ctx context.Context, vol *volume.Info, params *volume.Parameters, topologies *csi.TopologyRequirement) error {
-	logger := s.log.WithFields(logrus.Fields{
-		"volume": vol.ID,
+// createVolumeDefinition creates the volume definition, using the passphrase for the LUKS layer, if set.
+func (s *Linstor) createVolumeDefinition(ctx context.Context, volId string, vdCreate lapi.VolumeDefinitionCreate, passphrase volume.Secret) error {
+	if passphrase == "" {
+		return s.client.ResourceDefinitions.CreateVolumeDefinition(ctx, volId, vdCreate)
+	}
+
+	if s.client.EncryptedVolumeDefinitions == nil {
+		return errors.New("LUKS passphrases are not supported by this client")
+	}
+
+	s.logger(ctx).WithField(logging.FieldVolume, volId).Debug("creating volume definition with LUKS passphrase")
+
+	return s.client.EncryptedVolumeDefinitions.CreateEncryptedVolumeDefinition(ctx, volId, vdCreate, string(passphrase))
+}
+
+func (s *Linstor) reconcileResourcePlacement(ctx context.Context, vol *volume.Info, params *volume.Parameters, topologies *csi.TopologyRequirement) (err error) {
+	ctx, span := tracing.Start(ctx, "reconcileResourcePlacement")
+	defer func() { tracing.End(span, err) }()
+
+	logger := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: vol.ID,
 	})
 	logger.Info("reconcile resource placement for volume")
 
 	// Luckily for us, all the resource schedulers are idempotent
-	volumeScheduler, err := s.schedulerByPlacementPolicy(params.PlacementPolicy)
+	volumeScheduler, err := scheduler.New(params.PlacementPolicy, s.client, s.logger(ctx))
 	if err != nil {
 		return err
 	}
@@ -1332,7 +1966,7 @@ func (s *Linstor) FindSnapByID(ctx context.Context, id string) (*csi.Snapshot, b
 }
 
 func (s *Linstor) snapOrBackupById(ctx context.Context, id string) (*lapi.Snapshot, *lapi.Backup, error) {
-	log := s.log.WithField("id", id)
+	log := s.logger(ctx).WithField("id", id)
 
 	log.Debug("getting snapshot view")
 
@@ -1351,7 +1985,20 @@ func (s *Linstor) snapOrBackupById(ctx context.Context, id string) (*lapi.Snapsh
 		}
 	}
 
-	log.Debug("no snapshot matching id found, trying backups")
+	log.Debug("no snapshot matching id found, trying snapshots shipped to LINSTOR remotes")
+
+	shipped, err := s.shippedSnapshotByID(ctx, id, snaps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if shipped != nil {
+		log.WithField("snapshot", shipped.Name).Debug("found shipped snapshot with matching id")
+
+		return shipped, nil, nil
+	}
+
+	log.Debug("no shipped snapshot matching id found, trying backups")
 
 	s3remotes, err := s.client.Remote.GetAllS3(ctx)
 	if err != nil {
@@ -1390,8 +2037,31 @@ func (s *Linstor) snapOrBackupById(ctx context.Context, id string) (*lapi.Snapsh
 	return nil, nil, nil
 }
 
+// shippedSnapshotByID returns the snapshot shipped to a LINSTOR remote for the requested id, or nil if there is none.
+func (s *Linstor) shippedSnapshotByID(ctx context.Context, id string, snaps []lapi.Snapshot) (*lapi.Snapshot, error) {
+	rds, err := s.client.ResourceDefinitions.GetAll(ctx, lapi.RDGetAllRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource definitions: %w", err)
+	}
+
+	for i := range rds {
+		name, ok := rds[i].Props[linstor.PropertyShippedSnapshotPrefix+id]
+		if !ok {
+			continue
+		}
+
+		for j := range snaps {
+			if snaps[j].ResourceName == rds[i].Name && snaps[j].Name == name {
+				return &snaps[j], nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
 func (s *Linstor) FindSnapsBySource(ctx context.Context, sourceVol *volume.Info, start, limit int) ([]*csi.Snapshot, error) {
-	log := s.log.WithFields(logrus.Fields{"start": start, "limit": limit, "sourceVol": sourceVol})
+	log := s.logger(ctx).WithFields(logrus.Fields{"start": start, "limit": limit, "sourceVol": sourceVol})
 
 	log.Debug("fetching snapshots for resource definition")
 
@@ -1428,7 +2098,7 @@ func (s *Linstor) FindSnapsBySource(ctx context.Context, sourceVol *volume.Info,
 
 // ListSnaps returns list of snapshots available in the cluster, including those available in remote (S3) locations
 func (s *Linstor) ListSnaps(ctx context.Context, start, limit int) ([]*csi.Snapshot, error) {
-	log := s.log.WithFields(logrus.Fields{"start": start, "limit": limit})
+	log := s.logger(ctx).WithFields(logrus.Fields{"start": start, "limit": limit})
 
 	log.Debug("getting snapshot view")
 
@@ -1575,9 +2245,9 @@ func (s *Linstor) NodeAvailable(ctx context.Context, node string) error {
 
 // FindAssignmentOnNode returns a pointer to a volume.Assignment for a given node.
 func (s *Linstor) FindAssignmentOnNode(ctx context.Context, volId, node string) (*volume.Assignment, error) {
-	s.log.WithFields(logrus.Fields{
-		"volume":     volId,
-		"targetNode": node,
+	s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		logging.FieldNode:   node,
 	}).Debug("getting assignment info")
 
 	linVol, err := s.client.Resources.GetVolume(ctx, volId, node, 0)
@@ -1600,9 +2270,13 @@ func (s *Linstor) FindAssignmentOnNode(ctx context.Context, volId, node string)
 		ReadOnly: readOnly,
 	}
 
-	s.log.WithFields(logrus.Fields{
-		"volumeAssignment": fmt.Sprintf("%+v", va),
-	}).Debug("found assignment info")
+	for _, layer := range linVol.LayerDataList {
+		if luks, ok := layer.Data.(*lapi.LuksVolume); ok {
+			va.LuksBackingDevice = luks.BackingDevice
+		}
+	}
+
+	s.logger(ctx).WithFields(va.LogFields()).Debug("found assignment info")
 
 	return va, nil
 }
@@ -1617,7 +2291,7 @@ func (s *Linstor) Mount(ctx context.Context, source, target, fsType string, read
 		block = true
 	}
 
-	s.log.WithFields(logrus.Fields{
+	s.logger(ctx).WithFields(logrus.Fields{
 		"source":          source,
 		"target":          target,
 		"mountOpts":       mntOpts,
@@ -1650,21 +2324,9 @@ func (s *Linstor) Mount(ctx context.Context, source, target, fsType string, read
 		}
 	}
 
-	// This is a regular filesystem so format the device and create the mountpoint.
-	if !block {
-		if err := os.MkdirAll(target, os.FileMode(0755)); err != nil {
-			return fmt.Errorf("could not create target directory %s, %v", target, err)
-		}
-		// This is a block volume so create a file to bindmount to.
-	} else {
-		f, err := os.OpenFile(target, os.O_CREATE, os.FileMode(0644))
-		if err != nil {
-			if !os.IsExist(err) {
-				return fmt.Errorf("could not create bind target for block volume %s, %w", target, err)
-			}
-		} else {
-			_ = f.Close()
-		}
+	err = ensureMountTarget(target, block)
+	if err != nil {
+		return err
 	}
 
 	needsMount, err := mount.IsNotMountPoint(s.mounter, target)
@@ -1703,6 +2365,67 @@ func (s *Linstor) Mount(ctx context.Context, source, target, fsType string, read
 	return nil
 }
 
+// BindMount makes a staged volume available at the target. For filesystems the source is the staging directory,
+// for block volumes it is the bind mounted device in the staging directory.
+// Operates locally on the machines where it is called.
+func (s *Linstor) BindMount(ctx context.Context, source, target string, block, readonly bool) error {
+	s.logger(ctx).WithFields(logrus.Fields{
+		"source":          source,
+		"target":          target,
+		"readonly":        readonly,
+		"blockAccessMode": block,
+	}).Info("bind mounting volume")
+
+	err := ensureMountTarget(target, block)
+	if err != nil {
+		return err
+	}
+
+	needsMount, err := mount.IsNotMountPoint(s.mounter, target)
+	if err != nil {
+		return fmt.Errorf("unable to determine mount status of %s %v", target, err)
+	}
+
+	if !needsMount {
+		return nil
+	}
+
+	mntOpts := []string{"bind"}
+	if readonly {
+		mntOpts = append(mntOpts, "ro")
+	}
+
+	return s.mounter.Mount(source, target, "", mntOpts)
+}
+
+// ensureMountTarget creates the directory (for filesystems) or file (for block volumes) to mount to.
+func ensureMountTarget(target string, block bool) error {
+	// This is a regular filesystem so create the mountpoint.
+	if !block {
+		if err := os.MkdirAll(target, os.FileMode(0755)); err != nil {
+			return fmt.Errorf("could not create target directory %s, %v", target, err)
+		}
+
+		return nil
+	}
+
+	// This is a block volume so create a file to bindmount to.
+	if err := os.MkdirAll(filepath.Dir(target), os.FileMode(0755)); err != nil {
+		return fmt.Errorf("could not create parent directory for block volume %s, %v", target, err)
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE, os.FileMode(0644))
+	if err != nil {
+		if !os.IsExist(err) {
+			return fmt.Errorf("could not create bind target for block volume %s, %w", target, err)
+		}
+	} else {
+		_ = f.Close()
+	}
+
+	return nil
+}
+
 func (s *Linstor) setDevReadOnly(ctx context.Context, srcPath string) error {
 	_, err := s.mounter.Exec.CommandContext(ctx, "blockdev", "--setro", srcPath).CombinedOutput()
 	return err
@@ -1729,6 +2452,29 @@ func (s *Linstor) IsNotMountPoint(target string) (bool, error) {
 	return notMounted, nil
 }
 
+// CheckLuksPassphrase verifies that the passphrase unlocks the LUKS device, without opening it.
+// Operates locally on the machines where it is called.
+func (s *Linstor) CheckLuksPassphrase(ctx context.Context, device, passphrase string) error {
+	s.logger(ctx).WithField("device", device).Debug("checking LUKS passphrase")
+
+	// The passphrase is passed via stdin, so it does not show up in the process list.
+	cmd := s.mounter.Exec.CommandContext(ctx, "cryptsetup", "open", "--test-passphrase", "--key-file=-", device)
+	cmd.SetStdin(strings.NewReader(passphrase))
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr utilexec.ExitError
+		// cryptsetup exits with 2 if no key slot can be unlocked with the passphrase.
+		if errors.As(err, &exitErr) && exitErr.ExitStatus() == 2 {
+			return volume.ErrLuksPassphraseMismatch
+		}
+
+		return fmt.Errorf("failed to check LUKS passphrase of %s: %w: %s", device, err, out)
+	}
+
+	return nil
+}
+
 // Unmount unmounts the target. Operates locally on the machines where it is called.
 func (s *Linstor) Unmount(target string) error {
 	s.log.WithFields(logrus.Fields{
@@ -1825,9 +2571,7 @@ func (s *Linstor) NodeExpand(source, target string) error {
 }
 
 func (s *Linstor) ControllerExpand(ctx context.Context, vol *volume.Info) error {
-	s.log.WithFields(logrus.Fields{
-		"volume": fmt.Sprintf("%+v", vol),
-	}).Info("controller expand volume")
+	s.logger(ctx).WithFields(vol.LogFields()).Info("controller expand volume")
 
 	volumeDefinitionModify := lapi.VolumeDefinitionModify{
 		SizeKib: uint64(data.NewKibiByte(data.ByteSize(vol.SizeBytes)).Value()),
@@ -1895,7 +2639,7 @@ func (s *Linstor) GetNodeTopologies(ctx context.Context, nodename string) (*csi.
 // * No resources are placed
 // * No snapshots of the resource exist
 func (s *Linstor) deleteResourceDefinitionAndGroupIfUnused(ctx context.Context, rdName string) error {
-	log := s.log.WithField("rd", rdName)
+	log := s.logger(ctx).WithField("rd", rdName)
 	log.Debug("checking for undeleted resources")
 
 	resources, err := s.client.Resources.GetAll(ctx, rdName)
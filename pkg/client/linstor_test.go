@@ -23,14 +23,24 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"maps"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	lapiconsts "github.com/LINBIT/golinstor"
 	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/LINBIT/golinstor/clonestatus"
+	"github.com/LINBIT/golinstor/devicelayerkind"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/pborman/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
 
 	"github.com/piraeusdatastore/linstor-csi/pkg/client/mocks"
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
@@ -179,11 +189,47 @@ func TestLinstor_Attach(t *testing.T) {
 		}
 		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
 
-		err := cl.Attach(context.Background(), ExampleResourceID, "node-2", false)
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-2", false, false)
 		assert.NoError(t, err)
 		m.AssertExpectations(t)
 	})
 
+	t.Run("existing resource multi writer", func(t *testing.T) {
+		m := mocks.ResourceProvider{}
+		rv, rvErr := fromJson(ResourceViewAllOnline)
+		rv[0].Volumes[0].Props[linstor.PublishedReadOnlyKey] = "false"
+
+		m.ExpectedCalls = []*mock.Call{
+			{Method: "GetResourceView", Arguments: mock.Arguments{mock.Anything, mock.Anything}, ReturnArguments: mock.Arguments{rv, rvErr}},
+			{Method: "ModifyVolume", Arguments: mock.Arguments{mock.Anything, ExampleResourceID, "node-2", 0, ResourceModifyReadWrite}, ReturnArguments: mock.Arguments{nil}},
+		}
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Modify", mock.Anything, ExampleResourceID, lapi.GenericPropsModify{OverrideProps: map[string]string{linstor.PropertyAllowTwoPrimaries: "yes"}}).Return(nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-2", false, true)
+		assert.NoError(t, err)
+		m.AssertExpectations(t)
+		rds.AssertExpectations(t)
+	})
+
+	t.Run("existing resource multi writer with two writers", func(t *testing.T) {
+		m := mocks.ResourceProvider{}
+		rv, rvErr := fromJson(ResourceViewAllOnline)
+		rv[0].Volumes[0].Props[linstor.PublishedReadOnlyKey] = "false"
+		rv[1].Volumes[0].Props[linstor.PublishedReadOnlyKey] = "false"
+
+		m.ExpectedCalls = []*mock.Call{
+			{Method: "GetResourceView", Arguments: mock.Arguments{mock.Anything, mock.Anything}, ReturnArguments: mock.Arguments{rv, rvErr}},
+		}
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-2", false, true)
+		assert.Error(t, err)
+		m.AssertExpectations(t)
+	})
+
 	t.Run("no resource with expected diskfull resources", func(t *testing.T) {
 		m := mocks.ResourceProvider{}
 		rv, rvErr := fromJson(ResourceViewOneOfflineQuorum)
@@ -196,7 +242,7 @@ func TestLinstor_Attach(t *testing.T) {
 		}
 		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
 
-		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false)
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false, false)
 		assert.NoError(t, err)
 		m.AssertExpectations(t)
 	})
@@ -214,7 +260,7 @@ func TestLinstor_Attach(t *testing.T) {
 		}
 		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
 
-		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false)
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false, false)
 		assert.NoError(t, err)
 		m.AssertExpectations(t)
 	})
@@ -231,7 +277,7 @@ func TestLinstor_Attach(t *testing.T) {
 		}
 		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
 
-		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false)
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false, false)
 		assert.NoError(t, err)
 		m.AssertExpectations(t)
 	})
@@ -249,7 +295,7 @@ func TestLinstor_Attach(t *testing.T) {
 		}
 		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
 
-		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false)
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false, false)
 		assert.NoError(t, err)
 		m.AssertExpectations(t)
 	})
@@ -266,11 +312,31 @@ func TestLinstor_Attach(t *testing.T) {
 		}
 		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
 
-		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false)
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-3", false, false)
 		assert.NoError(t, err)
 		m.AssertExpectations(t)
 	})
 
+	t.Run("multi writer already published on two nodes", func(t *testing.T) {
+		m := mocks.ResourceProvider{}
+		writer := func(node string) lapi.ResourceWithVolumes {
+			return lapi.ResourceWithVolumes{
+				Resource: lapi.Resource{Name: ExampleResourceID, NodeName: node},
+				Volumes:  []lapi.Volume{{Props: map[string]string{linstor.PublishedReadOnlyKey: "false"}}},
+			}
+		}
+		m.On("GetResourceView", mock.Anything, mock.Anything).Return([]lapi.ResourceWithVolumes{
+			writer("node-0"),
+			writer("node-1"),
+			{Resource: lapi.Resource{Name: ExampleResourceID, NodeName: "node-2"}, Volumes: []lapi.Volume{{}}},
+		}, nil)
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-2", false, true)
+		assert.ErrorIs(t, err, volume.ErrTooManyWriters)
+		m.AssertNotCalled(t, "ModifyVolume", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
 	t.Run("existing resource shared storage pool and read only", func(t *testing.T) {
 		m := mocks.ResourceProvider{}
 		rv, rvErr := fromJson(ResourceViewSharedStoragePool)
@@ -283,12 +349,359 @@ func TestLinstor_Attach(t *testing.T) {
 		}
 		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &m}}, log: logrus.WithField("test", t.Name())}
 
-		err := cl.Attach(context.Background(), ExampleResourceID, "node-2", true)
+		err := cl.Attach(context.Background(), ExampleResourceID, "node-2", true, false)
 		assert.NoError(t, err)
 		m.AssertExpectations(t)
 	})
 }
 
+func TestLinstor_Detach(t *testing.T) {
+	t.Run("reset allow two primaries", func(t *testing.T) {
+		rscs := mocks.ResourceProvider{}
+		rscs.On("GetVolumes", mock.Anything, ExampleResourceID, "node-1").Return([]lapi.Volume{{Props: map[string]string{linstor.PublishedReadOnlyKey: "false"}}}, nil)
+		rscs.On("ModifyVolume", mock.Anything, ExampleResourceID, "node-1", 0, lapi.GenericPropsModify{DeleteProps: []string{linstor.PublishedReadOnlyKey}}).Return(nil)
+		rscs.On("GetResourceView", mock.Anything, mock.Anything).Return([]lapi.ResourceWithVolumes{
+			{Resource: lapi.Resource{NodeName: "node-0"}, Volumes: []lapi.Volume{{Props: map[string]string{linstor.PublishedReadOnlyKey: "false"}}}},
+			{Resource: lapi.Resource{NodeName: "node-1"}, Volumes: []lapi.Volume{{Props: map[string]string{}}}},
+		}, nil)
+
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, ExampleResourceID).Return(lapi.ResourceDefinition{Name: ExampleResourceID, Props: map[string]string{linstor.PropertyAllowTwoPrimaries: "yes"}}, nil)
+		rds.On("Modify", mock.Anything, ExampleResourceID, lapi.GenericPropsModify{DeleteProps: []string{linstor.PropertyAllowTwoPrimaries}}).Return(nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &rscs, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Detach(context.Background(), ExampleResourceID, "node-1")
+		assert.NoError(t, err)
+		rscs.AssertExpectations(t)
+		rds.AssertExpectations(t)
+	})
+}
+
+func TestLinstor_RemoveOrphanedTemporaryResources(t *testing.T) {
+	old := &lapi.TimeStampMs{Time: time.Now().Add(-time.Hour)}
+	recent := &lapi.TimeStampMs{Time: time.Now()}
+
+	temporary := func(name, node string, created *lapi.TimeStampMs, props map[string]string) lapi.ResourceWithVolumes {
+		volProps := map[string]string{linstor.PropertyCreatedFor: linstor.CreatedForTemporaryDisklessAttach}
+		for k, v := range props {
+			volProps[k] = v
+		}
+
+		return lapi.ResourceWithVolumes{
+			Resource:        lapi.Resource{Name: name, NodeName: node},
+			CreateTimestamp: created,
+			Volumes:         []lapi.Volume{{ProviderKind: lapi.DISKLESS, Props: volProps}},
+		}
+	}
+
+	view := []lapi.ResourceWithVolumes{
+		temporary("attached", "node-1", old, map[string]string{linstor.PublishedReadOnlyKey: "false"}),
+		temporary("detached", "node-1", old, nil),
+		temporary("stale", "node-2", old, map[string]string{linstor.PublishedReadOnlyKey: "false"}),
+		temporary("recent", "node-1", recent, nil),
+		// Ephemeral volumes have no VolumeAttachment, and a read-only mount is not in use.
+		temporary("ephemeral", "node-1", old, map[string]string{linstor.PublishedReadOnlyKey: "true"}),
+		{
+			Resource:        lapi.Resource{Name: "diskful", NodeName: "node-1"},
+			CreateTimestamp: old,
+			Volumes:         []lapi.Volume{{ProviderKind: lapi.LVM_THIN, Props: map[string]string{}}},
+		},
+	}
+
+	rds := mocks.ResourceDefinitionProvider{}
+	rds.On("GetAll", mock.Anything, lapi.RDGetAllRequest{
+		Props: []string{linstor.PropertyCreatedFor + "=" + linstor.CreatedForEphemeralVolume},
+	}).Return([]lapi.ResourceDefinitionWithVolumeDefinition{{ResourceDefinition: lapi.ResourceDefinition{
+		Name:  "ephemeral",
+		Props: map[string]string{linstor.PropertyCreatedFor: linstor.CreatedForEphemeralVolume},
+	}}}, nil)
+
+	t.Run("without attachments", func(t *testing.T) {
+		rscs := mocks.ResourceProvider{}
+		rscs.On("GetResourceView", mock.Anything).Return(view, nil)
+		rscs.On("Delete", mock.Anything, "detached", "node-1").Return(nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &rscs, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		removed, err := cl.RemoveOrphanedTemporaryResources(context.Background(), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		rscs.AssertExpectations(t)
+	})
+
+	t.Run("with attachments", func(t *testing.T) {
+		rscs := mocks.ResourceProvider{}
+		rscs.On("GetResourceView", mock.Anything).Return(view, nil)
+		rscs.On("Delete", mock.Anything, "detached", "node-1").Return(nil)
+		rscs.On("Delete", mock.Anything, "stale", "node-2").Return(lapi.NotFoundError)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &rscs, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		removed, err := cl.RemoveOrphanedTemporaryResources(context.Background(), map[volume.Attachment]struct{}{
+			{VolumeID: "attached", Node: "node-1"}: {},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, removed)
+		rscs.AssertExpectations(t)
+	})
+}
+
+func TestLinstor_RemoveOrphanedResourceGroups(t *testing.T) {
+	const (
+		used    = "sc-0a4ac1a4-4a1b-5a2a-9c32-b8c4b8c2b7b1"
+		unused  = "sc-1e3a2b4c-5d6e-5f70-8192-a3b4c5d6e7f8"
+		racing  = "sc-2e3a2b4c-5d6e-5f70-8192-a3b4c5d6e7f8"
+		young   = "sc-3e3a2b4c-5d6e-5f70-8192-a3b4c5d6e7f8"
+		old     = "sc-4e3a2b4c-5d6e-5f70-8192-a3b4c5d6e7f8"
+		manual  = "my-resource-group"
+		dfltGrp = "DfltRscGrp"
+	)
+
+	var existsRscDfn uint64 = lapiconsts.FailExistsRscDfn
+
+	createdAt := func(d time.Duration) map[string]string {
+		return map[string]string{linstor.PropertyCreatedAt: time.Now().Add(-d).UTC().Format(time.RFC3339)}
+	}
+
+	rgs := mocks.ResourceGroupProvider{}
+	rgs.On("GetAll", mock.Anything).Return([]lapi.ResourceGroup{
+		{Name: used},
+		{Name: unused},
+		{Name: racing},
+		{Name: young, Props: createdAt(time.Minute)},
+		{Name: old, Props: createdAt(time.Hour)},
+		{Name: manual},
+		{Name: dfltGrp},
+	}, nil)
+	rgs.On("Delete", mock.Anything, old).Return(nil)
+	rgs.On("Delete", mock.Anything, unused).Return(nil)
+	rgs.On("Delete", mock.Anything, racing).Return(lapi.ApiCallError{{RetCode: int64(existsRscDfn)}})
+
+	rds := mocks.ResourceDefinitionProvider{}
+	rds.On("GetAll", mock.Anything, lapi.RDGetAllRequest{}).Return([]lapi.ResourceDefinitionWithVolumeDefinition{
+		{ResourceDefinition: lapi.ResourceDefinition{Name: "pvc-1", ResourceGroupName: used}},
+	}, nil)
+
+	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceGroups: &rgs, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+	removed, err := cl.RemoveOrphanedResourceGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	rgs.AssertExpectations(t)
+}
+
+func TestLinstor_Adopt(t *testing.T) {
+	rds := mocks.ResourceDefinitionProvider{}
+	rds.On("Get", mock.Anything, ExampleResourceID).Return(lapi.ResourceDefinition{Name: ExampleResourceID, Props: map[string]string{
+		"FileSystem/Type": "xfs",
+	}}, nil)
+	rds.On("Modify", mock.Anything, ExampleResourceID, lapi.GenericPropsModify{OverrideProps: map[string]string{
+		linstor.LegacyParameterPassKey:          `{"parameters":{"linstor.csi.linbit.com/mountOpts":"noatime"}}`,
+		linstor.PropertyProvisioningCompletedBy: "linstor-csi/test",
+	}}).Return(nil)
+
+	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+	// The existing filesystem type is kept.
+	err := cl.Adopt(context.Background(), &volume.Info{
+		ID:         ExampleResourceID,
+		FsType:     "ext4",
+		Properties: map[string]string{linstor.PropertyProvisioningCompletedBy: "linstor-csi/test"},
+	}, map[string]string{"linstor.csi.linbit.com/mountOpts": "noatime"})
+	assert.NoError(t, err)
+	rds.AssertExpectations(t)
+}
+
+func TestLinstor_VolFromVol(t *testing.T) {
+	cloneStatusPollInterval = time.Millisecond
+
+	source := &volume.Info{ID: "source", ResourceGroup: "rg1", SizeBytes: 1 << 30}
+	target := &volume.Info{ID: "target", ResourceGroup: "rg1", SizeBytes: 1 << 30, Properties: map[string]string{linstor.PropertyProvisioningCompletedBy: "linstor-csi/test"}}
+	params := &volume.Parameters{ResourceGroup: "rg1", PlacementPolicy: topology.Manual}
+	// The clone copies the provisioning marker of the source, it must not be present until the clone completed.
+	unmarkClone := cloneCleanup
+
+	t.Run("clone", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("CloneStatus", mock.Anything, "source", "target").Return(lapi.ResourceDefinitionCloneStatus{}, lapi.NotFoundError).Once()
+		rds.On("Clone", mock.Anything, "source", lapi.ResourceDefinitionCloneRequest{Name: "target"}).Return(lapi.ResourceDefinitionCloneStarted{}, nil)
+		rds.On("CloneStatus", mock.Anything, "source", "target").Return(lapi.ResourceDefinitionCloneStatus{Status: clonestatus.Cloning}, nil).Once()
+		rds.On("CloneStatus", mock.Anything, "source", "target").Return(lapi.ResourceDefinitionCloneStatus{Status: clonestatus.Complete}, nil).Once()
+		rds.On("Modify", mock.Anything, "target", unmarkClone).Return(nil).Once()
+		rds.On("GetVolumeDefinition", mock.Anything, "target", 0).Return(lapi.VolumeDefinition{SizeKib: 1 << 20}, nil)
+		rds.On("Modify", mock.Anything, "target", lapi.GenericPropsModify{OverrideProps: target.Properties}).Return(nil).Once()
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.VolFromVol(context.Background(), source, target, params, nil)
+		assert.NoError(t, err)
+		rds.AssertExpectations(t)
+	})
+
+	t.Run("clone of NFS exported volume", func(t *testing.T) {
+		props := map[string]map[string]string{
+			"source": {
+				linstor.PropertyProvisioningCompletedBy:    "linstor-csi/test",
+				linstor.PropertyNFSServer:                  "node-1",
+				linstor.PropertyNFSAddress:                 "10.0.0.10",
+				linstor.PropertyNFSClientPrefix + "node-2": "true",
+			},
+		}
+
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("CloneStatus", mock.Anything, "source", "target").Return(lapi.ResourceDefinitionCloneStatus{}, lapi.NotFoundError).Once()
+		rds.On("Clone", mock.Anything, "source", lapi.ResourceDefinitionCloneRequest{Name: "target"}).Return(lapi.ResourceDefinitionCloneStarted{}, nil).Run(func(mock.Arguments) {
+			props["target"] = maps.Clone(props["source"])
+		})
+		rds.On("CloneStatus", mock.Anything, "source", "target").Return(lapi.ResourceDefinitionCloneStatus{Status: clonestatus.Complete}, nil)
+		rds.On("GetVolumeDefinition", mock.Anything, "target", 0).Return(lapi.VolumeDefinition{SizeKib: 1 << 20}, nil)
+		rds.On("Modify", mock.Anything, "target", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			modify := args.Get(2).(lapi.GenericPropsModify)
+			for _, k := range modify.DeleteProps {
+				delete(props["target"], k)
+			}
+
+			for _, ns := range modify.DeleteNamespaces {
+				for k := range props["target"] {
+					if strings.HasPrefix(k, ns+"/") {
+						delete(props["target"], k)
+					}
+				}
+			}
+
+			maps.Copy(props["target"], modify.OverrideProps)
+		})
+		rds.On("GetAll", mock.Anything, lapi.RDGetAllRequest{}).Return(func(context.Context, lapi.RDGetAllRequest) []lapi.ResourceDefinitionWithVolumeDefinition {
+			return []lapi.ResourceDefinitionWithVolumeDefinition{
+				{ResourceDefinition: lapi.ResourceDefinition{Name: "source", Props: props["source"]}},
+				{ResourceDefinition: lapi.ResourceDefinition{Name: "target", Props: props["target"]}},
+			}
+		}, nil)
+
+		rscs := mocks.ResourceProvider{}
+		rscs.On("GetResourceView", mock.Anything).Return(nil, nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds, Resources: &rscs}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.VolFromVol(context.Background(), source, target, params, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, target.Properties, props["target"])
+
+		nfsVols, err := cl.NFSVolumes(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, nfsVols, 1)
+		assert.Equal(t, "source", nfsVols[0].ID)
+	})
+
+	t.Run("clone failed", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("CloneStatus", mock.Anything, "source", "target").Return(lapi.ResourceDefinitionCloneStatus{Status: clonestatus.Failed}, nil)
+		rds.On("Modify", mock.Anything, "target", unmarkClone).Return(nil).Once()
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.VolFromVol(context.Background(), source, target, params, nil)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, volume.ErrCloneNotSupported)
+		rds.AssertExpectations(t)
+	})
+
+	t.Run("clone not supported", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("CloneStatus", mock.Anything, "source", "target").Return(lapi.ResourceDefinitionCloneStatus{}, lapi.NotFoundError)
+		rds.On("Clone", mock.Anything, "source", mock.Anything).Return(lapi.ResourceDefinitionCloneStarted{}, lapi.NotFoundError)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.VolFromVol(context.Background(), source, target, params, nil)
+		assert.ErrorIs(t, err, volume.ErrCloneNotSupported)
+	})
+
+	t.Run("different resource group", func(t *testing.T) {
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.VolFromVol(context.Background(), source, target, &volume.Parameters{ResourceGroup: "rg2"}, nil)
+		assert.ErrorIs(t, err, volume.ErrCloneNotSupported)
+	})
+}
+
+func TestLinstor_Status(t *testing.T) {
+	fromJson := func(s string) ([]lapi.ResourceWithVolumes, error) {
+		var result []lapi.ResourceWithVolumes
+
+		err := json.Unmarshal([]byte(s), &result)
+		if err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	}
+
+	testcases := []struct {
+		name              string
+		resourceView      string
+		placeCount        int32
+		expectedNodes     []string
+		expectedAbnormal  bool
+		expectedCondition string
+	}{
+		{
+			name:              "healthy",
+			resourceView:      ResourceViewAllOnline,
+			placeCount:        3,
+			expectedNodes:     []string{"node-0"},
+			expectedCondition: "all replicas healthy",
+		},
+		{
+			name:              "missing replicas",
+			resourceView:      ResourceViewAllOnline,
+			placeCount:        4,
+			expectedNodes:     []string{"node-0"},
+			expectedAbnormal:  true,
+			expectedCondition: "only 3 of 4 replicas deployed",
+		},
+		{
+			name:              "standalone",
+			resourceView:      ResourceViewOneDrbdForceDisconnectNoQuorum,
+			placeCount:        2,
+			expectedNodes:     []string{"node-0"},
+			expectedAbnormal:  true,
+			expectedCondition: "replica on node-1 is StandAlone towards node-0; replica on node-1 is StandAlone towards node-2",
+		},
+	}
+
+	for i := range testcases {
+		tcase := &testcases[i]
+		t.Run(tcase.name, func(t *testing.T) {
+			rv, err := fromJson(tcase.resourceView)
+			assert.NoError(t, err)
+
+			rv[0].Volumes[0].Props[linstor.PublishedReadOnlyKey] = "false"
+
+			rscs := mocks.ResourceProvider{}
+			rscs.On("GetResourceView", mock.Anything, mock.Anything).Return(rv, nil)
+
+			rds := mocks.ResourceDefinitionProvider{}
+			rds.On("Get", mock.Anything, ExampleResourceID).Return(lapi.ResourceDefinition{Name: ExampleResourceID, ResourceGroupName: "rg1"}, nil)
+
+			rgs := mocks.ResourceGroupProvider{}
+			rgs.On("Get", mock.Anything, "rg1").Return(lapi.ResourceGroup{Name: "rg1", SelectFilter: lapi.AutoSelectFilter{PlaceCount: tcase.placeCount}}, nil)
+
+			cl := Linstor{
+				client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &rscs, ResourceDefinitions: &rds, ResourceGroups: &rgs}},
+				log:    logrus.WithField("test", t.Name()),
+			}
+
+			nodes, condition, err := cl.Status(context.Background(), ExampleResourceID)
+			assert.NoError(t, err)
+			assert.Equal(t, tcase.expectedNodes, nodes)
+			assert.Equal(t, tcase.expectedAbnormal, condition.GetAbnormal())
+			assert.Equal(t, tcase.expectedCondition, condition.GetMessage())
+		})
+	}
+}
+
 func TestLinstor_CapacityBytes(t *testing.T) {
 	t.Parallel()
 
@@ -300,13 +713,13 @@ func TestLinstor_CapacityBytes(t *testing.T) {
 		{
 			StoragePoolName: "pool-a",
 			NodeName:        "node-1",
-			ProviderKind:    lapi.LVM_THIN,
+			ProviderKind:    lapi.LVM,
 			FreeCapacity:    1,
 		},
 		{
 			StoragePoolName: "pool-a",
 			NodeName:        "node-2",
-			ProviderKind:    lapi.LVM_THIN,
+			ProviderKind:    lapi.LVM,
 			FreeCapacity:    2,
 		},
 		{
@@ -314,63 +727,161 @@ func TestLinstor_CapacityBytes(t *testing.T) {
 			NodeName:        "node-1",
 			ProviderKind:    lapi.ZFS_THIN,
 			FreeCapacity:    3,
+			TotalCapacity:   100,
 		},
 		{
 			StoragePoolName: "pool-b",
 			NodeName:        "node-2",
 			ProviderKind:    lapi.ZFS_THIN,
 			FreeCapacity:    4,
+			TotalCapacity:   100,
+		},
+		{
+			StoragePoolName: "pool-c",
+			NodeName:        "node-1",
+			ProviderKind:    lapi.LVM_THIN,
+			FreeCapacity:    10,
+			TotalCapacity:   100,
+			Props:           map[string]string{lapiconsts.KeyStorPoolDfnMaxOversubscriptionRatio: "1.5"},
+		},
+		{
+			StoragePoolName: "pool-d",
+			NodeName:        "node-2",
+			ProviderKind:    lapi.FILE_THIN,
+			FreeCapacity:    1,
+			TotalCapacity:   100,
+		},
+		{
+			StoragePoolName: "pool-e",
+			NodeName:        "node-2",
+			ProviderKind:    lapi.LVM_THIN,
+			FreeCapacity:    100,
+			TotalCapacity:   100,
+		},
+		{
+			StoragePoolName: "DfltDisklessStorPool",
+			NodeName:        "node-1",
+			ProviderKind:    lapi.DISKLESS,
+			FreeCapacity:    1 << 40,
 		},
 	}, nil)
 
 	m.On("GetAll", mock.Anything, &lapi.ListOpts{Prop: []string{"Aux/topology.kubernetes.io/zone=zone-1"}}).Return([]lapi.Node{{Name: "node-1"}}, nil)
 	m.On("GetAll", mock.Anything, mock.Anything).Return([]lapi.Node{{Name: "node-1"}, {Name: "node-2"}}, nil)
 
-	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Nodes: &m}}, log: logrus.WithField("test", t.Name())}
+	spds := mocks.StoragePoolDefinitionProvider{}
+	spds.On("GetAll", mock.Anything).Return([]lapi.StoragePoolDefinition{
+		{StoragePoolName: "pool-b", Props: map[string]string{lapiconsts.KeyStorPoolDfnMaxOversubscriptionRatio: "2"}},
+	}, nil)
+
+	controller := mocks.ControllerProvider{}
+	controller.On("GetProps", mock.Anything).Return(lapi.ControllerProps{lapiconsts.KeyStorPoolDfnMaxOversubscriptionRatio: "3"}, nil)
+
+	// pool-e is barely used, but already provisioned almost up to its oversubscription limit.
+	res := mocks.ResourceProvider{}
+	res.On("GetResourceView", mock.Anything, opts).Return([]lapi.ResourceWithVolumes{
+		{
+			Resource: lapi.Resource{Name: "pvc-1", NodeName: "node-2"},
+			Volumes:  []lapi.Volume{{StoragePoolName: "pool-e", UsableSizeKib: 200}},
+		},
+		{
+			Resource: lapi.Resource{Name: "pvc-2", NodeName: "node-2"},
+			Volumes:  []lapi.Volume{{StoragePoolName: "pool-e", UsableSizeKib: 95}},
+		},
+		{
+			Resource: lapi.Resource{Name: "pvc-2", NodeName: "node-1"},
+			Volumes:  []lapi.Volume{{StoragePoolName: "pool-e", UsableSizeKib: 95}},
+		},
+	}, nil)
+
+	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Nodes: &m, Resources: &res, StoragePoolDefinitions: &spds, Controller: &controller}}, log: logrus.WithField("test", t.Name())}
 
+	// Capacity per node, with oversubscription applied:
+	// node-1: pool-a 1, pool-b 3*2, pool-c 10*1.5
+	// node-2: pool-a 2, pool-b 4*2, pool-d 1*3, pool-e min(100*3, 100*3-295)
 	testcases := []struct {
 		name             string
 		storagePool      string
+		placementCount   int32
 		topology         map[string]string
 		expectedCapacity int64
 	}{
 		{
 			name:             "all",
-			expectedCapacity: (1 + 2 + 3 + 4) * 1024,
+			placementCount:   1,
+			expectedCapacity: 15 * 1024,
+		},
+		{
+			name:             "all with default placement count",
+			expectedCapacity: 15 * 1024,
+		},
+		{
+			name:             "all with two replicas",
+			placementCount:   2,
+			expectedCapacity: 8 * 1024,
+		},
+		{
+			name:             "not enough nodes",
+			placementCount:   3,
+			expectedCapacity: 0,
 		},
 		{
-			name: "just node-1",
+			name:           "just node-1",
+			placementCount: 1,
 			topology: map[string]string{
 				topology.LinstorNodeKey: "node-1",
 			},
-			expectedCapacity: (1 + 3) * 1024,
+			expectedCapacity: 15 * 1024,
 		},
 		{
-			name: "just node-2",
+			name:           "just node-2",
+			placementCount: 1,
 			topology: map[string]string{
 				topology.LinstorNodeKey: "node-2",
 			},
-			expectedCapacity: (2 + 4) * 1024,
+			expectedCapacity: 8 * 1024,
 		},
 		{
 			name:             "just pool-a from params",
 			storagePool:      "pool-a",
-			expectedCapacity: (1 + 2) * 1024,
+			placementCount:   1,
+			expectedCapacity: 2 * 1024,
 		},
 		{
-			name:             "just pool-b from params",
+			name:             "just pool-a from params with two replicas",
+			storagePool:      "pool-a",
+			placementCount:   2,
+			expectedCapacity: 1 * 1024,
+		},
+		{
+			name:             "just pool-b from params with two replicas",
 			storagePool:      "pool-b",
-			expectedCapacity: (3 + 4) * 1024,
+			placementCount:   2,
+			expectedCapacity: 6 * 1024,
+		},
+		{
+			name:             "just pool-d from params uses controller ratio",
+			storagePool:      "pool-d",
+			placementCount:   1,
+			expectedCapacity: 3 * 1024,
+		},
+		{
+			name:             "just pool-e from params is limited by provisioned volumes",
+			storagePool:      "pool-e",
+			placementCount:   1,
+			expectedCapacity: 5 * 1024,
 		},
 		{
-			name: "just pool-a from topology",
+			name:           "just pool-a from topology",
+			placementCount: 1,
 			topology: map[string]string{
 				topology.LinstorStoragePoolKeyPrefix + "pool-a": topology.LinstorStoragePoolValue,
 			},
-			expectedCapacity: (1 + 2) * 1024,
+			expectedCapacity: 2 * 1024,
 		},
 		{
-			name: "just pool-a + node-1 from topology",
+			name:           "just pool-a + node-1 from topology",
+			placementCount: 1,
 			topology: map[string]string{
 				topology.LinstorStoragePoolKeyPrefix + "pool-a": topology.LinstorStoragePoolValue,
 				topology.LinstorNodeKey:                         "node-1",
@@ -378,18 +889,20 @@ func TestLinstor_CapacityBytes(t *testing.T) {
 			expectedCapacity: 1 * 1024,
 		},
 		{
-			name: "unknown node",
+			name:           "unknown node",
+			placementCount: 1,
 			topology: map[string]string{
 				topology.LinstorNodeKey: "node-unknown",
 			},
 			expectedCapacity: 0,
 		},
 		{
-			name: "aggregate topology",
+			name:           "aggregate topology",
+			placementCount: 1,
 			topology: map[string]string{
 				"topology.kubernetes.io/zone": "zone-1",
 			},
-			expectedCapacity: (1 + 3) * 1024,
+			expectedCapacity: 15 * 1024,
 		},
 	}
 
@@ -397,7 +910,7 @@ func TestLinstor_CapacityBytes(t *testing.T) {
 		testcase := &testcases[i]
 
 		t.Run(testcase.name, func(t *testing.T) {
-			cap, err := cl.CapacityBytes(context.Background(), testcase.storagePool, testcase.topology)
+			cap, err := cl.CapacityBytes(context.Background(), testcase.storagePool, testcase.placementCount, testcase.topology)
 			assert.NoError(t, err)
 			assert.Equal(t, testcase.expectedCapacity, cap)
 		})
@@ -460,3 +973,878 @@ func TestLinstor_SortByPreferred(t *testing.T) {
 		})
 	}
 }
+
+func TestLinstor_SnapCreateLinstorRemote(t *testing.T) {
+	t.Parallel()
+
+	params := &volume.SnapshotParameters{
+		Type:                     volume.SnapshotTypeLinstor,
+		RemoteName:               "dr-cluster",
+		LinstorTargetUrl:         "https://dr.example.com:3371",
+		LinstorTargetClusterID:   "9f6a1f42-4b8d-4b4e-8d2b-5d0c2f5f4e0a",
+		LinstorTargetStoragePool: "thinpool",
+	}
+
+	// LINSTOR picks the name of the snapshot it ships.
+	shippedSnap := lapi.Snapshot{
+		Name:              "back_20261017_120000",
+		ResourceName:      ExampleResourceID,
+		Props:             map[string]string{linstor.PropertyBackupTargetRemote: "dr-cluster"},
+		Flags:             []string{lapiconsts.FlagSuccessful, lapiconsts.FlagBackup, lapiconsts.FlagShipping},
+		VolumeDefinitions: []lapi.SnapshotVolumeDefinition{{VolumeNumber: 0, SizeKib: 1024}},
+		Snapshots:         []lapi.SnapshotNode{{SnapshotName: "back_20261017_120000", NodeName: "node-0", CreateTimestamp: &lapi.TimeStampMs{Time: time.Unix(200, 0)}}},
+	}
+
+	// Newer backups to other remotes, or of the backup schedule, are never mapped.
+	s3Snap := lapi.Snapshot{
+		Name:         "snap-s3",
+		ResourceName: ExampleResourceID,
+		Props:        map[string]string{linstor.PropertyBackupTargetRemote: "s3-remote"},
+		Flags:        []string{lapiconsts.FlagSuccessful, lapiconsts.FlagBackup, lapiconsts.FlagShipping},
+		Snapshots:    []lapi.SnapshotNode{{SnapshotName: "snap-s3", NodeName: "node-0", CreateTimestamp: &lapi.TimeStampMs{Time: time.Unix(300, 0)}}},
+	}
+
+	scheduledSnap := lapi.Snapshot{
+		Name:         linstor.ScheduledBackupPrefix + "20261017-120500",
+		ResourceName: ExampleResourceID,
+		Flags:        []string{lapiconsts.FlagSuccessful, lapiconsts.FlagBackup, lapiconsts.FlagShipping},
+		Snapshots:    []lapi.SnapshotNode{{SnapshotName: linstor.ScheduledBackupPrefix + "20261017-120500", NodeName: "node-0", CreateTimestamp: &lapi.TimeStampMs{Time: time.Unix(400, 0)}}},
+	}
+
+	olderSnap := lapi.Snapshot{
+		Name:              "back_20261016_120000",
+		ResourceName:      ExampleResourceID,
+		Flags:             []string{lapiconsts.FlagSuccessful, lapiconsts.FlagBackup, lapiconsts.FlagShipped},
+		VolumeDefinitions: []lapi.SnapshotVolumeDefinition{{VolumeNumber: 0, SizeKib: 1024}},
+		Snapshots:         []lapi.SnapshotNode{{SnapshotName: "back_20261016_120000", NodeName: "node-0", CreateTimestamp: &lapi.TimeStampMs{Time: time.Unix(100, 0)}}},
+	}
+
+	t.Run("new remote", func(t *testing.T) {
+		remotes := mocks.RemoteProvider{}
+		remotes.On("GetAllLinstor", mock.Anything).Return([]lapi.LinstorRemote{}, nil)
+		remotes.On("CreateLinstor", mock.Anything, lapi.LinstorRemote{
+			RemoteName: "dr-cluster",
+			Url:        "https://dr.example.com:3371",
+			ClusterId:  "9f6a1f42-4b8d-4b4e-8d2b-5d0c2f5f4e0a",
+		}).Return(nil)
+
+		backups := mocks.BackupProvider{}
+		backups.On("Ship", mock.Anything, "dr-cluster", lapi.BackupShipRequest{
+			SrcRscName:  ExampleResourceID,
+			DstRscName:  "snap-1",
+			DstStorPool: "thinpool",
+		}).Return(nil)
+
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, ExampleResourceID).Return(lapi.ResourceDefinition{
+			Name:  ExampleResourceID,
+			Props: map[string]string{linstor.PropertyShippedSnapshotPrefix + "snap-0": olderSnap.Name},
+		}, nil)
+		rds.On("Modify", mock.Anything, ExampleResourceID, lapi.GenericPropsModify{
+			OverrideProps: map[string]string{linstor.PropertyShippedSnapshotPrefix + "snap-1": shippedSnap.Name},
+		}).Return(nil)
+
+		resources := mocks.ResourceProvider{}
+		resources.On("GetSnapshots", mock.Anything, ExampleResourceID).Return([]lapi.Snapshot{olderSnap, shippedSnap, s3Snap, scheduledSnap}, nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Remote: &remotes, Backup: &backups, Resources: &resources, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		snap, err := cl.SnapCreate(context.Background(), "snap-1", ExampleResourceID, params)
+		assert.NoError(t, err)
+		assert.Equal(t, shippedSnap.Name, snap.GetSnapshotId())
+		assert.Equal(t, ExampleResourceID, snap.GetSourceVolumeId())
+		assert.False(t, snap.GetReadyToUse(), "not ready while shipping")
+		remotes.AssertExpectations(t)
+		backups.AssertExpectations(t)
+		resources.AssertExpectations(t)
+		rds.AssertExpectations(t)
+	})
+
+	t.Run("existing remote and snapshot", func(t *testing.T) {
+		remotes := mocks.RemoteProvider{}
+		remotes.On("GetAllLinstor", mock.Anything).Return([]lapi.LinstorRemote{{RemoteName: "dr-cluster"}}, nil)
+
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, ExampleResourceID).Return(lapi.ResourceDefinition{
+			Name:  ExampleResourceID,
+			Props: map[string]string{linstor.PropertyShippedSnapshotPrefix + "snap-1": olderSnap.Name},
+		}, nil)
+
+		resources := mocks.ResourceProvider{}
+		resources.On("GetSnapshot", mock.Anything, ExampleResourceID, olderSnap.Name).Return(olderSnap, nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Remote: &remotes, Backup: &mocks.BackupProvider{}, Resources: &resources, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		snap, err := cl.SnapCreate(context.Background(), "snap-1", ExampleResourceID, params)
+		assert.NoError(t, err)
+		assert.Equal(t, olderSnap.Name, snap.GetSnapshotId())
+		assert.True(t, snap.GetReadyToUse())
+		remotes.AssertExpectations(t)
+		resources.AssertExpectations(t)
+	})
+
+	t.Run("find by requested id", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("GetAll", mock.Anything, lapi.RDGetAllRequest{}).Return([]lapi.ResourceDefinitionWithVolumeDefinition{{
+			ResourceDefinition: lapi.ResourceDefinition{
+				Name:  ExampleResourceID,
+				Props: map[string]string{linstor.PropertyShippedSnapshotPrefix + "snap-1": olderSnap.Name},
+			},
+		}}, nil)
+
+		resources := mocks.ResourceProvider{}
+		resources.On("GetSnapshotView", mock.Anything).Return([]lapi.Snapshot{olderSnap, shippedSnap}, nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources, ResourceDefinitions: &rds}}, log: logrus.WithField("test", t.Name())}
+
+		snap, ok, err := cl.FindSnapByID(context.Background(), "snap-1")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, olderSnap.Name, snap.GetSnapshotId())
+	})
+
+	t.Run("missing remote without url", func(t *testing.T) {
+		remotes := mocks.RemoteProvider{}
+		remotes.On("GetAllLinstor", mock.Anything).Return([]lapi.LinstorRemote{}, nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Remote: &remotes}}, log: logrus.WithField("test", t.Name())}
+
+		_, err := cl.SnapCreate(context.Background(), "snap-1", ExampleResourceID, &volume.SnapshotParameters{Type: volume.SnapshotTypeLinstor, RemoteName: "dr-cluster"})
+		assert.Error(t, err)
+		remotes.AssertExpectations(t)
+	})
+}
+
+func TestLinstor_ReconcileScheduledBackups(t *testing.T) {
+	params := &volume.SnapshotParameters{
+		Type:                 volume.SnapshotTypeS3,
+		RemoteName:           "s3-remote",
+		AllowIncremental:     true,
+		BackupSchedule:       24 * time.Hour,
+		BackupRetentionCount: 1,
+	}
+
+	started := func(age time.Duration) *lapi.TimeStampMs {
+		return &lapi.TimeStampMs{Time: time.Now().Add(-age)}
+	}
+
+	rds := mocks.ResourceDefinitionProvider{}
+	rds.On("GetAll", mock.Anything, lapi.RDGetAllRequest{Props: []string{linstor.PropertyBackupClass + "=daily"}}).Return([]lapi.ResourceDefinitionWithVolumeDefinition{
+		{ResourceDefinition: lapi.ResourceDefinition{Name: "pvc-due", Props: map[string]string{linstor.PropertyBackupClass: "daily"}}},
+		{ResourceDefinition: lapi.ResourceDefinition{Name: "pvc-recent", Props: map[string]string{linstor.PropertyBackupClass: "daily"}}},
+		{ResourceDefinition: lapi.ResourceDefinition{Name: "pvc-deleting", Props: map[string]string{linstor.PropertyBackupClass: "daily"}, Flags: []string{lapiconsts.FlagDelete}}},
+	}, nil)
+
+	remotes := mocks.RemoteProvider{}
+	remotes.On("GetAllS3", mock.Anything).Return([]lapi.S3Remote{{RemoteName: "s3-remote"}}, nil)
+
+	backups := mocks.BackupProvider{}
+	backups.On("GetAll", mock.Anything, "s3-remote", "", "").Return(&lapi.BackupList{Linstor: map[string]lapi.Backup{
+		"due-1":     {Id: "due-1", OriginRsc: "pvc-due", OriginSnap: "scheduled-1", StartTimestamp: started(49 * time.Hour)},
+		"due-2":     {Id: "due-2", OriginRsc: "pvc-due", OriginSnap: "scheduled-2", StartTimestamp: started(25 * time.Hour), BasedOnId: "due-1"},
+		"recent-1":  {Id: "recent-1", OriginRsc: "pvc-recent", OriginSnap: "scheduled-1", StartTimestamp: started(49 * time.Hour)},
+		"recent-2":  {Id: "recent-2", OriginRsc: "pvc-recent", OriginSnap: "scheduled-2", StartTimestamp: started(time.Hour)},
+		"snapshot":  {Id: "snapshot", OriginRsc: "pvc-recent", OriginSnap: "snapshot-1234", StartTimestamp: started(72 * time.Hour)},
+		"other-rsc": {Id: "other-rsc", OriginRsc: "pvc-other", OriginSnap: "scheduled-1", StartTimestamp: started(72 * time.Hour)},
+	}}, nil)
+	backups.On("Create", mock.Anything, "s3-remote", mock.MatchedBy(func(req lapi.BackupCreate) bool {
+		// The chain of pvc-due already holds as many backups as retained, so a full backup starts a new chain.
+		return req.RscName == "pvc-due" && !req.Incremental && strings.HasPrefix(req.SnapName, linstor.ScheduledBackupPrefix)
+	})).Return("", nil)
+	backups.On("DeleteAll", mock.Anything, "s3-remote", lapi.BackupDeleteOpts{ID: "recent-1"}).Return(nil)
+
+	resources := mocks.ResourceProvider{}
+	resources.On("DeleteSnapshot", mock.Anything, "pvc-recent", "scheduled-1").Return(nil)
+
+	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds, Remote: &remotes, Backup: &backups, Resources: &resources}}, log: logrus.WithField("test", t.Name())}
+
+	created, deleted, err := cl.ReconcileScheduledBackups(context.Background(), "daily", params)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 1, deleted)
+	rds.AssertExpectations(t)
+	remotes.AssertExpectations(t)
+	backups.AssertExpectations(t)
+	resources.AssertExpectations(t)
+}
+
+func TestExpiredBackups(t *testing.T) {
+	now := time.Now()
+
+	backup := func(id string, age time.Duration, basedOn string) lapi.Backup {
+		return lapi.Backup{Id: id, StartTimestamp: &lapi.TimeStampMs{Time: now.Add(-age)}, BasedOnId: basedOn}
+	}
+
+	ids := func(backups []lapi.Backup) []string {
+		var result []string
+		for _, b := range backups {
+			result = append(result, b.Id)
+		}
+
+		return result
+	}
+
+	full := []lapi.Backup{backup("b1", 3*time.Hour, ""), backup("b3", time.Hour, ""), backup("b2", 2*time.Hour, "")}
+	chain := []lapi.Backup{backup("b1", 3*time.Hour, ""), backup("b2", 2*time.Hour, "b1"), backup("b3", time.Hour, "b2"), backup("b4", 0, "")}
+
+	assert.Empty(t, expiredBackups(full, 0, 0, now))
+	assert.Equal(t, []string{"b2", "b1"}, ids(expiredBackups(full, 1, 0, now)))
+	assert.Equal(t, []string{"b1"}, ids(expiredBackups(full, 0, 150*time.Minute, now)))
+	assert.Equal(t, []string{"b2", "b1"}, ids(expiredBackups(full, 3, 90*time.Minute, now)))
+	// The newest backup is kept even if it is too old.
+	assert.Equal(t, []string{"b2", "b1"}, ids(expiredBackups(full, 0, time.Minute, now)))
+	// Chains expire as a whole, once the newer chains hold enough backups.
+	assert.Empty(t, expiredBackups(chain, 2, 0, now))
+	assert.Equal(t, []string{"b3", "b2", "b1"}, ids(expiredBackups(chain, 1, 0, now)))
+
+	chains := []lapi.Backup{backup("b1", 4*time.Hour, ""), backup("b2", 3*time.Hour, "b1"), backup("b3", 2*time.Hour, ""), backup("b4", time.Hour, "b3")}
+	assert.Equal(t, []string{"b2", "b1"}, ids(expiredBackups(chains, 2, 0, now)))
+	assert.Empty(t, expiredBackups(chains, 3, 0, now))
+	assert.Equal(t, []string{"b2", "b1"}, ids(expiredBackups(chains, 0, 150*time.Minute, now)))
+}
+
+func TestChainExceedsRetention(t *testing.T) {
+	now := time.Now()
+
+	backup := func(id string, age time.Duration, basedOn string) lapi.Backup {
+		return lapi.Backup{Id: id, StartTimestamp: &lapi.TimeStampMs{Time: now.Add(-age)}, BasedOnId: basedOn}
+	}
+
+	chain := []lapi.Backup{backup("b1", 3*time.Hour, ""), backup("b2", 2*time.Hour, "b1"), backup("b3", time.Hour, "")}
+
+	assert.False(t, chainExceedsRetention(nil, 1, 0, now))
+	assert.False(t, chainExceedsRetention(chain, 0, 0, now))
+	// Only the chain of the latest backup counts.
+	assert.False(t, chainExceedsRetention(chain, 2, 0, now))
+	assert.True(t, chainExceedsRetention(chain, 1, 0, now))
+	assert.True(t, chainExceedsRetention(chain, 0, time.Hour, now))
+	assert.False(t, chainExceedsRetention(chain, 0, 2*time.Hour, now))
+
+	chain = append(chain, backup("b4", 0, "b3"))
+	assert.True(t, chainExceedsRetention(chain, 2, 0, now))
+	assert.False(t, chainExceedsRetention(chain, 3, 0, now))
+}
+
+type fakeMultiSnapshots struct {
+	created []lapi.Snapshot
+}
+
+func (f *fakeMultiSnapshots) CreateMultiple(_ context.Context, snapshots ...lapi.Snapshot) error {
+	f.created = append(f.created, snapshots...)
+	return nil
+}
+
+func TestLinstor_GroupSnapCreate(t *testing.T) {
+	memberA := groupMemberSnapshotId("group-1", "pvc-a")
+	memberB := groupMemberSnapshotId("group-1", "pvc-b")
+
+	successful := func(rsc, name string) lapi.Snapshot {
+		return lapi.Snapshot{
+			Name:              name,
+			ResourceName:      rsc,
+			Flags:             []string{lapiconsts.FlagSuccessful},
+			VolumeDefinitions: []lapi.SnapshotVolumeDefinition{{SizeKib: 1024}},
+			Snapshots:         []lapi.SnapshotNode{{CreateTimestamp: &lapi.TimeStampMs{Time: time.Unix(1000, 0)}}},
+		}
+	}
+
+	withMembers := func(snap lapi.Snapshot, members string) lapi.Snapshot {
+		snap.Props = map[string]string{linstor.PropertyGroupSnapshotMembers: members}
+		return snap
+	}
+
+	t.Run("new group", func(t *testing.T) {
+		resources := mocks.ResourceProvider{}
+		resources.On("GetSnapshotView", mock.Anything).Return([]lapi.Snapshot{successful("pvc-c", "other-snapshot")}, nil)
+		resources.On("GetSnapshot", mock.Anything, "pvc-a", memberA).Return(successful("pvc-a", memberA), nil)
+		resources.On("GetSnapshot", mock.Anything, "pvc-b", memberB).Return(successful("pvc-b", memberB), nil)
+
+		multi := &fakeMultiSnapshots{}
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources}, MultiSnapshots: multi}, log: logrus.WithField("test", t.Name())}
+
+		group, err := cl.GroupSnapCreate(context.Background(), "group-1", []string{"pvc-b", "pvc-a"}, &volume.SnapshotParameters{})
+		assert.NoError(t, err)
+		assert.Equal(t, []lapi.Snapshot{
+			{Name: memberB, ResourceName: "pvc-b", Props: map[string]string{linstor.PropertyGroupSnapshotMembers: "pvc-a,pvc-b"}},
+			{Name: memberA, ResourceName: "pvc-a", Props: map[string]string{linstor.PropertyGroupSnapshotMembers: "pvc-a,pvc-b"}},
+		}, multi.created)
+		assert.Equal(t, "group-1", group.GetGroupSnapshotId())
+		assert.True(t, group.GetReadyToUse())
+		assert.Len(t, group.GetSnapshots(), 2)
+		assert.Equal(t, memberB, group.GetSnapshots()[0].GetSnapshotId())
+		assert.Equal(t, "group-1", group.GetSnapshots()[0].GetGroupSnapshotId())
+		assert.Equal(t, int64(1024*1024), group.GetSnapshots()[1].GetSizeBytes())
+		resources.AssertExpectations(t)
+	})
+
+	t.Run("existing group", func(t *testing.T) {
+		resources := mocks.ResourceProvider{}
+		resources.On("GetSnapshotView", mock.Anything).Return([]lapi.Snapshot{
+			withMembers(successful("pvc-a", memberA), "pvc-a,pvc-b"),
+			withMembers(successful("pvc-b", memberB), "pvc-a,pvc-b"),
+		}, nil)
+		resources.On("GetSnapshot", mock.Anything, "pvc-a", memberA).Return(successful("pvc-a", memberA), nil)
+		resources.On("GetSnapshot", mock.Anything, "pvc-b", memberB).Return(successful("pvc-b", memberB), nil)
+
+		multi := &fakeMultiSnapshots{}
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources}, MultiSnapshots: multi}, log: logrus.WithField("test", t.Name())}
+
+		group, err := cl.GroupSnapCreate(context.Background(), "group-1", []string{"pvc-a", "pvc-b"}, &volume.SnapshotParameters{})
+		assert.NoError(t, err)
+		assert.Empty(t, multi.created)
+		assert.Len(t, group.GetSnapshots(), 2)
+	})
+
+	t.Run("incomplete group", func(t *testing.T) {
+		memberC := groupMemberSnapshotId("group-1", "pvc-c")
+
+		resources := mocks.ResourceProvider{}
+		resources.On("GetSnapshotView", mock.Anything).Return([]lapi.Snapshot{withMembers(successful("pvc-a", memberA), "pvc-a,pvc-c")}, nil)
+		resources.On("DeleteSnapshot", mock.Anything, "pvc-a", memberA).Return(nil).Once()
+		resources.On("GetSnapshot", mock.Anything, "pvc-a", memberA).Return(successful("pvc-a", memberA), nil)
+		resources.On("GetSnapshot", mock.Anything, "pvc-c", memberC).Return(successful("pvc-c", memberC), nil)
+
+		multi := &fakeMultiSnapshots{}
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources}, MultiSnapshots: multi}, log: logrus.WithField("test", t.Name())}
+
+		group, err := cl.GroupSnapCreate(context.Background(), "group-1", []string{"pvc-a", "pvc-c"}, &volume.SnapshotParameters{})
+		assert.NoError(t, err)
+		assert.Len(t, multi.created, 2)
+		assert.Len(t, group.GetSnapshots(), 2)
+		resources.AssertExpectations(t)
+	})
+
+	t.Run("group of other volumes", func(t *testing.T) {
+		testcases := []struct {
+			name     string
+			existing []lapi.Snapshot
+		}{
+			{
+				name:     "subset of requested volumes",
+				existing: []lapi.Snapshot{withMembers(successful("pvc-a", memberA), "pvc-a")},
+			},
+			{
+				name: "volume not requested",
+				existing: []lapi.Snapshot{
+					withMembers(successful("pvc-a", memberA), "pvc-a,pvc-b"),
+					withMembers(successful("pvc-b", memberB), "pvc-a,pvc-b"),
+				},
+			},
+			{
+				name:     "created without member list",
+				existing: []lapi.Snapshot{successful("pvc-a", memberA)},
+			},
+		}
+
+		for _, tcase := range testcases {
+			t.Run(tcase.name, func(t *testing.T) {
+				resources := mocks.ResourceProvider{}
+				resources.On("GetSnapshotView", mock.Anything).Return(tcase.existing, nil)
+
+				multi := &fakeMultiSnapshots{}
+
+				cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources}, MultiSnapshots: multi}, log: logrus.WithField("test", t.Name())}
+
+				_, err := cl.GroupSnapCreate(context.Background(), "group-1", []string{"pvc-a", "pvc-c"}, &volume.SnapshotParameters{})
+				assert.IsType(t, &GroupSnapshotMismatchError{}, err)
+				assert.Empty(t, multi.created)
+				resources.AssertNotCalled(t, "DeleteSnapshot", mock.Anything, mock.Anything, mock.Anything)
+			})
+		}
+	})
+
+	t.Run("get and delete", func(t *testing.T) {
+		resources := mocks.ResourceProvider{}
+		resources.On("GetSnapshotView", mock.Anything).Return([]lapi.Snapshot{
+			successful("pvc-a", memberA),
+			successful("pvc-b", memberB),
+			successful("pvc-c", "other-snapshot"),
+		}, nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources}}, log: logrus.WithField("test", t.Name())}
+
+		group, ok, err := cl.GroupSnapGet(context.Background(), "group-1", []string{memberA, memberB})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Len(t, group.GetSnapshots(), 2)
+
+		_, ok, err = cl.GroupSnapGet(context.Background(), "group-1", []string{memberA, "missing"})
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		_, _, err = cl.GroupSnapGet(context.Background(), "group-1", []string{"other-snapshot"})
+		assert.IsType(t, &GroupSnapshotMismatchError{}, err)
+	})
+}
+
+type fakeResourceGroupMover struct {
+	moved map[string]string
+}
+
+func (f *fakeResourceGroupMover) MoveToResourceGroup(_ context.Context, resName, resourceGroup string) error {
+	f.moved[resName] = resourceGroup
+	return nil
+}
+
+func TestLinstor_Modify(t *testing.T) {
+	diskful := func(node string, inUse bool) lapi.Resource {
+		return lapi.Resource{Name: "pvc-a", NodeName: node, State: lapi.ResourceState{InUse: inUse}}
+	}
+
+	t.Run("resource group and properties", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, "pvc-a").Return(lapi.ResourceDefinition{
+			Name:              "pvc-a",
+			ResourceGroupName: "rg-slow",
+			Props:             map[string]string{"DrbdOptions/auto-quorum": "suspend-io"},
+		}, nil)
+		rds.On("Modify", mock.Anything, "pvc-a", lapi.GenericPropsModify{
+			OverrideProps: map[string]string{"DrbdOptions/Net/max-buffers": "10000"},
+		}).Return(nil)
+
+		rgs := mocks.ResourceGroupProvider{}
+		rgs.On("Get", mock.Anything, "rg-fast").Return(lapi.ResourceGroup{Name: "rg-fast"}, nil)
+
+		mover := &fakeResourceGroupMover{moved: make(map[string]string)}
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds, ResourceGroups: &rgs}, ResourceGroupMover: mover}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Modify(context.Background(), "pvc-a", &volume.MutableParameters{
+			ResourceGroup: "rg-fast",
+			Properties: map[string]string{
+				"DrbdOptions/auto-quorum":     "suspend-io",
+				"DrbdOptions/Net/max-buffers": "10000",
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"pvc-a": "rg-fast"}, mover.moved)
+		rds.AssertExpectations(t)
+		rgs.AssertExpectations(t)
+	})
+
+	t.Run("missing resource group", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, "pvc-a").Return(lapi.ResourceDefinition{Name: "pvc-a", ResourceGroupName: "rg-slow"}, nil)
+
+		rgs := mocks.ResourceGroupProvider{}
+		rgs.On("Get", mock.Anything, "rg-missing").Return(lapi.ResourceGroup{}, lapi.NotFoundError)
+
+		mover := &fakeResourceGroupMover{moved: make(map[string]string)}
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds, ResourceGroups: &rgs}, ResourceGroupMover: mover}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Modify(context.Background(), "pvc-a", &volume.MutableParameters{ResourceGroup: "rg-missing"})
+		assert.ErrorIs(t, err, lapi.NotFoundError)
+		assert.Empty(t, mover.moved)
+	})
+
+	t.Run("add replicas", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, "pvc-a").Return(lapi.ResourceDefinition{Name: "pvc-a"}, nil)
+
+		resources := mocks.ResourceProvider{}
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			diskful("node-1", true),
+			{Name: "pvc-a", NodeName: "node-2", Flags: []string{lapiconsts.FlagDiskless}},
+		}, nil)
+		resources.On("Autoplace", mock.Anything, "pvc-a", lapi.AutoPlaceRequest{SelectFilter: lapi.AutoSelectFilter{PlaceCount: 3}}).Return(nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds, Resources: &resources}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Modify(context.Background(), "pvc-a", &volume.MutableParameters{PlacementCount: 3})
+		assert.NoError(t, err)
+		resources.AssertExpectations(t)
+	})
+
+	t.Run("remove replicas", func(t *testing.T) {
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, "pvc-a").Return(lapi.ResourceDefinition{Name: "pvc-a"}, nil)
+
+		resources := mocks.ResourceProvider{}
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			diskful("node-1", true),
+			diskful("node-2", false),
+			diskful("node-3", true),
+		}, nil)
+		resources.On("Delete", mock.Anything, "pvc-a", "node-2").Return(nil)
+		resources.On("Diskless", mock.Anything, "pvc-a", "node-3", "").Return(nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds, Resources: &resources}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.Modify(context.Background(), "pvc-a", &volume.MutableParameters{PlacementCount: 1})
+		assert.NoError(t, err)
+		resources.AssertExpectations(t)
+	})
+}
+
+func TestLinstor_NFSServer(t *testing.T) {
+	node := func(name, status string) lapi.Node {
+		return lapi.Node{
+			Name:             name,
+			ConnectionStatus: status,
+			NetInterfaces: []lapi.NetInterface{
+				{Name: "default", Address: "10.0.0.1"},
+				{Name: "data", Address: "10.0.1.1", IsActive: true},
+			},
+		}
+	}
+
+	testcases := []struct {
+		name           string
+		resources      []lapi.Resource
+		lastServer     string
+		lastOnline     bool
+		expectedServer string
+	}{
+		{
+			name:           "in use",
+			resources:      []lapi.Resource{{NodeName: "node-1"}, {NodeName: "node-2", State: lapi.ResourceState{InUse: true}}},
+			lastServer:     "node-1",
+			lastOnline:     true,
+			expectedServer: "node-2",
+		},
+		{
+			name:           "keep last server",
+			resources:      []lapi.Resource{{NodeName: "node-1"}, {NodeName: "node-2"}},
+			lastServer:     "node-1",
+			lastOnline:     true,
+			expectedServer: "node-1",
+		},
+		{
+			name:           "last server offline",
+			resources:      []lapi.Resource{{NodeName: "node-1"}, {NodeName: "node-2"}},
+			lastServer:     "node-1",
+			expectedServer: "node-3",
+		},
+		{
+			name:           "first server",
+			resources:      []lapi.Resource{{NodeName: "node-1"}, {NodeName: "node-2"}},
+			expectedServer: "node-3",
+		},
+	}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.name, func(t *testing.T) {
+			rds := mocks.ResourceDefinitionProvider{}
+			rds.On("Get", mock.Anything, "pvc-a").Return(lapi.ResourceDefinition{
+				Name:  "pvc-a",
+				Props: map[string]string{linstor.PropertyNFSServer: tcase.lastServer},
+			}, nil)
+
+			if tcase.expectedServer != tcase.lastServer {
+				rds.On("Modify", mock.Anything, "pvc-a", lapi.GenericPropsModify{
+					OverrideProps: map[string]string{linstor.PropertyNFSServer: tcase.expectedServer},
+				}).Return(nil)
+			}
+
+			resources := mocks.ResourceProvider{}
+			resources.On("GetAll", mock.Anything, "pvc-a").Return(tcase.resources, nil)
+
+			lastStatus := "OFFLINE"
+			if tcase.lastOnline {
+				lastStatus = "ONLINE"
+			}
+
+			nodes := mocks.NodeProvider{}
+			nodes.On("Get", mock.Anything, "node-1").Return(node("node-1", lastStatus), nil)
+			nodes.On("Get", mock.Anything, "node-2").Return(node("node-2", "ONLINE"), nil)
+			nodes.On("Get", mock.Anything, "node-3").Return(node("node-3", "ONLINE"), nil)
+
+			cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds, Resources: &resources, Nodes: &nodes}}, log: logrus.WithField("test", t.Name())}
+
+			server, address, err := cl.NFSServer(context.Background(), "pvc-a", "node-3")
+			assert.NoError(t, err)
+			assert.Equal(t, tcase.expectedServer, server)
+			assert.Equal(t, "10.0.1.1", address)
+			rds.AssertExpectations(t)
+		})
+	}
+}
+
+type fakeEncryptedVolumeDefinitions struct {
+	passphrases map[string]string
+}
+
+func (f *fakeEncryptedVolumeDefinitions) CreateEncryptedVolumeDefinition(_ context.Context, resName string, _ lapi.VolumeDefinitionCreate, passphrase string) error {
+	f.passphrases[resName] = passphrase
+	return nil
+}
+
+func TestLinstor_ReconcileVolumeDefinitionWithPassphrase(t *testing.T) {
+	rds := mocks.ResourceDefinitionProvider{}
+	rds.On("GetVolumeDefinition", mock.Anything, "pvc-a", 0).Return(lapi.VolumeDefinition{}, lapi.NotFoundError).Once()
+	rds.On("GetVolumeDefinition", mock.Anything, "pvc-a", 0).Return(lapi.VolumeDefinition{SizeKib: 1024}, nil).Once()
+
+	encrypted := &fakeEncryptedVolumeDefinitions{passphrases: make(map[string]string)}
+
+	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds}, EncryptedVolumeDefinitions: encrypted}, log: logrus.WithField("test", t.Name())}
+
+	_, err := cl.reconcileVolumeDefinition(context.Background(), &volume.Info{ID: "pvc-a", SizeBytes: 1024 * 1024}, "hunter2")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pvc-a": "hunter2"}, encrypted.passphrases)
+	rds.AssertNotCalled(t, "CreateVolumeDefinition", mock.Anything, mock.Anything, mock.Anything)
+
+	cl.client.EncryptedVolumeDefinitions = nil
+
+	rds.On("GetVolumeDefinition", mock.Anything, "pvc-b", 0).Return(lapi.VolumeDefinition{}, lapi.NotFoundError)
+
+	_, err = cl.reconcileVolumeDefinition(context.Background(), &volume.Info{ID: "pvc-b", SizeBytes: 1024 * 1024}, "hunter2")
+	assert.Error(t, err)
+}
+
+func TestLinstor_FindAssignmentOnNode(t *testing.T) {
+	resources := mocks.ResourceProvider{}
+	resources.On("GetVolume", mock.Anything, "pvc-a", "node-1", 0).Return(lapi.Volume{
+		DevicePath: "/dev/drbd1000",
+		LayerDataList: []lapi.VolumeLayer{
+			{Type: devicelayerkind.Drbd, Data: &lapi.DrbdVolume{DevicePath: "/dev/drbd1000"}},
+			{Type: devicelayerkind.Luks, Data: &lapi.LuksVolume{DevicePath: "/dev/mapper/pvc-a_00000", BackingDevice: "/dev/vg/pvc-a_00000"}},
+			{Type: devicelayerkind.Storage, Data: &lapi.StorageVolume{DevicePath: "/dev/vg/pvc-a_00000"}},
+		},
+	}, nil)
+	resources.On("GetVolume", mock.Anything, "pvc-a", "node-2", 0).Return(lapi.Volume{
+		DevicePath: "/dev/drbd1000",
+		LayerDataList: []lapi.VolumeLayer{
+			{Type: devicelayerkind.Drbd, Data: &lapi.DrbdVolume{DevicePath: "/dev/drbd1000"}},
+		},
+	}, nil)
+
+	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources}}, log: logrus.WithField("test", t.Name())}
+
+	diskful, err := cl.FindAssignmentOnNode(context.Background(), "pvc-a", "node-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &volume.Assignment{Node: "node-1", Path: "/dev/drbd1000", LuksBackingDevice: "/dev/vg/pvc-a_00000"}, diskful)
+
+	diskless, err := cl.FindAssignmentOnNode(context.Background(), "pvc-a", "node-2")
+	assert.NoError(t, err)
+	assert.Equal(t, &volume.Assignment{Node: "node-2", Path: "/dev/drbd1000"}, diskless)
+}
+
+func TestLinstor_MigrateReplicas(t *testing.T) {
+	replica := func(node string, props map[string]string, flags ...string) lapi.Resource {
+		return lapi.Resource{Name: "pvc-a", NodeName: node, Props: props, Flags: flags}
+	}
+	inPool := func(pool, state string) []lapi.Volume {
+		return []lapi.Volume{{StoragePoolName: pool, State: lapi.VolumeState{DiskState: state}}}
+	}
+
+	t.Run("evacuate node", func(t *testing.T) {
+		resources := mocks.ResourceProvider{}
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			replica("node-1", nil),
+			replica("node-2", nil),
+			replica("node-3", nil, lapiconsts.FlagDiskless, lapiconsts.FlagTieBreaker),
+		}, nil).Once()
+		// The autoplacer converted the tie-breaker on node-3.
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			replica("node-1", nil),
+			replica("node-2", nil),
+			replica("node-3", nil),
+		}, nil).Once()
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			replica("node-1", nil),
+			replica("node-2", nil),
+			replica("node-3", map[string]string{linstor.PropertyMigratedFrom: "node-2"}),
+		}, nil).Once()
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			replica("node-1", nil),
+			replica("node-3", nil),
+		}, nil).Once()
+		resources.On("GetVolumes", mock.Anything, "pvc-a", "node-1").Return(inPool("hdd", "UpToDate"), nil)
+		resources.On("GetVolumes", mock.Anything, "pvc-a", "node-2").Return(inPool("hdd", "UpToDate"), nil)
+		resources.On("GetVolumes", mock.Anything, "pvc-a", "node-3").Return(inPool("hdd", "Inconsistent"), nil).Once()
+		resources.On("GetVolumes", mock.Anything, "pvc-a", "node-3").Return(inPool("hdd", "UpToDate"), nil)
+		// Placement is left to LINSTOR, so the rules of the resource group apply. Only the evacuated node is excluded.
+		resources.On("Autoplace", mock.Anything, "pvc-a", lapi.AutoPlaceRequest{
+			SelectFilter: lapi.AutoSelectFilter{
+				AdditionalPlaceCount: 1,
+				NodeNameList:         []string{"node-1", "node-3", "node-4"},
+				StoragePool:          "hdd",
+			},
+		}).Return(nil)
+		resources.On("Modify", mock.Anything, "pvc-a", "node-3", lapi.GenericPropsModify{
+			OverrideProps: map[string]string{linstor.PropertyMigratedFrom: "node-2"},
+		}).Return(nil)
+		resources.On("Delete", mock.Anything, "pvc-a", "node-2").Return(nil)
+		resources.On("Modify", mock.Anything, "pvc-a", "node-3", lapi.GenericPropsModify{
+			DeleteProps: []string{linstor.PropertyMigratedFrom},
+		}).Return(nil)
+
+		nodes := mocks.NodeProvider{}
+		nodes.On("GetAll", mock.Anything).Return([]lapi.Node{{Name: "node-1"}, {Name: "node-2"}, {Name: "node-3"}, {Name: "node-4"}}, nil)
+
+		rds := mocks.ResourceDefinitionProvider{}
+		rds.On("Get", mock.Anything, "pvc-a").Return(lapi.ResourceDefinition{Name: "pvc-a"}, nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources, ResourceDefinitions: &rds, Nodes: &nodes}}, log: logrus.WithField("test", t.Name())}
+
+		params := &volume.MutableParameters{EvacuateNodes: []string{"node-2"}}
+
+		// The first call returns while the replacement is still syncing, the next call continues the migration.
+		err := cl.Modify(context.Background(), "pvc-a", params)
+		assert.IsType(t, &ResyncInProgressError{}, err)
+		resources.AssertNotCalled(t, "Delete", mock.Anything, "pvc-a", "node-2")
+
+		err = cl.Modify(context.Background(), "pvc-a", params)
+		assert.NoError(t, err)
+		resources.AssertExpectations(t)
+	})
+
+	t.Run("resume migration to storage pool", func(t *testing.T) {
+		resources := mocks.ResourceProvider{}
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			replica("node-1", nil),
+			replica("node-2", map[string]string{linstor.PropertyMigratedFrom: "node-1"}),
+		}, nil).Once()
+		resources.On("GetAll", mock.Anything, "pvc-a").Return([]lapi.Resource{
+			replica("node-2", nil),
+		}, nil).Once()
+		resources.On("GetVolumes", mock.Anything, "pvc-a", "node-1").Return(inPool("hdd", "UpToDate"), nil)
+		resources.On("GetVolumes", mock.Anything, "pvc-a", "node-2").Return(inPool("nvme", "UpToDate"), nil)
+		resources.On("Delete", mock.Anything, "pvc-a", "node-1").Return(nil)
+		resources.On("Modify", mock.Anything, "pvc-a", "node-2", lapi.GenericPropsModify{
+			DeleteProps: []string{linstor.PropertyMigratedFrom},
+		}).Return(nil)
+
+		cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{Resources: &resources}}, log: logrus.WithField("test", t.Name())}
+
+		err := cl.migrateReplicas(context.Background(), "pvc-a", &volume.MutableParameters{StoragePool: "nvme"})
+		assert.NoError(t, err)
+		resources.AssertExpectations(t)
+	})
+}
+
+func TestLinstor_NFSExport(t *testing.T) {
+	var calls []string
+
+	fakeCmd := func(out string) testingexec.FakeCommandAction {
+		return func(cmd string, args ...string) utilexec.Cmd {
+			calls = append(calls, strings.Join(append([]string{cmd}, args...), " "))
+
+			return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) { return []byte(out), nil, nil }},
+			}, cmd, args...)
+		}
+	}
+
+	nodes := mocks.NodeProvider{}
+	nodes.On("GetAll", mock.Anything).Return([]lapi.Node{
+		{Name: "node-1", NetInterfaces: []lapi.NetInterface{{Name: "default", Address: "10.0.0.1"}}},
+		{Name: "node-2", NetInterfaces: []lapi.NetInterface{{Name: "default", Address: "10.0.0.2"}, {Name: "v6", Address: "fd00::2"}}},
+	}, nil)
+
+	fakeExec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		fakeCmd(""),
+		fakeCmd(""),
+		fakeCmd(""),
+		fakeCmd("/srv/nfs/pvc-a  10.0.0.1(sync,wdelay,hide,root_squash)\n/srv/nfs/pvc-a  [fd00::2](sync,wdelay,hide,root_squash)\n/srv/nfs/pvc-b  10.0.0.1(sync,wdelay,hide,root_squash)\n"),
+		fakeCmd(""),
+		fakeCmd(""),
+	}}
+
+	cl := Linstor{
+		client:  &lc.HighLevelClient{Client: &lapi.Client{Nodes: &nodes}},
+		log:     logrus.WithField("test", t.Name()),
+		mounter: &mount.SafeFormatAndMount{Exec: fakeExec},
+	}
+
+	err := cl.Export(context.Background(), "/srv/nfs/pvc-a")
+	assert.NoError(t, err)
+
+	opts := "rw,sync,no_subtree_check,root_squash,fsid=" + uuid.NewSHA1([]byte("linstor.csi.linbit.com"), []byte("/srv/nfs/pvc-a")).String()
+	assert.Equal(t, []string{
+		"exportfs -o " + opts + " 10.0.0.1:/srv/nfs/pvc-a",
+		"exportfs -o " + opts + " 10.0.0.2:/srv/nfs/pvc-a",
+		"exportfs -o " + opts + " [fd00::2]:/srv/nfs/pvc-a",
+	}, calls)
+
+	calls = nil
+
+	err = cl.Unexport(context.Background(), "/srv/nfs/pvc-a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"exportfs -s",
+		"exportfs -u 10.0.0.1:/srv/nfs/pvc-a",
+		"exportfs -u [fd00::2]:/srv/nfs/pvc-a",
+	}, calls)
+
+	_, err = NewLinstor(NFSClients([]string{"10.0.0.0/24", "10.0.0.1"}))
+	assert.Error(t, err)
+}
+
+func TestLinstor_NFSFloatingAddress(t *testing.T) {
+	rds := mocks.ResourceDefinitionProvider{}
+	rds.On("GetAll", mock.Anything, mock.Anything).Return([]lapi.ResourceDefinitionWithVolumeDefinition{
+		{ResourceDefinition: lapi.ResourceDefinition{Name: "pvc-a", Props: map[string]string{linstor.PropertyNFSAddress: "10.0.1.1"}}},
+		{ResourceDefinition: lapi.ResourceDefinition{Name: "pvc-b", Props: map[string]string{linstor.PropertyNFSAddress: "10.0.1.2"}}},
+		{ResourceDefinition: lapi.ResourceDefinition{Name: "pvc-c"}},
+	}, nil)
+
+	var calls []string
+
+	fakeCmd := func(cmd string, args ...string) utilexec.Cmd {
+		calls = append(calls, strings.Join(append([]string{cmd}, args...), " "))
+
+		return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) { return nil, nil, nil }},
+		}, cmd, args...)
+	}
+
+	cl, err := NewLinstor(NFSFloatingAddresses("10.0.1.0/30"), NFSFloatingAddressInterface("eth0"))
+	assert.NoError(t, err)
+
+	cl.client = &lc.HighLevelClient{Client: &lapi.Client{ResourceDefinitions: &rds}}
+	cl.mounter = &mount.SafeFormatAndMount{Exec: &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{fakeCmd, fakeCmd}}}
+
+	// 10.0.1.3 is the broadcast address of the network.
+	_, err = cl.allocateNFSAddress(context.Background())
+	assert.Error(t, err)
+
+	cl.nfsAddresses.Mask = net.CIDRMask(29, 32)
+
+	addr, err := cl.allocateNFSAddress(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.1.3", addr)
+
+	err = cl.AddFloatingAddress(context.Background(), addr)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"ip addr add 10.0.1.3/32 dev eth0",
+		"arping -U -c 3 -I eth0 10.0.1.3",
+	}, calls)
+
+	_, err = NewLinstor(NFSFloatingAddresses("10.0.1.1"))
+	assert.Error(t, err)
+}
+
+func TestLinstor_ResourceGroupParameters(t *testing.T) {
+	rg := lapi.ResourceGroup{
+		Name:  "ephemeral",
+		Props: map[string]string{lapiconsts.KeyStorPoolName: "thin"},
+		SelectFilter: lapi.AutoSelectFilter{
+			PlaceCount:          2,
+			StoragePool:         "thin",
+			ReplicasOnDifferent: []string{"topology.kubernetes.io/zone"},
+			LayerStack:          []string{"DRBD", "STORAGE"},
+		},
+	}
+
+	rgs := mocks.ResourceGroupProvider{}
+	rgs.On("Get", mock.Anything, "ephemeral").Return(rg, nil)
+
+	cl := Linstor{client: &lc.HighLevelClient{Client: &lapi.Client{ResourceGroups: &rgs}}, log: logrus.WithField("test", t.Name())}
+
+	params, err := cl.ResourceGroupParameters(context.Background(), "ephemeral")
+	assert.NoError(t, err)
+	assert.Equal(t, "ephemeral", params.ResourceGroup)
+	assert.Equal(t, int32(2), params.PlacementCount)
+	assert.Equal(t, "thin", params.StoragePool)
+
+	// Creating a volume with the parameters leaves the resource group as is.
+	_, changed, err := params.ToResourceGroupModify(&rg)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/sirupsen/logrus"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/util"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/slice"
+	"github.com/piraeusdatastore/linstor-csi/pkg/tracing"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+// migrateReplicas moves diskful replicas to the requested storage pool and away from evacuated nodes, one replica at
+// a time. A replacement replica is added on another node first. Only once it is UpToDate, the old replica is removed,
+// so the number of up-to-date replicas never drops.
+//
+// The replacement is marked with the node it replaces, so an interrupted migration continues with the same
+// replacement when called again. Instead of blocking until the replacement finished its resync, a
+// ResyncInProgressError is returned, so the caller can retry later.
+func (s *Linstor) migrateReplicas(ctx context.Context, volId string, params *volume.MutableParameters) (err error) {
+	ctx, span := tracing.Start(ctx, "migrateReplicas")
+	defer func() { tracing.End(span, err) }()
+
+	log := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		"storagePool":       params.StoragePool,
+		"evacuateNodes":     params.EvacuateNodes,
+	})
+
+	for {
+		ress, err := s.client.Resources.GetAll(ctx, volId)
+		if err != nil {
+			return fmt.Errorf("failed to list resources: %w", err)
+		}
+
+		old, oldPool, err := s.nextReplicaToMigrate(ctx, volId, ress, params)
+		if err != nil {
+			return err
+		}
+
+		if old == nil {
+			return nil
+		}
+
+		log := log.WithField("replacedNode", old.NodeName)
+
+		targetPool := params.StoragePool
+		if targetPool == "" {
+			targetPool = oldPool
+		}
+
+		replacement := replacementFor(ress, old.NodeName)
+		if replacement == "" {
+			replacement, err = s.addReplacementReplica(ctx, volId, old.NodeName, targetPool, ress, params.EvacuateNodes)
+			if err != nil {
+				return err
+			}
+		}
+
+		log = log.WithField(logging.FieldNode, replacement)
+
+		ok, err := s.upToDate(ctx, volId, replacement)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			log.Info("replacement replica is not UpToDate yet")
+
+			return &ResyncInProgressError{Name: volId, Node: replacement}
+		}
+
+		if old.State.InUse {
+			// Keep the volume attached on the node using it, the data is then read from the other replicas.
+			err = s.client.Resources.Diskless(ctx, volId, old.NodeName, "")
+		} else {
+			err = s.client.Resources.Delete(ctx, volId, old.NodeName)
+		}
+
+		if nil404(err) != nil {
+			return fmt.Errorf("failed to remove replica on %s: %w", old.NodeName, err)
+		}
+
+		err = s.client.Resources.Modify(ctx, volId, replacement, lapi.GenericPropsModify{DeleteProps: []string{linstor.PropertyMigratedFrom}})
+		if err != nil {
+			return fmt.Errorf("failed to clear migration marker on %s: %w", replacement, err)
+		}
+
+		log.Info("migrated replica")
+	}
+}
+
+// nextReplicaToMigrate returns a diskful replica that is on an evacuated node or in the wrong storage pool, together
+// with its current storage pool. It returns nil if all replicas are in place.
+func (s *Linstor) nextReplicaToMigrate(ctx context.Context, volId string, ress []lapi.Resource, params *volume.MutableParameters) (*lapi.Resource, string, error) {
+	for i := range ress {
+		if !util.DeployedDiskfully(ress[i]) {
+			continue
+		}
+
+		vols, err := s.client.Resources.GetVolumes(ctx, volId, ress[i].NodeName)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get volumes on %s: %w", ress[i].NodeName, err)
+		}
+
+		if len(vols) == 0 {
+			continue
+		}
+
+		pool := vols[0].StoragePoolName
+
+		if slice.ContainsString(params.EvacuateNodes, ress[i].NodeName) || (params.StoragePool != "" && params.StoragePool != pool) {
+			return &ress[i], pool, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// replacementFor returns the node of the replica added to replace the replica on the given node, if any.
+func replacementFor(ress []lapi.Resource, node string) string {
+	for _, res := range ress {
+		if res.Props[linstor.PropertyMigratedFrom] == node {
+			return res.NodeName
+		}
+	}
+
+	return ""
+}
+
+// addReplacementReplica adds a diskful replica in the storage pool using the autoplacer of LINSTOR, so the placement
+// rules of the resource group, such as ReplicasOnDifferent, still apply. Evacuated nodes and the node of the replaced
+// replica are not considered. Existing diskless resources may be converted to diskful ones.
+func (s *Linstor) addReplacementReplica(ctx context.Context, volId, oldNode, pool string, ress []lapi.Resource, evacuate []string) (string, error) {
+	nodes, err := s.client.Nodes.GetAll(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var candidates []string
+
+	for _, node := range nodes {
+		if node.Name != oldNode && !slice.ContainsString(evacuate, node.Name) {
+			candidates = append(candidates, node.Name)
+		}
+	}
+
+	diskful := make(map[string]bool, len(ress))
+	for _, res := range ress {
+		diskful[res.NodeName] = util.DeployedDiskfully(res)
+	}
+
+	log := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		"storagePool":       pool,
+		"replacedNode":      oldNode,
+	})
+
+	log.Info("adding replacement replica")
+
+	err = s.client.Resources.Autoplace(ctx, volId, lapi.AutoPlaceRequest{
+		SelectFilter: lapi.AutoSelectFilter{
+			AdditionalPlaceCount: 1,
+			NodeNameList:         candidates,
+			StoragePool:          pool,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to add replica in storage pool %s: %w", pool, err)
+	}
+
+	ress, err = s.client.Resources.GetAll(ctx, volId)
+	if err != nil {
+		return "", fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	for _, res := range ress {
+		if diskful[res.NodeName] || !util.DeployedDiskfully(res) {
+			continue
+		}
+
+		log.WithField(logging.FieldNode, res.NodeName).Info("added replacement replica")
+
+		err = s.client.Resources.Modify(ctx, volId, res.NodeName, lapi.GenericPropsModify{
+			OverrideProps: map[string]string{linstor.PropertyMigratedFrom: oldNode},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to mark replica on %s: %w", res.NodeName, err)
+		}
+
+		return res.NodeName, nil
+	}
+
+	return "", fmt.Errorf("no replica added in storage pool %s", pool)
+}
+
+// upToDate returns true if all volumes of the resource on the node are UpToDate.
+func (s *Linstor) upToDate(ctx context.Context, volId, node string) (bool, error) {
+	vols, err := s.client.Resources.GetVolumes(ctx, volId, node)
+	if err != nil {
+		return false, fmt.Errorf("failed to get volumes on %s: %w", node, err)
+	}
+
+	upToDate := len(vols) > 0
+	for _, vol := range vols {
+		upToDate = upToDate && vol.State.DiskState == "UpToDate"
+	}
+
+	return upToDate, nil
+}
@@ -22,12 +22,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
@@ -35,6 +37,11 @@ type MockStorage struct {
 	createdVolumes  []*volume.Info
 	assignedVolumes map[string][]volume.Assignment
 	snapshots       []*csi.Snapshot
+	nfsServers      map[string]string
+	nfsExports      map[string]struct{}
+	nfsClients      map[string]map[string]struct{}
+	nfsAddresses    map[string]struct{}
+	mounts          map[string]struct{}
 }
 
 func NewMockStorage() *MockStorage {
@@ -42,6 +49,11 @@ func NewMockStorage() *MockStorage {
 		createdVolumes:  nil,
 		assignedVolumes: make(map[string][]volume.Assignment),
 		snapshots:       nil,
+		nfsServers:      make(map[string]string),
+		nfsExports:      make(map[string]struct{}),
+		nfsClients:      make(map[string]map[string]struct{}),
+		nfsAddresses:    make(map[string]struct{}),
+		mounts:          make(map[string]struct{}),
 	}
 }
 
@@ -98,6 +110,38 @@ func (s *MockStorage) GetLegacyVolumeParameters(ctx context.Context, volId strin
 	return nil, nil
 }
 
+func (s *MockStorage) ResourceGroupParameters(ctx context.Context, rg string) (*volume.Parameters, error) {
+	params, err := volume.NewParameters(map[string]string{linstor.ParameterNamespace + "/resourceGroup": rg})
+	if err != nil {
+		return nil, err
+	}
+
+	return &params, nil
+}
+
+func (s *MockStorage) Adopt(ctx context.Context, vol *volume.Info, rawParams map[string]string) error {
+	existing, _ := s.FindByID(ctx, vol.ID)
+	if existing == nil {
+		return fmt.Errorf("volume %s not found", vol.ID)
+	}
+
+	if existing.FsType == "" {
+		existing.FsType = vol.FsType
+	}
+
+	if existing.Properties == nil {
+		existing.Properties = make(map[string]string)
+	}
+
+	for k, v := range vol.Properties {
+		if _, ok := existing.Properties[k]; !ok {
+			existing.Properties[k] = v
+		}
+	}
+
+	return nil
+}
+
 func (s *MockStorage) CompatibleSnapshotId(name string) string {
 	return name
 }
@@ -142,6 +186,69 @@ func (s *MockStorage) SnapDelete(ctx context.Context, snap *csi.Snapshot) error
 	return nil
 }
 
+func (s *MockStorage) CompatibleGroupSnapshotId(name string) string {
+	return name
+}
+
+func (s *MockStorage) GroupSnapCreate(ctx context.Context, id string, sourceVolIds []string, params *volume.SnapshotParameters) (*csi.VolumeGroupSnapshot, error) {
+	group := &csi.VolumeGroupSnapshot{GroupSnapshotId: id, CreationTime: timestamppb.Now(), ReadyToUse: true}
+
+	for _, vol := range sourceVolIds {
+		snapId := id + "-" + vol
+
+		snap, _, _ := s.FindSnapByID(ctx, snapId)
+		if snap == nil {
+			var err error
+
+			snap, err = s.SnapCreate(ctx, snapId, vol, params)
+			if err != nil {
+				return nil, err
+			}
+
+			snap.GroupSnapshotId = id
+		}
+
+		group.Snapshots = append(group.Snapshots, snap)
+	}
+
+	return group, nil
+}
+
+func (s *MockStorage) GroupSnapGet(ctx context.Context, id string, snapshotIds []string) (*csi.VolumeGroupSnapshot, bool, error) {
+	if len(snapshotIds) == 0 {
+		return nil, false, nil
+	}
+
+	group := &csi.VolumeGroupSnapshot{GroupSnapshotId: id, ReadyToUse: true}
+
+	for _, snapId := range snapshotIds {
+		snap, _, _ := s.FindSnapByID(ctx, snapId)
+		if snap == nil {
+			return nil, false, nil
+		}
+
+		if snap.GroupSnapshotId != id {
+			return nil, false, fmt.Errorf("snapshot '%s' is not part of group snapshot '%s'", snapId, id)
+		}
+
+		group.Snapshots = append(group.Snapshots, snap)
+		group.CreationTime = snap.CreationTime
+	}
+
+	return group, true, nil
+}
+
+func (s *MockStorage) GroupSnapDelete(ctx context.Context, id string, snapshotIds []string) error {
+	for _, snapId := range snapshotIds {
+		err := s.SnapDelete(ctx, &csi.Snapshot{SnapshotId: snapId})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *MockStorage) ListSnaps(ctx context.Context, start, limit int) ([]*csi.Snapshot, error) {
 	if limit == 0 {
 		limit = len(s.snapshots) - start
@@ -189,12 +296,12 @@ func (s *MockStorage) VolFromSnap(ctx context.Context, snap *csi.Snapshot, vol *
 	return nil
 }
 
-func (s *MockStorage) VolFromVol(ctx context.Context, sourceVol, vol *volume.Info) error {
+func (s *MockStorage) VolFromVol(ctx context.Context, sourceVol, vol *volume.Info, params *volume.Parameters, topologies *csi.TopologyRequirement) error {
 	s.createdVolumes = append(s.createdVolumes, vol)
 	return nil
 }
 
-func (s *MockStorage) Attach(ctx context.Context, volId, node string, readOnly bool) error {
+func (s *MockStorage) Attach(ctx context.Context, volId, node string, readOnly, multiWriter bool) error {
 	s.assignedVolumes[volId] = append(s.assignedVolumes[volId], volume.Assignment{Node: node, Path: "/dev/" + volId, ReadOnly: &readOnly})
 	return nil
 }
@@ -227,39 +334,164 @@ func (s *MockStorage) FindAssignmentOnNode(ctx context.Context, volId, node stri
 	return nil, nil
 }
 
-func (s *MockStorage) CapacityBytes(ctx context.Context, sp string, segments map[string]string) (int64, error) {
+func (s *MockStorage) Status(ctx context.Context, volId string) ([]string, *csi.VolumeCondition, error) {
+	var nodes []string
+	for _, a := range s.assignedVolumes[volId] {
+		nodes = append(nodes, a.Node)
+	}
+
+	return nodes, &csi.VolumeCondition{Abnormal: false, Message: "mock volume is healthy"}, nil
+}
+
+func (s *MockStorage) CapacityBytes(ctx context.Context, sp string, placementCount int32, segments map[string]string) (int64, error) {
 	return 50000000, nil
 }
 
 func (s *MockStorage) Mount(ctx context.Context, source, target, fsType string, readonly bool, mntOpts []string) error {
-	if _, err := os.Stat(target); os.IsNotExist(err) {
-		return os.MkdirAll(target, 0755)
+	return s.mount(target)
+}
+
+func (s *MockStorage) BindMount(ctx context.Context, source, target string, block, readonly bool) error {
+	return s.mount(target)
+}
+
+func (s *MockStorage) MountNFS(ctx context.Context, server, exportPath, target string, readonly bool, mntOpts []string) error {
+	return s.mount(target)
+}
+
+func (s *MockStorage) NFSServer(ctx context.Context, volId, preferredNode string) (string, string, error) {
+	server, ok := s.nfsServers[volId]
+	if !ok {
+		server = preferredNode
+		s.nfsServers[volId] = server
 	}
 
+	return server, server + ".example.com", nil
+}
+
+func (s *MockStorage) AddNFSClient(ctx context.Context, volId, node string) error {
+	if s.nfsClients[volId] == nil {
+		s.nfsClients[volId] = make(map[string]struct{})
+	}
+
+	s.nfsClients[volId][node] = struct{}{}
+
 	return nil
 }
 
-func (s *MockStorage) IsNotMountPoint(target string) (bool, error) {
-	_, err := os.Stat(target)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return true, nil
+func (s *MockStorage) RemoveNFSClient(ctx context.Context, volId, node string) error {
+	delete(s.nfsClients[volId], node)
+	return nil
+}
+
+func (s *MockStorage) NFSVolume(ctx context.Context, volId string) (*volume.NFSVolume, error) {
+	if _, ok := s.nfsServers[volId]; !ok {
+		return nil, nil
+	}
+
+	return s.nfsVolume(volId), nil
+}
+
+func (s *MockStorage) NFSVolumes(ctx context.Context) ([]volume.NFSVolume, error) {
+	var result []volume.NFSVolume
+
+	for volId := range s.nfsServers {
+		result = append(result, *s.nfsVolume(volId))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+// nfsVolume returns the NFS state of the volume. The server is considered to use the volume while it is exported.
+func (s *MockStorage) nfsVolume(volId string) *volume.NFSVolume {
+	vol := &volume.NFSVolume{ID: volId, FsType: "ext4", Server: s.nfsServers[volId]}
+
+	for node := range s.nfsClients[volId] {
+		vol.Clients = append(vol.Clients, node)
+	}
+
+	sort.Strings(vol.Clients)
+
+	for path := range s.nfsExports {
+		if filepath.Base(path) == volId {
+			vol.ServerInUse = true
+		}
+	}
+
+	return vol
+}
+
+func (s *MockStorage) ClaimNFSServer(ctx context.Context, volId, node string) (bool, error) {
+	current := s.nfsServers[volId]
+	if current != node && current != "" && s.NodeAvailable(ctx, current) == nil {
+		return false, nil
+	}
+
+	s.nfsServers[volId] = node
+
+	return true, nil
+}
+
+func (s *MockStorage) AddFloatingAddress(ctx context.Context, address string) error {
+	s.nfsAddresses[address] = struct{}{}
+	return nil
+}
+
+func (s *MockStorage) RemoveFloatingAddress(ctx context.Context, address string) error {
+	delete(s.nfsAddresses, address)
+	return nil
+}
+
+func (s *MockStorage) Export(ctx context.Context, path string) error {
+	s.nfsExports[path] = struct{}{}
+	return nil
+}
+
+func (s *MockStorage) Unexport(ctx context.Context, path string) error {
+	delete(s.nfsExports, path)
+	return nil
+}
+
+func (s *MockStorage) CheckLuksPassphrase(ctx context.Context, device, passphrase string) error {
+	return nil
+}
+
+// mount records the target as mount point, creating it if needed.
+func (s *MockStorage) mount(target string) error {
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		err := os.MkdirAll(target, 0755)
+		if err != nil {
+			return err
 		}
-		return false, err
 	}
-	return false, nil
+
+	s.mounts[target] = struct{}{}
+
+	return nil
+}
+
+func (s *MockStorage) IsNotMountPoint(target string) (bool, error) {
+	_, ok := s.mounts[target]
+	return !ok, nil
 }
 
+// Unmount behaves like mount.CleanupMountPoint: paths that are not mount points are removed, if they exist.
 func (s *MockStorage) Unmount(target string) error {
-	notMounted, err := s.IsNotMountPoint(target)
-	if err != nil {
-		return err
+	if _, ok := s.mounts[target]; ok {
+		delete(s.mounts, target)
+		return os.RemoveAll(target)
 	}
-	if notMounted {
-		return nil
+
+	err := os.Remove(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
 
-	return os.RemoveAll(target)
+	return nil
 }
 
 func (s *MockStorage) GetVolumeStats(path string) (volume.VolumeStats, error) {
@@ -279,6 +511,30 @@ func (s *MockStorage) ControllerExpand(ctx context.Context, vol *volume.Info) er
 	return nil
 }
 
+func (s *MockStorage) Modify(ctx context.Context, volId string, params *volume.MutableParameters) error {
+	for _, vol := range s.createdVolumes {
+		if vol.ID != volId {
+			continue
+		}
+
+		if params.ResourceGroup != "" {
+			vol.ResourceGroup = params.ResourceGroup
+		}
+
+		for k, v := range params.Properties {
+			if vol.Properties == nil {
+				vol.Properties = make(map[string]string)
+			}
+
+			vol.Properties[k] = v
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("volume %s does not exist", volId)
+}
+
 func (s *MockStorage) GetNodeTopologies(_ context.Context, node string) (*csi.Topology, error) {
 	return &csi.Topology{
 		Segments: map[string]string{
@@ -337,3 +337,24 @@ func (_m *ResourceDefinitionProvider) ModifyVolumeDefinition(ctx context.Context
 
 	return r0
 }
+
+// SyncStatus provides a mock function with given fields: ctx, resDef
+func (_m *ResourceDefinitionProvider) SyncStatus(ctx context.Context, resDef string) (client.ResourceDefinitionSyncStatus, error) {
+	ret := _m.Called(ctx, resDef)
+
+	var r0 client.ResourceDefinitionSyncStatus
+	if rf, ok := ret.Get(0).(func(context.Context, string) client.ResourceDefinitionSyncStatus); ok {
+		r0 = rf(ctx, resDef)
+	} else {
+		r0 = ret.Get(0).(client.ResourceDefinitionSyncStatus)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, resDef)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
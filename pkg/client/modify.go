@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/sirupsen/logrus"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/util"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/tracing"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+var _ volume.Modifier = &Linstor{}
+
+// Modify applies the mutable parameters to an existing volume.
+//
+// The resource group is changed first, so replicas added for a new placement count already use the placement rules
+// of the new resource group. Generated resource groups left without volumes are removed by the reconciler. Replicas
+// are migrated to a new storage pool or away from evacuated nodes before the placement count is applied.
+func (s *Linstor) Modify(ctx context.Context, volId string, params *volume.MutableParameters) error {
+	log := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		"params":            params,
+	})
+	log.Info("modify volume")
+
+	rd, err := s.client.ResourceDefinitions.Get(ctx, volId)
+	if err != nil {
+		return fmt.Errorf("failed to get resource definition: %w", err)
+	}
+
+	if params.ResourceGroup != "" && params.ResourceGroup != rd.ResourceGroupName {
+		err := s.moveToResourceGroup(ctx, volId, params.ResourceGroup)
+		if err != nil {
+			return err
+		}
+
+		log.WithField("resourceGroup", params.ResourceGroup).Info("moved volume to resource group")
+	}
+
+	props := make(map[string]string)
+
+	for k, v := range params.Properties {
+		if existing, ok := rd.Props[k]; !ok || existing != v {
+			props[k] = v
+		}
+	}
+
+	if len(props) > 0 {
+		err := s.client.ResourceDefinitions.Modify(ctx, volId, lapi.GenericPropsModify{OverrideProps: props})
+		if err != nil {
+			return fmt.Errorf("failed to set properties on resource definition: %w", err)
+		}
+	}
+
+	if params.NeedsMigration() {
+		err := s.migrateReplicas(ctx, volId, params)
+		if err != nil {
+			return err
+		}
+	}
+
+	if params.PlacementCount > 0 {
+		err := s.reconcileReplicaCount(ctx, volId, params.PlacementCount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Linstor) moveToResourceGroup(ctx context.Context, volId, rgName string) error {
+	if s.client.ResourceGroupMover == nil {
+		return errors.New("changing the resource group is not supported by this client")
+	}
+
+	_, err := s.client.ResourceGroups.Get(ctx, rgName)
+	if err != nil {
+		return fmt.Errorf("failed to get resource group %s: %w", rgName, err)
+	}
+
+	err = s.client.ResourceGroupMover.MoveToResourceGroup(ctx, volId, rgName)
+	if err != nil {
+		return fmt.Errorf("failed to move volume to resource group %s: %w", rgName, err)
+	}
+
+	return nil
+}
+
+// reconcileReplicaCount adds or removes diskful replicas until the volume has the given number of replicas. New
+// replicas are placed according to the resource group of the volume. Replicas on nodes not using the volume are
+// removed first. Replicas on nodes using the volume are converted to diskless, so the volume stays available there.
+func (s *Linstor) reconcileReplicaCount(ctx context.Context, volId string, count int32) (err error) {
+	ctx, span := tracing.Start(ctx, "reconcileReplicaCount")
+	defer func() { tracing.End(span, err) }()
+
+	log := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		"placementCount":    count,
+	})
+
+	ress, err := s.client.Resources.GetAll(ctx, volId)
+	if err != nil {
+		return fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	var diskful []lapi.Resource
+
+	for i := range ress {
+		if util.DeployedDiskfully(ress[i]) {
+			diskful = append(diskful, ress[i])
+		}
+	}
+
+	switch {
+	case int32(len(diskful)) < count:
+		log.WithField("replicas", len(diskful)).Info("adding replicas")
+
+		err := s.client.Resources.Autoplace(ctx, volId, lapi.AutoPlaceRequest{
+			SelectFilter: lapi.AutoSelectFilter{PlaceCount: count},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to place additional replicas: %w", err)
+		}
+	case int32(len(diskful)) > count:
+		log.WithField("replicas", len(diskful)).Info("removing replicas")
+
+		// Sort replicas in use first, so the ones removed are preferably not in use.
+		sort.SliceStable(diskful, func(i, j int) bool {
+			return diskful[i].State.InUse && !diskful[j].State.InUse
+		})
+
+		for _, res := range diskful[count:] {
+			if res.State.InUse {
+				err := s.client.Resources.Diskless(ctx, volId, res.NodeName, "")
+				if err != nil {
+					return fmt.Errorf("failed to make replica on %s diskless: %w", res.NodeName, err)
+				}
+
+				continue
+			}
+
+			err := s.client.Resources.Delete(ctx, volId, res.NodeName)
+			if nil404(err) != nil {
+				return fmt.Errorf("failed to remove replica on %s: %w", res.NodeName, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,580 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	lapiconsts "github.com/LINBIT/golinstor"
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/pborman/uuid"
+	"github.com/sirupsen/logrus"
+	"k8s.io/mount-utils"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+var _ volume.NFSExporter = &Linstor{}
+
+// NFSFloatingAddresses sets the network, in CIDR notation, floating addresses of NFS exported volumes are allocated
+// from. Every volume gets its own address, which moves with the NFS server, so clients keep their mounts on failover.
+// Without floating addresses, clients mount the export from the address of the server node.
+func NFSFloatingAddresses(cidr string) func(*Linstor) error {
+	return func(l *Linstor) error {
+		if cidr == "" {
+			return nil
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid NFS floating address network: %w", err)
+		}
+
+		l.nfsAddresses = network
+
+		return nil
+	}
+}
+
+// NFSFloatingAddressInterface sets the network interface floating addresses are assigned to on the NFS server node.
+func NFSFloatingAddressInterface(name string) func(*Linstor) error {
+	return func(l *Linstor) error {
+		l.nfsInterface = name
+		return nil
+	}
+}
+
+// NFSServer returns the node serving the volume over NFS and the address clients mount the export from.
+//
+// The server follows the DRBD primary: if the volume is in use on a node, that node is the server. Otherwise, the last
+// server stored on the resource definition is kept while it is online, so all clients keep using the same address.
+func (s *Linstor) NFSServer(ctx context.Context, volId, preferredNode string) (string, string, error) {
+	log := s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+	})
+
+	rd, err := s.client.ResourceDefinitions.Get(ctx, volId)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get resource definition: %w", err)
+	}
+
+	ress, err := s.client.Resources.GetAll(ctx, volId)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	server := ""
+
+	for i := range ress {
+		if ress[i].State.InUse {
+			server = ress[i].NodeName
+			break
+		}
+	}
+
+	last := rd.Props[linstor.PropertyNFSServer]
+
+	if server == "" {
+		if last != "" && s.NodeAvailable(ctx, last) == nil {
+			server = last
+		} else {
+			server = preferredNode
+		}
+	}
+
+	props := make(map[string]string)
+
+	if server != last {
+		log.WithFields(logrus.Fields{
+			logging.FieldNode: server,
+			"previousServer":  last,
+		}).Info("NFS server of volume changed")
+
+		props[linstor.PropertyNFSServer] = server
+	}
+
+	address := rd.Props[linstor.PropertyNFSAddress]
+
+	if s.nfsAddresses != nil && address == "" {
+		s.nfsAddressLock.Lock()
+		defer s.nfsAddressLock.Unlock()
+
+		address, err = s.allocateNFSAddress(ctx)
+		if err != nil {
+			return "", "", err
+		}
+
+		log.WithField("address", address).Info("allocated NFS floating address")
+
+		props[linstor.PropertyNFSAddress] = address
+	}
+
+	if len(props) > 0 {
+		err := s.client.ResourceDefinitions.Modify(ctx, volId, lapi.GenericPropsModify{OverrideProps: props})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to store NFS server: %w", err)
+		}
+	}
+
+	if address != "" {
+		return server, address, nil
+	}
+
+	node, err := s.client.Nodes.Get(ctx, server)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get NFS server node %s: %w", server, err)
+	}
+
+	address = nodeAddress(&node)
+	if address == "" {
+		return "", "", fmt.Errorf("NFS server node %s has no network interface", server)
+	}
+
+	return server, address, nil
+}
+
+// allocateNFSAddress returns the first address of the floating address network not used by another volume.
+func (s *Linstor) allocateNFSAddress(ctx context.Context) (string, error) {
+	rds, err := s.client.ResourceDefinitions.GetAll(ctx, lapi.RDGetAllRequest{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list resource definitions: %w", err)
+	}
+
+	used := make(map[string]struct{})
+
+	for i := range rds {
+		if addr := rds[i].Props[linstor.PropertyNFSAddress]; addr != "" {
+			used[addr] = struct{}{}
+		}
+	}
+
+	network := s.nfsAddresses
+
+	// Skip the network address, and the broadcast address of IPv4 networks.
+	ip := nextIP(network.IP.Mask(network.Mask))
+	for ; network.Contains(ip); ip = nextIP(ip) {
+		if ip.To4() != nil && !network.Contains(nextIP(ip)) {
+			break
+		}
+
+		if _, ok := used[ip.String()]; !ok {
+			return ip.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no free NFS floating address left in %s", network)
+}
+
+// nextIP returns the address following ip.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
+
+// AddNFSClient records the node as client of the volume on the resource definition.
+func (s *Linstor) AddNFSClient(ctx context.Context, volId, node string) error {
+	err := s.client.ResourceDefinitions.Modify(ctx, volId, lapi.GenericPropsModify{
+		OverrideProps: map[string]string{linstor.PropertyNFSClientPrefix + node: "true"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add NFS client %s: %w", node, err)
+	}
+
+	return nil
+}
+
+// RemoveNFSClient removes the node from the clients recorded on the resource definition.
+func (s *Linstor) RemoveNFSClient(ctx context.Context, volId, node string) error {
+	err := s.client.ResourceDefinitions.Modify(ctx, volId, lapi.GenericPropsModify{
+		DeleteProps: []string{linstor.PropertyNFSClientPrefix + node},
+	})
+	if nil404(err) != nil {
+		return fmt.Errorf("failed to remove NFS client %s: %w", node, err)
+	}
+
+	return nil
+}
+
+// NFSVolume returns the NFS state stored on the resource definition of the volume.
+func (s *Linstor) NFSVolume(ctx context.Context, volId string) (*volume.NFSVolume, error) {
+	rd, err := s.client.ResourceDefinitions.Get(ctx, volId)
+	if err != nil {
+		return nil, nil404(err)
+	}
+
+	if rd.Props[linstor.PropertyNFSServer] == "" {
+		return nil, nil
+	}
+
+	vol := nfsVolume(&rd)
+
+	ress, err := s.client.Resources.GetAll(ctx, volId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	for i := range ress {
+		if ress[i].NodeName == vol.Server {
+			vol.ServerInUse = ress[i].State.InUse
+		}
+	}
+
+	return vol, nil
+}
+
+// NFSVolumes returns all volumes with an NFS server.
+func (s *Linstor) NFSVolumes(ctx context.Context) ([]volume.NFSVolume, error) {
+	rds, err := s.client.ResourceDefinitions.GetAll(ctx, lapi.RDGetAllRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource definitions: %w", err)
+	}
+
+	var result []volume.NFSVolume
+
+	for i := range rds {
+		if rds[i].Props[linstor.PropertyNFSServer] != "" {
+			result = append(result, *nfsVolume(&rds[i].ResourceDefinition))
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	ress, err := s.client.Resources.GetResourceView(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	for i := range result {
+		for j := range ress {
+			if ress[j].Name == result[i].ID && ress[j].NodeName == result[i].Server {
+				result[i].ServerInUse = ress[j].State.InUse
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// ClaimNFSServer makes node the server of the volume, if the current server is offline.
+func (s *Linstor) ClaimNFSServer(ctx context.Context, volId, node string) (bool, error) {
+	rd, err := s.client.ResourceDefinitions.Get(ctx, volId)
+	if err != nil {
+		return false, fmt.Errorf("failed to get resource definition: %w", err)
+	}
+
+	current := rd.Props[linstor.PropertyNFSServer]
+	if current == node {
+		return true, nil
+	}
+
+	if current != "" && s.NodeAvailable(ctx, current) == nil {
+		return false, nil
+	}
+
+	s.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: volId,
+		logging.FieldNode:   node,
+		"previousServer":    current,
+	}).Info("NFS server offline, taking over")
+
+	err = s.client.ResourceDefinitions.Modify(ctx, volId, lapi.GenericPropsModify{
+		OverrideProps: map[string]string{linstor.PropertyNFSServer: node},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to store NFS server: %w", err)
+	}
+
+	return true, nil
+}
+
+// nfsVolume returns the NFS state stored on the resource definition.
+func nfsVolume(rd *lapi.ResourceDefinition) *volume.NFSVolume {
+	vol := &volume.NFSVolume{
+		ID:      rd.Name,
+		FsType:  rd.Props[lapiconsts.NamespcFilesystem+"/"+lapiconsts.KeyFsType],
+		Server:  rd.Props[linstor.PropertyNFSServer],
+		Address: rd.Props[linstor.PropertyNFSAddress],
+	}
+
+	for k := range rd.Props {
+		if node, ok := strings.CutPrefix(k, linstor.PropertyNFSClientPrefix); ok {
+			vol.Clients = append(vol.Clients, node)
+		}
+	}
+
+	sort.Strings(vol.Clients)
+
+	return vol
+}
+
+// nodeAddress returns the address of the network interface used by LINSTOR to connect to the node.
+func nodeAddress(node *lapi.Node) string {
+	for _, nic := range node.NetInterfaces {
+		if nic.IsActive {
+			return nic.Address
+		}
+	}
+
+	if len(node.NetInterfaces) > 0 {
+		return node.NetInterfaces[0].Address
+	}
+
+	return ""
+}
+
+// NFSClients restricts NFS exports to the given networks, in CIDR notation. By default, volumes are only exported to
+// the addresses of the LINSTOR nodes.
+func NFSClients(cidrs []string) func(*Linstor) error {
+	return func(l *Linstor) error {
+		for _, cidr := range cidrs {
+			_, _, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid NFS client network: %w", err)
+			}
+		}
+
+		l.nfsClients = cidrs
+
+		return nil
+	}
+}
+
+// nfsExportClients returns the clients allowed to mount NFS exports: the configured networks, or the addresses of all
+// LINSTOR nodes.
+func (s *Linstor) nfsExportClients(ctx context.Context) ([]string, error) {
+	if len(s.nfsClients) > 0 {
+		return s.nfsClients, nil
+	}
+
+	nodes, err := s.client.Nodes.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var clients []string
+
+	for i := range nodes {
+		for _, nic := range nodes[i].NetInterfaces {
+			if nic.Address != "" && !slices.Contains(clients, nic.Address) {
+				clients = append(clients, nic.Address)
+			}
+		}
+	}
+
+	if len(clients) == 0 {
+		return nil, errors.New("no node addresses to export to")
+	}
+
+	sort.Strings(clients)
+
+	return clients, nil
+}
+
+// exportSpec returns the client:path argument for exportfs. IPv6 addresses need to be enclosed in brackets.
+func exportSpec(client, path string) string {
+	if strings.Contains(client, ":") {
+		client = "[" + client + "]"
+	}
+
+	return client + ":" + path
+}
+
+// Export makes the filesystem mounted at path available to the cluster nodes using the kernel NFS server. Root on the
+// clients is mapped to an anonymous user.
+// Operates locally on the machines where it is called.
+func (s *Linstor) Export(ctx context.Context, path string) error {
+	s.logger(ctx).WithField("path", path).Info("exporting volume over NFS")
+
+	clients, err := s.nfsExportClients(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The fsid identifies the export to clients. It has to stay the same when the volume is exported again, possibly
+	// from another node.
+	fsid := uuid.NewSHA1([]byte("linstor.csi.linbit.com"), []byte(path))
+	opts := "rw,sync,no_subtree_check,root_squash,fsid=" + fsid.String()
+
+	for _, client := range clients {
+		out, err := s.mounter.Exec.CommandContext(ctx, "exportfs", "-o", opts, exportSpec(client, path)).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to export %s to %s: %w: %s", path, client, err, out)
+		}
+	}
+
+	return nil
+}
+
+// Unexport stops serving the path over NFS to all clients it is currently exported to.
+// Operates locally on the machines where it is called.
+func (s *Linstor) Unexport(ctx context.Context, path string) error {
+	s.logger(ctx).WithField("path", path).Info("removing NFS export")
+
+	out, err := s.mounter.Exec.CommandContext(ctx, "exportfs", "-s").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to list NFS exports: %w: %s", err, out)
+	}
+
+	for _, client := range exportedClients(string(out), path) {
+		out, err := s.mounter.Exec.CommandContext(ctx, "exportfs", "-u", exportSpec(client, path)).CombinedOutput()
+		if err != nil && !strings.Contains(string(out), "Could not find") {
+			return fmt.Errorf("failed to unexport %s from %s: %w: %s", path, client, err, out)
+		}
+	}
+
+	return nil
+}
+
+// exportedClients returns the clients of path in the output of "exportfs -s". Every line contains the path followed
+// by one or more clients with their options, for example "/srv/export 10.0.0.1(rw,sync) 10.0.0.2(rw,sync)".
+func exportedClients(exports, path string) []string {
+	var clients []string
+
+	for _, line := range strings.Split(exports, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != path {
+			continue
+		}
+
+		for _, f := range fields[1:] {
+			client, _, _ := strings.Cut(f, "(")
+			client = strings.TrimSuffix(strings.TrimPrefix(client, "["), "]")
+
+			if client != "" && !slices.Contains(clients, client) {
+				clients = append(clients, client)
+			}
+		}
+	}
+
+	return clients
+}
+
+// floatingAddressSpec returns the address with a host prefix length, as used by "ip addr".
+func floatingAddressSpec(address string) (string, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid floating address %q", address)
+	}
+
+	if ip.To4() != nil {
+		return ip.String() + "/32", nil
+	}
+
+	return ip.String() + "/128", nil
+}
+
+// AddFloatingAddress assigns the address to the configured interface. IPv4 addresses are announced using gratuitous
+// ARP, so clients send their requests to this node right away.
+// Operates locally on the machines where it is called.
+func (s *Linstor) AddFloatingAddress(ctx context.Context, address string) error {
+	if s.nfsInterface == "" {
+		return errors.New("no interface configured for NFS floating addresses")
+	}
+
+	spec, err := floatingAddressSpec(address)
+	if err != nil {
+		return err
+	}
+
+	log := s.logger(ctx).WithFields(logrus.Fields{"address": address, "interface": s.nfsInterface})
+
+	out, err := s.mounter.Exec.CommandContext(ctx, "ip", "addr", "add", spec, "dev", s.nfsInterface).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "File exists") {
+			return nil
+		}
+
+		return fmt.Errorf("failed to add floating address %s: %w: %s", address, err, out)
+	}
+
+	log.Info("added NFS floating address")
+
+	if net.ParseIP(address).To4() != nil {
+		out, err := s.mounter.Exec.CommandContext(ctx, "arping", "-U", "-c", "3", "-I", s.nfsInterface, address).CombinedOutput()
+		if err != nil {
+			log.WithError(err).WithField("output", string(out)).Warn("failed to announce floating address")
+		}
+	}
+
+	return nil
+}
+
+// RemoveFloatingAddress removes the address from the configured interface.
+// Operates locally on the machines where it is called.
+func (s *Linstor) RemoveFloatingAddress(ctx context.Context, address string) error {
+	if s.nfsInterface == "" {
+		return nil
+	}
+
+	spec, err := floatingAddressSpec(address)
+	if err != nil {
+		return err
+	}
+
+	out, err := s.mounter.Exec.CommandContext(ctx, "ip", "addr", "del", spec, "dev", s.nfsInterface).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "Cannot assign requested address") {
+			return nil
+		}
+
+		return fmt.Errorf("failed to remove floating address %s: %w: %s", address, err, out)
+	}
+
+	s.logger(ctx).WithFields(logrus.Fields{"address": address, "interface": s.nfsInterface}).Info("removed NFS floating address")
+
+	return nil
+}
+
+// MountNFS mounts the path exported by the NFS server at target.
+// Operates locally on the machines where it is called.
+func (s *Linstor) MountNFS(ctx context.Context, server, exportPath, target string, readonly bool, mntOpts []string) error {
+	// IPv6 addresses need to be enclosed in brackets.
+	if strings.Contains(server, ":") {
+		server = "[" + server + "]"
+	}
+
+	source := server + ":" + exportPath
+
+	s.logger(ctx).WithFields(logrus.Fields{
+		"source":    source,
+		"target":    target,
+		"mountOpts": mntOpts,
+	}).Info("mounting NFS export")
+
+	err := ensureMountTarget(target, false)
+	if err != nil {
+		return err
+	}
+
+	needsMount, err := mount.IsNotMountPoint(s.mounter, target)
+	if err != nil {
+		return fmt.Errorf("unable to determine mount status of %s %v", target, err)
+	}
+
+	if !needsMount {
+		return nil
+	}
+
+	if readonly {
+		mntOpts = append(mntOpts, "ro")
+	}
+
+	return s.mounter.Mount(source, target, "nfs4", mntOpts)
+}
@@ -20,6 +20,7 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -31,16 +32,23 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/haySwim/data"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/piraeusdatastore/linstor-csi/pkg/client"
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/metrics"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
+	"github.com/piraeusdatastore/linstor-csi/pkg/tracing"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
@@ -49,16 +57,24 @@ var Version = "UNKNOWN"
 
 // Driver fullfils CSI controller, node, and indentity server interfaces.
 type Driver struct {
-	Storage       volume.CreateDeleter
-	Assignments   volume.AttacherDettacher
-	Mounter       volume.Mounter
-	Snapshots     volume.SnapshotCreateDeleter
-	VolumeStatter volume.VolumeStatter
-	Expander      volume.Expander
-	NodeInformer  volume.NodeInformer
-	srv           *grpc.Server
-	log           *logrus.Entry
-	version       string
+	csi.UnimplementedIdentityServer
+	csi.UnimplementedControllerServer
+	csi.UnimplementedNodeServer
+	csi.UnimplementedGroupControllerServer
+
+	Storage        volume.CreateDeleter
+	Assignments    volume.AttacherDettacher
+	Mounter        volume.Mounter
+	Snapshots      volume.SnapshotCreateDeleter
+	GroupSnapshots volume.GroupSnapshotCreateDeleter
+	VolumeStatter  volume.VolumeStatter
+	Expander       volume.Expander
+	Modifier       volume.Modifier
+	NFS            volume.NFSExporter
+	NodeInformer   volume.NodeInformer
+	srv            *grpc.Server
+	log            *logrus.Entry
+	version        string
 	// name distingushes the driver from other drivers and is used to mark
 	// volumes so that volumes provisioned by another driver are not interfered with.
 	name string
@@ -66,6 +82,15 @@ type Driver struct {
 	endpoint string
 	// nodeID is the hostname of the node where this plugin is running locally.
 	nodeID string
+	// locks tracks the volumes and snapshots with an operation in flight.
+	locks *operationLocks
+	// nfsExportRoot is the directory where volumes exported over NFS are mounted on the NFS server node.
+	nfsExportRoot string
+	// ephemeralResourceGroups are the resource groups ephemeral inline volumes may be created in, the first one is
+	// the default. Ephemeral volumes are disabled if empty.
+	ephemeralResourceGroups []string
+	// ephemeralMaxSize is the largest size of an ephemeral inline volume.
+	ephemeralMaxSize int64
 }
 
 // NewDriver builds up a driver.
@@ -74,17 +99,24 @@ func NewDriver(options ...func(*Driver) error) (*Driver, error) {
 	mockStorage := client.NewMockStorage()
 
 	d := &Driver{
-		name:          "linstor.csi.linbit.com",
-		version:       Version,
-		nodeID:        "localhost",
-		Storage:       mockStorage,
-		Assignments:   mockStorage,
-		Mounter:       mockStorage,
-		Snapshots:     mockStorage,
-		Expander:      mockStorage,
-		VolumeStatter: mockStorage,
-		NodeInformer:  mockStorage,
-		log:           logrus.NewEntry(logrus.New()),
+		name:           "linstor.csi.linbit.com",
+		version:        Version,
+		nodeID:         "localhost",
+		Storage:        mockStorage,
+		Assignments:    mockStorage,
+		Mounter:        mockStorage,
+		Snapshots:      mockStorage,
+		GroupSnapshots: mockStorage,
+		Expander:       mockStorage,
+		Modifier:       mockStorage,
+		NFS:            mockStorage,
+		VolumeStatter:  mockStorage,
+		NodeInformer:   mockStorage,
+		log:            logrus.NewEntry(logrus.New()),
+		locks:          newOperationLocks(),
+		nfsExportRoot:  DefaultNFSExportRoot,
+
+		ephemeralMaxSize: DefaultEphemeralMaxSize,
 	}
 
 	d.log.Logger.SetOutput(ioutil.Discard)
@@ -108,6 +140,8 @@ func NewDriver(options ...func(*Driver) error) (*Driver, error) {
 		"nodeID":              d.nodeID,
 	})
 
+	d.srv = d.newServer()
+
 	return d, nil
 }
 
@@ -126,6 +160,52 @@ func Expander(s volume.Expander) func(*Driver) error {
 	}
 }
 
+// Modifier configures the volume modification service backend.
+func Modifier(m volume.Modifier) func(*Driver) error {
+	return func(d *Driver) error {
+		d.Modifier = m
+		return nil
+	}
+}
+
+// NFSExporter configures the NFS export service backend.
+func NFSExporter(e volume.NFSExporter) func(*Driver) error {
+	return func(d *Driver) error {
+		d.NFS = e
+		return nil
+	}
+}
+
+// NFSExportRoot configures the directory where volumes exported over NFS are mounted.
+func NFSExportRoot(path string) func(*Driver) error {
+	return func(d *Driver) error {
+		d.nfsExportRoot = path
+		return nil
+	}
+}
+
+// EphemeralResourceGroups configures the LINSTOR resource groups ephemeral inline volumes may use. The first group is
+// used unless the volume attributes select another one.
+func EphemeralResourceGroups(groups []string) func(*Driver) error {
+	return func(d *Driver) error {
+		d.ephemeralResourceGroups = groups
+		return nil
+	}
+}
+
+// EphemeralMaxSize configures the largest size of an ephemeral inline volume.
+func EphemeralMaxSize(bytes int64) func(*Driver) error {
+	return func(d *Driver) error {
+		if bytes <= 0 {
+			return fmt.Errorf("invalid maximum size for ephemeral volumes: %d", bytes)
+		}
+
+		d.ephemeralMaxSize = bytes
+
+		return nil
+	}
+}
+
 // Assignments configures the volume attachment service backend.
 func Assignments(a volume.AttacherDettacher) func(*Driver) error {
 	return func(d *Driver) error {
@@ -142,6 +222,14 @@ func Snapshots(s volume.SnapshotCreateDeleter) func(*Driver) error {
 	}
 }
 
+// GroupSnapshots configures the volume group snapshot service backend.
+func GroupSnapshots(s volume.GroupSnapshotCreateDeleter) func(*Driver) error {
+	return func(d *Driver) error {
+		d.GroupSnapshots = s
+		return nil
+	}
+}
+
 // Mounter configures the volume mounting service backend.
 func Mounter(m volume.Mounter) func(*Driver) error {
 	return func(d *Driver) error {
@@ -247,6 +335,11 @@ func (d Driver) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCap
 					Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
 				},
 			}},
+			{Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_GROUP_CONTROLLER_SERVICE,
+				},
+			}},
 			{Type: &csi.PluginCapability_VolumeExpansion_{
 				VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
 					Type: csi.PluginCapability_VolumeExpansion_ONLINE,
@@ -263,46 +356,29 @@ func (d Driver) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeRes
 
 // NodeStageVolume https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#nodestagevolume
 func (d Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "")
-}
-
-// NodeUnstageVolume https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#nodeunstagevolume
-func (d Driver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "")
-}
-
-// NodePublishVolume https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#nodepublishvolume
-func (d Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	if req.GetVolumeId() == "" {
-		return &csi.NodePublishVolumeResponse{}, missingAttr("NodePublishVolume", req.GetVolumeId(), "VolumeId")
+		return nil, missingAttr("NodeStageVolume", req.GetVolumeId(), "VolumeId")
 	}
 
-	if req.GetTargetPath() == "" {
-		return &csi.NodePublishVolumeResponse{}, missingAttr("NodePublishVolume", req.GetVolumeId(), "TargetPath")
+	if req.GetStagingTargetPath() == "" {
+		return nil, missingAttr("NodeStageVolume", req.GetVolumeId(), "StagingTargetPath")
 	}
 
 	if req.GetVolumeCapability() == nil {
-		return &csi.NodePublishVolumeResponse{}, missingAttr("NodePublishVolume", req.GetVolumeId(), "VolumeCapability slice")
+		return nil, missingAttr("NodeStageVolume", req.GetVolumeId(), "VolumeCapability")
 	}
 
-	// Don't try to publish volumes in ROX configurations without the "ro" option.
-	// You might think this is something ControllerPublishVolume could do already. You are wrong. The Readonly flag
-	// passed to ControllerPublishVolume is *always* false i.e. completely useless.
-	// The Readonly flag passed here is the one set in pod specs as spec.volumes[].persistentVolumeClaim.readOnly
-	// See: https://github.com/kubernetes/kubernetes/issues/70505
-	if req.GetVolumeCapability().GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY && !req.GetReadonly() {
-		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: access mode requires 'persistentVolumeClaim.readOnly' to be true", req.GetVolumeId())
-	}
-
-	if req.GetPublishContext()[linstor.PublishedReadOnlyKey] == "true" && !req.GetReadonly() {
-		return nil, status.Errorf(codes.AlreadyExists, "NodePublishVolume failed for %s: controller published readonly=true, but request is for readonly=false", req.GetVolumeId())
+	release, err := d.lockVolume("NodeStageVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
 	volCtx := VolumeContextFromMap(req.GetVolumeContext())
 	if volCtx == nil {
 		params, err := d.Storage.GetLegacyVolumeParameters(ctx, req.GetVolumeId())
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: could not find volume parameters in context or legacy LINSTOR property", req.GetVolumeId())
+			return nil, status.Errorf(codes.Internal, "NodeStageVolume failed for %s: could not find volume parameters in context or legacy LINSTOR property", req.GetVolumeId())
 		}
 
 		if params != nil {
@@ -314,8 +390,11 @@ func (d Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolum
 
 	var fsType string
 
+	stagingPath := req.GetStagingTargetPath()
+
 	if block := req.GetVolumeCapability().GetBlock(); block != nil {
 		volCtx.MountOptions = []string{"bind"}
+		stagingPath = blockStagingPath(stagingPath)
 	}
 
 	if mnt := req.GetVolumeCapability().GetMount(); mnt != nil {
@@ -332,34 +411,173 @@ func (d Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolum
 		volCtx.MountOptions = append(volCtx.MountOptions, "nouuid")
 	}
 
+	// The staging mount is shared by all pods on this node, so it can only be read-only if every publish will be.
+	readOnly := req.GetVolumeCapability().GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY ||
+		req.GetPublishContext()[linstor.PublishedReadOnlyKey] == "true"
+
+	if req.GetPublishContext()[linstor.PublishedNFSServerKey] != "" {
+		err := d.nodeStageNFS(ctx, req, stagingPath, readOnly)
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+
+			return nil, status.Errorf(codes.Internal, "NodeStageVolume failed for %s: %v", req.GetVolumeId(), err)
+		}
+
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
 	assignment, err := d.Assignments.FindAssignmentOnNode(ctx, req.GetVolumeId(), d.nodeID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+		return nil, status.Errorf(codes.Internal, "NodeStageVolume failed for %s: %v", req.GetVolumeId(), err)
 	}
 
 	if assignment == nil {
-		return nil, status.Errorf(codes.NotFound, "NodePublishVolume failed for %s: assignment not found", req.GetVolumeId())
+		return nil, status.Errorf(codes.NotFound, "NodeStageVolume failed for %s: assignment not found", req.GetVolumeId())
 	}
 
-	err = d.Mounter.Mount(ctx, assignment.Path, req.GetTargetPath(), fsType, req.GetReadonly(), volCtx.MountOptions)
+	err = d.checkLuksPassphrase(ctx, req, assignment)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+		return nil, err
+	}
+
+	err = d.Mounter.Mount(ctx, assignment.Path, stagingPath, fsType, readOnly, volCtx.MountOptions)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeStageVolume failed for %s: %v", req.GetVolumeId(), err)
 	}
 
 	// Runs post-mount xfs_io if PostMountXfsOpts is configured
 	if fsType == "xfs" && volCtx.PostMountXfsOptions != "" {
-		d.log.WithFields(logrus.Fields{
-			"XFS_IO":     volCtx.PostMountXfsOptions,
-			"FSType":     fsType,
-			"targetPath": req.GetTargetPath(),
+		d.logger(ctx).WithFields(logrus.Fields{
+			"XFS_IO":      volCtx.PostMountXfsOptions,
+			"FSType":      fsType,
+			"stagingPath": stagingPath,
 		}).Debug("Post-mount XFS_io")
 
-		_, err := exec.Command("xfs_io", "-c", volCtx.PostMountXfsOptions, req.GetTargetPath()).CombinedOutput()
+		_, err := exec.Command("xfs_io", "-c", volCtx.PostMountXfsOptions, stagingPath).CombinedOutput()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "NodeStageVolume failed for %s: %v", req.GetVolumeId(), err)
+		}
+	}
+
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+// checkLuksPassphrase verifies the LUKS passphrase from the node-stage secrets, if any. Only nodes storing the data have
+// a LUKS layer. Diskless nodes receive the decrypted data via DRBD.
+func (d Driver) checkLuksPassphrase(ctx context.Context, req *csi.NodeStageVolumeRequest, assignment *volume.Assignment) error {
+	passphrase := req.GetSecrets()[volume.LuksPassphraseKey]
+	if passphrase == "" || assignment.LuksBackingDevice == "" {
+		return nil
+	}
+
+	err := d.Mounter.CheckLuksPassphrase(ctx, assignment.LuksBackingDevice, passphrase)
+	if errors.Is(err, volume.ErrLuksPassphraseMismatch) {
+		return status.Errorf(codes.InvalidArgument, "NodeStageVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "NodeStageVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	return nil
+}
+
+// NodeUnstageVolume https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#nodeunstagevolume
+func (d Driver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, missingAttr("NodeUnstageVolume", req.GetVolumeId(), "VolumeId")
+	}
+
+	if req.GetStagingTargetPath() == "" {
+		return nil, missingAttr("NodeUnstageVolume", req.GetVolumeId(), "StagingTargetPath")
+	}
+
+	release, err := d.lockVolume("NodeUnstageVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// We don't know if this was a block or filesystem volume, so we try to clean up both. For filesystem volumes, the
+	// block staging path is inside the mounted filesystem: it is only unmounted if it is a mount point, as Unmount
+	// removes paths that are not mounted, which could delete user data.
+	deviceStagingPath := blockStagingPath(req.GetStagingTargetPath())
+
+	notMounted, err := d.Mounter.IsNotMountPoint(deviceStagingPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeUnstageVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	if !notMounted {
+		err = d.Mounter.Unmount(deviceStagingPath)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+			return nil, status.Errorf(codes.Internal, "NodeUnstageVolume failed for %s: %v", req.GetVolumeId(), err)
 		}
 	}
 
+	err = d.Mounter.Unmount(req.GetStagingTargetPath())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeUnstageVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+// NodePublishVolume https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#nodepublishvolume
+func (d Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return &csi.NodePublishVolumeResponse{}, missingAttr("NodePublishVolume", req.GetVolumeId(), "VolumeId")
+	}
+
+	if req.GetTargetPath() == "" {
+		return &csi.NodePublishVolumeResponse{}, missingAttr("NodePublishVolume", req.GetVolumeId(), "TargetPath")
+	}
+
+	if req.GetVolumeCapability() == nil {
+		return &csi.NodePublishVolumeResponse{}, missingAttr("NodePublishVolume", req.GetVolumeId(), "VolumeCapability slice")
+	}
+
+	release, err := d.lockVolume("NodePublishVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if isEphemeral(req.GetVolumeContext()) {
+		return d.nodePublishEphemeral(ctx, req)
+	}
+
+	if req.GetStagingTargetPath() == "" {
+		return &csi.NodePublishVolumeResponse{}, missingAttr("NodePublishVolume", req.GetVolumeId(), "StagingTargetPath")
+	}
+
+	// Don't try to publish volumes in ROX configurations without the "ro" option.
+	// You might think this is something ControllerPublishVolume could do already. You are wrong. The Readonly flag
+	// passed to ControllerPublishVolume is *always* false i.e. completely useless.
+	// The Readonly flag passed here is the one set in pod specs as spec.volumes[].persistentVolumeClaim.readOnly
+	// See: https://github.com/kubernetes/kubernetes/issues/70505
+	if req.GetVolumeCapability().GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY && !req.GetReadonly() {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: access mode requires 'persistentVolumeClaim.readOnly' to be true", req.GetVolumeId())
+	}
+
+	if req.GetPublishContext()[linstor.PublishedReadOnlyKey] == "true" && !req.GetReadonly() {
+		return nil, status.Errorf(codes.AlreadyExists, "NodePublishVolume failed for %s: controller published readonly=true, but request is for readonly=false", req.GetVolumeId())
+	}
+
+	block := req.GetVolumeCapability().GetBlock() != nil
+
+	source := req.GetStagingTargetPath()
+	if block {
+		source = blockStagingPath(source)
+	}
+
+	err = d.Mounter.BindMount(ctx, source, req.GetTargetPath(), block, req.GetReadonly())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
@@ -373,10 +591,21 @@ func (d Driver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishV
 		return nil, missingAttr("NodeUnpublishVolume", req.GetVolumeId(), "TargetPath")
 	}
 
-	err := d.Mounter.Unmount(req.GetTargetPath())
+	release, err := d.lockVolume("NodeUnpublishVolume", req.GetVolumeId())
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+
+	err = d.Mounter.Unmount(req.GetTargetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.removeIfEphemeral(ctx, req.GetTargetPath())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeUnpublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
 
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
@@ -436,6 +665,13 @@ func (d Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeSt
 func (d Driver) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
 	return &csi.NodeGetCapabilitiesResponse{
 		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+					},
+				},
+			},
 			{
 				Type: &csi.NodeServiceCapability_Rpc{
 					Rpc: &csi.NodeServiceCapability_RPC{
@@ -450,6 +686,13 @@ func (d Driver) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesReq
 					},
 				},
 			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+					},
+				},
+			},
 		},
 	}, nil
 }
@@ -491,11 +734,42 @@ func (d Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 	}
 	volumeSize := data.NewKibiByte(data.KiB * data.ByteSize(requiredKiB))
 
-	params, err := volume.NewParameters(req.GetParameters())
+	// Mutable parameters, from a VolumeAttributesClass, use the same keys and take precedence over the parameters.
+	_, err = volume.NewMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse mutable parameters: %v", err)
+	}
+
+	rawParams := make(map[string]string, len(req.GetParameters())+len(req.GetMutableParameters()))
+	for k, v := range req.GetParameters() {
+		rawParams[k] = v
+	}
+
+	for k, v := range req.GetMutableParameters() {
+		rawParams[k] = v
+	}
+
+	params, err := volume.NewParameters(rawParams)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "failed to parse parameters: %v", err)
 	}
 
+	err = scheduler.Supported(&params)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse parameters: %v", err)
+	}
+
+	err = params.ApplySecrets(req.GetSecrets())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse secrets: %v", err)
+	}
+
+	for _, cap := range req.GetVolumeCapabilities() {
+		if err := validateAccessMode(cap, params.NFSExport); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "CreateVolume failed for %s: %v", req.Name, err)
+		}
+	}
+
 	var pvcNamespace, pvcName string
 	if params.UsePvcName {
 		pvcName = req.GetParameters()[ParameterCsiPvcName]
@@ -504,9 +778,17 @@ func (d Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 
 	volId := d.Storage.CompatibleVolumeId(req.GetName(), pvcNamespace, pvcName)
 
-	log := d.log.WithField("volume", volId)
+	ctx = logging.WithFields(ctx, logrus.Fields{logging.FieldVolume: volId})
+
+	log := d.logger(ctx)
 	log.Infof("determined volume id for volume named '%s'", req.GetName())
 
+	release, err := d.lockVolume("CreateVolume", volId)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Handle case were a volume of the same name is already present.
 	existingVolume, err := d.Storage.FindByID(ctx, volId)
 	if err != nil {
@@ -520,7 +802,11 @@ func (d Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, status.Errorf(codes.AlreadyExists, "FsType don't match: existing: '%s', requested: '%s'", existingVolume.FsType, fsType)
 	}
 
-	if existingVolume != nil && strings.HasPrefix(existingVolume.Properties[linstor.PropertyProvisioningCompletedBy], "linstor-csi") {
+	if params.Adopt {
+		return d.adoptExistingVolume(ctx, existingVolume, &params, rawParams, req)
+	}
+
+	if existingVolume != nil && provisionedByPlugin(existingVolume) {
 		log.WithField("existingVolume", existingVolume).Info("volume already present")
 
 		if existingVolume.SizeBytes != int64(volumeSize.InclusiveBytes()) {
@@ -594,7 +880,13 @@ func (d Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest)
 		return nil, missingAttr("DeleteVolume", req.GetVolumeId(), "VolumeId")
 	}
 
-	err := d.Storage.Delete(ctx, req.GetVolumeId())
+	release, err := d.lockVolume("DeleteVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	err = d.Storage.Delete(ctx, req.GetVolumeId())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to delete volume: %v", err)
 	}
@@ -614,6 +906,18 @@ func (d Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controller
 		return nil, missingAttr("ControllerPublishVolume", req.GetVolumeId(), "VolumeCapability")
 	}
 
+	volCtx := VolumeContextFromMap(req.GetVolumeContext())
+
+	if err := validateAccessMode(req.GetVolumeCapability(), volCtx != nil && volCtx.NFSExport); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "ControllerPublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	release, err := d.lockVolume("ControllerPublishVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Don't try to assign volumes that don't exist.
 	existingVolume, err := d.Storage.FindByID(ctx, req.GetVolumeId())
 	if err != nil {
@@ -626,7 +930,15 @@ func (d Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controller
 			req.GetVolumeId())
 	}
 
-	d.log.WithField("existingVolume", fmt.Sprintf("%+v", existingVolume)).Debug("found existing volume")
+	d.logger(ctx).WithFields(existingVolume.LogFields()).Debug("found existing volume")
+
+	// Statically provisioned volumes reach the plugin for the first time here.
+	if !provisionedByPlugin(existingVolume) {
+		err := d.adoptVolume(ctx, existingVolume, ParametersFromVolumeContext(req.GetVolumeContext()), []*csi.VolumeCapability{req.GetVolumeCapability()})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	assignment, err := d.Assignments.FindAssignmentOnNode(ctx, req.GetVolumeId(), req.GetNodeId())
 	if err != nil {
@@ -643,7 +955,18 @@ func (d Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controller
 			"ControllerPublishVolume failed for %s on node %s: %v", req.GetVolumeId(), req.GetNodeId(), err)
 	}
 
-	err = d.Assignments.Attach(ctx, req.GetVolumeId(), req.GetNodeId(), req.GetReadonly())
+	if usesNFSExport(volCtx, req.GetVolumeCapability()) {
+		return d.controllerPublishNFS(ctx, req)
+	}
+
+	multiWriter := req.GetVolumeCapability().GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+
+	err = d.Assignments.Attach(ctx, req.GetVolumeId(), req.GetNodeId(), req.GetReadonly(), multiWriter)
+	if errors.Is(err, volume.ErrTooManyWriters) {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"ControllerPublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
 	if err != nil {
 		return nil, status.Errorf(codes.Internal,
 			"ControllerPublishVolume failed for %s: %v", req.GetVolumeId(), err)
@@ -663,14 +986,37 @@ func (d Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Controll
 		return nil, missingAttr("ControllerUnpublishVolume", req.GetNodeId(), "NodeId")
 	}
 
-	if err := d.Assignments.Detach(ctx, req.GetVolumeId(), req.GetNodeId()); err != nil {
-		return nil, status.Errorf(codes.Internal,
-			"ControllerUnpublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	release, err := d.lockVolume("ControllerUnpublishVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Volumes shared over NFS are only detached from the server once all clients are unpublished.
+	nfs, err := d.controllerUnpublishNFS(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !nfs {
+		err := d.detach(ctx, req.GetVolumeId(), req.GetNodeId())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
 
+// detach removes the volume from the node, as part of ControllerUnpublishVolume.
+func (d Driver) detach(ctx context.Context, volId, node string) error {
+	if err := d.Assignments.Detach(ctx, volId, node); err != nil {
+		return status.Errorf(codes.Internal, "ControllerUnpublishVolume failed for %s: %v", volId, err)
+	}
+
+	return nil
+}
+
 // ValidateVolumeCapabilities https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#validatevolumecapabilities
 func (d Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
 	if req.GetVolumeId() == "" {
@@ -690,56 +1036,76 @@ func (d Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Validat
 		return nil, status.Errorf(codes.NotFound,
 			"ValidateVolumeCapabilities failed for %s: volume not present in storage backend", req.GetVolumeId())
 	}
-	d.log.WithFields(logrus.Fields{
-		"existingVolume": fmt.Sprintf("%+v", existingVolume),
-	}).Debug("found existing volume")
+	d.logger(ctx).WithFields(existingVolume.LogFields()).Debug("found existing volume")
+
+	volCtx := VolumeContextFromMap(req.GetVolumeContext())
+	nfsExport := volCtx != nil && volCtx.NFSExport
 
 	for _, requested := range req.VolumeCapabilities {
-		requestedMode := requested.GetAccessMode().GetMode()
-		if requestedMode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER && requestedMode != csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY {
-			return nil, status.Errorf(codes.InvalidArgument, "ValidateVolumeCapabilities failed for %s: volumes support only RWO and ROX mode", req.GetVolumeId())
+		if err := validateAccessMode(requested, nfsExport); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "ValidateVolumeCapabilities failed for %s: %v", req.GetVolumeId(), err)
 		}
 	}
 
-	return &csi.ValidateVolumeCapabilitiesResponse{
-		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
-			VolumeCapabilities: []*csi.VolumeCapability{
-				// Tell CO we can provision RWO and ROX mount volumes.
-				{
-					AccessType: &csi.VolumeCapability_Mount{
-						Mount: &csi.VolumeCapability_MountVolume{},
-					},
-					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
-					},
-				},
-				{
-					AccessType: &csi.VolumeCapability_Mount{
-						Mount: &csi.VolumeCapability_MountVolume{},
-					},
-					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
-					},
-				},
-				// Tell CO we can provision RWO and ROX block volumes.
-				{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
-					},
-					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
-					},
-				},
-				{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
-					},
-					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
-					},
-				},
+	confirmed := []*csi.VolumeCapability{
+		// Tell CO we can provision RWO and ROX mount volumes.
+		{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+		{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+			},
+		},
+		// Tell CO we can provision RWO, ROX and RWX block volumes.
+		{
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+		{
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+			},
+		},
+		{
+			AccessType: &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
 			},
 		},
+	}
+
+	if nfsExport {
+		// Tell CO we can provision RWX mount volumes, exported over NFS.
+		confirmed = append(confirmed, &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		})
+	}
+
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{VolumeCapabilities: confirmed},
 	}, nil
 }
 
@@ -799,7 +1165,7 @@ func (d Driver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*
 		return nil, status.Errorf(codes.InvalidArgument, "invalid parameters: %v", err)
 	}
 
-	d.log.WithFields(logrus.Fields{
+	d.logger(ctx).WithFields(logrus.Fields{
 		"parameters": params,
 		"topology":   req.GetAccessibleTopology(),
 	}).Debug("got capacity request")
@@ -807,14 +1173,14 @@ func (d Driver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*
 	// Get the labels for nodes we are allowed to "share" per remote access policy.
 	accessibleSegments := params.AllowRemoteVolumeAccess.AccessibleSegments(req.GetAccessibleTopology().GetSegments())
 
-	d.log.WithField("accessible", accessibleSegments).Trace("got accessible segments for parameters")
+	d.logger(ctx).WithField("accessible", accessibleSegments).Trace("got accessible segments for parameters")
 
 	maxCap := int64(0)
 
 	for _, segment := range accessibleSegments {
-		d.log.WithField("segment", segment).Debug("Checking capacity of segment")
+		d.logger(ctx).WithField("segment", segment).Debug("Checking capacity of segment")
 
-		bytes, err := d.Storage.CapacityBytes(ctx, params.StoragePool, segment)
+		bytes, err := d.Storage.CapacityBytes(ctx, params.StoragePool, params.PlacementCount, segment)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "%v", err)
 		}
@@ -824,7 +1190,13 @@ func (d Driver) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*
 		}
 	}
 
-	return &csi.GetCapacityResponse{AvailableCapacity: maxCap}, nil
+	// The capacity of a segment is already the largest volume that fits into single storage pools on enough nodes,
+	// so it is also the maximum volume size. Reporting it lets the scheduler skip segments where a volume never fits.
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: maxCap,
+		MaximumVolumeSize: wrapperspb.Int64(maxCap),
+		MinimumVolumeSize: wrapperspb.Int64(volume.MinimumSizeBytes),
+	}, nil
 }
 
 // ControllerGetCapabilities https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#controllergetcapabilities
@@ -884,6 +1256,26 @@ func (d Driver) ControllerGetCapabilities(ctx context.Context, req *csi.Controll
 					Type: csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 				},
 			}},
+			{Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_GET_VOLUME,
+				},
+			}},
+			{Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+				},
+			}},
+			{Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+				},
+			}},
+			{Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+				},
+			}},
 		},
 	}, nil
 }
@@ -897,18 +1289,34 @@ func (d Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotReque
 		return nil, missingAttr("CreateSnapshot", req.GetName(), "Name")
 	}
 
-	d.log.WithField("req.parameters", req.GetParameters()).Debug("parsing request")
+	d.logger(ctx).WithField("req.parameters", req.GetParameters()).Debug("parsing request")
 
 	params, err := volume.NewSnapshotParameters(req.GetParameters(), req.GetSecrets())
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid snapshot parameters: %v", err)
 	}
 
-	d.log.WithField("params", params).Debug("got snapshot parameters")
+	d.logger(ctx).WithField("params", params).Debug("got snapshot parameters")
 
 	id := d.Snapshots.CompatibleSnapshotId(req.GetName())
 
-	d.log.WithField("snapshot id", id).Debug("using snapshot id")
+	ctx = logging.WithFields(ctx, logrus.Fields{logging.FieldSnapshot: id})
+
+	d.logger(ctx).Debug("using snapshot id")
+
+	release, err := d.lockSnapshot("CreateSnapshot", id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// The source volume is locked, so it is not deleted or migrated while the snapshot is taken. This also means only
+	// one snapshot of type Linstor is shipped at a time, which is required to find the snapshot LINSTOR ships.
+	releaseVol, err := d.lockVolume("CreateSnapshot", req.GetSourceVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer releaseVol()
 
 	existingSnap, ok, err := d.Snapshots.FindSnapByID(ctx, id)
 	if err != nil {
@@ -916,7 +1324,7 @@ func (d Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotReque
 	}
 
 	if !ok {
-		d.log.Debug("existing snapshot is in failed state, deleting")
+		d.logger(ctx).Debug("existing snapshot is in failed state, deleting")
 		err := d.Snapshots.SnapDelete(ctx, &csi.Snapshot{
 			SourceVolumeId: req.GetSourceVolumeId(),
 			SnapshotId:     req.GetName(),
@@ -928,10 +1336,9 @@ func (d Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotReque
 
 	if existingSnap != nil {
 		// Needed for idempotency.
-		d.log.WithFields(logrus.Fields{
+		d.logger(ctx).WithFields(volume.SnapshotLogFields(existingSnap)).WithFields(logrus.Fields{
 			"requestedSnapshotName":         req.GetName(),
 			"requestedSnapshotSourceVolume": req.GetSourceVolumeId(),
-			"existingSnapshot":              fmt.Sprintf("%+v", existingSnap),
 		}).Debug("found existing snapshot")
 
 		if existingSnap.GetSourceVolumeId() == req.GetSourceVolumeId() {
@@ -955,13 +1362,19 @@ func (d Driver) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotReque
 		return nil, missingAttr("DeleteSnapshot", req.GetSnapshotId(), "SnapshotId")
 	}
 
+	release, err := d.lockSnapshot("DeleteSnapshot", req.GetSnapshotId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	snap, _, err := d.Snapshots.FindSnapByID(ctx, req.GetSnapshotId())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "unable to find snapshot %s: %v",
 			req.GetSnapshotId(), err)
 	}
 	if snap == nil {
-		d.log.WithFields(logrus.Fields{
+		d.logger(ctx).WithFields(logrus.Fields{
 			"snapshotId": req.GetSnapshotId(),
 		}).Info("unable to find snapshot, it may already be deleted")
 		return &csi.DeleteSnapshotResponse{}, nil
@@ -995,10 +1408,7 @@ func (d Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest
 			return &csi.ListSnapshotsResponse{}, nil
 		}
 
-		d.log.WithFields(logrus.Fields{
-			"requestedSnapshot": req.GetSnapshotId(),
-			"napshot":           fmt.Sprintf("%+v", snap),
-		}).Debug("found single snapshot")
+		d.logger(ctx).WithFields(volume.SnapshotLogFields(snap)).Debug("found single snapshot")
 		snapshots = []*csi.Snapshot{snap}
 
 		// Handle case where a single volumes snapshots are requested.
@@ -1043,8 +1453,9 @@ func (d Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest
 
 // NodeExpandVolume https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#nodeexpandvolume
 func (d Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
-	d.log.WithFields(logrus.Fields{
-		"NodeExpandVolume": fmt.Sprintf("%+v", req),
+	d.logger(ctx).WithFields(logrus.Fields{
+		"volumePath":    req.GetVolumePath(),
+		"requiredBytes": req.GetCapacityRange().GetRequiredBytes(),
 	}).Debug("Node expand volume")
 
 	if req.GetVolumeId() == "" {
@@ -1055,6 +1466,12 @@ func (d Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeR
 		return nil, missingAttr("NodeExpandVolume", req.GetVolumeId(), "TargetPath")
 	}
 
+	release, err := d.lockVolume("NodeExpandVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	assignment, err := d.Assignments.FindAssignmentOnNode(ctx, req.GetVolumeId(), d.nodeID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "NodeExpandVolume - get assignment failed for volume %s node: %s: %v", req.GetVolumeId(), d.nodeID, err)
@@ -1079,6 +1496,12 @@ func (d Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerE
 		return nil, missingAttr("ControllerExpandVolume", req.GetVolumeId(), "VolumeId")
 	}
 
+	release, err := d.lockVolume("ControllerExpandVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	existingVolume, err := d.Storage.FindByID(ctx, req.GetVolumeId())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "ControllerExpandVolume - get resource-definitions %s failed: %v", req.GetVolumeId(), err)
@@ -1088,9 +1511,7 @@ func (d Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerE
 		return nil, status.Errorf(codes.Internal,
 			"ControllerExpandVolume - resource-definitions %s not found", req.GetVolumeId())
 	}
-	d.log.WithFields(logrus.Fields{
-		"existingVolume": fmt.Sprintf("%+v", existingVolume),
-	}).Debug("found existing volume")
+	d.logger(ctx).WithFields(existingVolume.LogFields()).Debug("found existing volume")
 
 	requiredKiB, err := d.Storage.AllocationSizeKiB(req.CapacityRange.GetRequiredBytes(), req.CapacityRange.GetLimitBytes())
 	if err != nil {
@@ -1099,9 +1520,9 @@ func (d Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerE
 	volumeSize := data.NewKibiByte(data.KiB * data.ByteSize(requiredKiB))
 	existingVolume.SizeBytes = int64(volumeSize.InclusiveBytes())
 
-	d.log.WithFields(logrus.Fields{
-		"ControllerExpandVolume": fmt.Sprintf("%+v", req),
-		"Size":                   volumeSize,
+	d.logger(ctx).WithFields(logrus.Fields{
+		"requiredBytes": req.GetCapacityRange().GetRequiredBytes(),
+		"size":          volumeSize,
 	}).Debug("controller expand volume")
 
 	err = d.Expander.ControllerExpand(ctx, existingVolume)
@@ -1118,8 +1539,75 @@ func (d Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerE
 }
 
 // ControllerGetVolume https://github.com/container-storage-interface/spec/blob/v1.4.0/spec.md#controllergetvolume
-func (d Driver) ControllerGetVolume(ctx context.Context, request *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "")
+func (d Driver) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, missingAttr("ControllerGetVolume", req.GetVolumeId(), "VolumeId")
+	}
+
+	existingVolume, err := d.Storage.FindByID(ctx, req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ControllerGetVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	if existingVolume == nil {
+		return nil, status.Errorf(codes.NotFound, "ControllerGetVolume failed for %s: volume not present in storage backend", req.GetVolumeId())
+	}
+
+	nodes, condition, err := d.Assignments.Status(ctx, req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ControllerGetVolume failed for %s: failed to determine volume status: %v", req.GetVolumeId(), err)
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      existingVolume.ID,
+			CapacityBytes: existingVolume.SizeBytes,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: nodes,
+			VolumeCondition:  condition,
+		},
+	}, nil
+}
+
+// ControllerModifyVolume https://github.com/container-storage-interface/spec/blob/v1.9.0/spec.md#controllermodifyvolume
+func (d Driver) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, missingAttr("ControllerModifyVolume", req.GetVolumeId(), "VolumeId")
+	}
+
+	params, err := volume.NewMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "ControllerModifyVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	release, err := d.lockVolume("ControllerModifyVolume", req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	existingVolume, err := d.Storage.FindByID(ctx, req.GetVolumeId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ControllerModifyVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	if existingVolume == nil {
+		return nil, status.Errorf(codes.NotFound, "ControllerModifyVolume failed for %s: volume not present in storage backend", req.GetVolumeId())
+	}
+
+	err = d.Modifier.Modify(ctx, req.GetVolumeId(), params)
+	if err != nil {
+		var resync *client.ResyncInProgressError
+		if errors.As(err, &resync) {
+			// Migrating replicas waits on the resync, which can take hours. The sidecar retries until it completed.
+			return nil, status.Errorf(codes.Unavailable, "ControllerModifyVolume in progress for %s: %v", req.GetVolumeId(), err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "ControllerModifyVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
 }
 
 // Run the server.
@@ -1149,36 +1637,55 @@ func (d Driver) Run() error {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
+	d.log.WithFields(logrus.Fields{
+		"address": addr,
+	}).Info("server started")
+	return d.srv.Serve(listener)
+}
+
+// newServer creates the gRPC server of the driver. It is created with the driver, so Stop can be called at any time.
+func (d *Driver) newServer() *grpc.Server {
 	// type UnaryServerInterceptor func(ctx context.Context, req interface{}, info *UnaryServerInfo, handler UnaryHandler) (resp interface{}, err error)
 	errHandler := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		// Every log line written while handling the call carries the same correlation ID.
+		fields := requestFields(info.FullMethod, logging.NewCorrelationID(), req)
+		ctx = logging.WithFields(ctx, fields)
+
+		// All spans created while handling the call, including LINSTOR API requests, are children of this span.
+		ctx, span := tracing.Start(ctx, info.FullMethod, spanAttributes(fields)...)
+
 		resp, err := handler(ctx, req)
 
-		if err == nil {
-			d.log.WithFields(logrus.Fields{
-				"method": info.FullMethod,
-				"req":    fmt.Sprintf("%+v", req),
-				"resp":   fmt.Sprintf("%+v", resp),
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+		tracing.End(span, err)
+
+		metrics.ObserveRPC(info.FullMethod, status.Code(err), time.Since(start))
+
+		log := d.logger(ctx).WithField("duration", time.Since(start))
+
+		// Copying the messages to redact secrets is not free, only do it if the line is actually written.
+		switch {
+		case err != nil:
+			log.WithField("req", newLoggableMessage(req)).WithError(err).Error("method failed")
+		case log.Logger.IsLevelEnabled(logrus.DebugLevel):
+			log.WithFields(logrus.Fields{
+				"req":  newLoggableMessage(req),
+				"resp": newLoggableMessage(resp),
 			}).Debug("method called")
-		} else {
-			d.log.WithFields(logrus.Fields{
-				"method": info.FullMethod,
-				"req":    fmt.Sprintf("%+v", req),
-				"resp":   fmt.Sprintf("%+v", resp),
-			}).WithError(err).Error("method failed")
 		}
 
 		return resp, err
 	}
 
-	d.srv = grpc.NewServer(grpc.UnaryInterceptor(errHandler))
-	csi.RegisterIdentityServer(d.srv, d)
-	csi.RegisterControllerServer(d.srv, d)
-	csi.RegisterNodeServer(d.srv, d)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(errHandler))
+	csi.RegisterIdentityServer(srv, d)
+	csi.RegisterControllerServer(srv, d)
+	csi.RegisterNodeServer(srv, d)
+	csi.RegisterGroupControllerServer(srv, d)
 
-	d.log.WithFields(logrus.Fields{
-		"address": addr,
-	}).Info("server started")
-	return d.srv.Serve(listener)
+	return srv
 }
 
 // Stop the server.
@@ -1187,9 +1694,120 @@ func (d Driver) Stop() error {
 	return nil
 }
 
+// volFromVolViaSnapshot clones a volume by creating a temporary snapshot of the source, which is restored to the new
+// volume. This works with every storage pool that supports snapshots, but ZFS keeps the restored volume tied to the
+// snapshot, so the snapshot can't be deleted.
+func (d Driver) volFromVolViaSnapshot(ctx context.Context, sourceVol, info *volume.Info, params *volume.Parameters, req *csi.CreateVolumeRequest) error {
+	snap, err := d.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: snapshotForVolumeName(req.GetName()), SourceVolumeId: sourceVol.ID})
+	if err != nil {
+		return status.Errorf(codes.Internal, "CreateVolume failed for %s: failed to create snapshot for source volume: %v", req.GetName(), err)
+	}
+
+	if !snap.Snapshot.ReadyToUse {
+		return status.Errorf(codes.Internal, "CreateVolume failed for %s: snapshot not ready", req.GetName())
+	}
+
+	defer d.Snapshots.SnapDelete(ctx, snap.Snapshot)
+
+	err = d.Snapshots.VolFromSnap(ctx, snap.Snapshot, info, params, req.GetAccessibilityRequirements())
+	if err != nil {
+		d.failpathDelete(ctx, info.ID)
+
+		return status.Errorf(codes.Internal,
+			"CreateVolume failed for %s: %v", info.ID, err)
+	}
+
+	return nil
+}
+
+// provisionedByPlugin returns true if the volume was created by CreateVolume, or was already adopted.
+func provisionedByPlugin(vol *volume.Info) bool {
+	return strings.HasPrefix(vol.Properties[linstor.PropertyProvisioningCompletedBy], "linstor-csi")
+}
+
+// adoptVolume takes over an existing LINSTOR resource definition, either one referenced by a statically provisioned
+// PersistentVolume, or one requested by CreateVolume with the adopt parameter.
+//
+// The parameters, for static volumes read from the volume context, are stored on the resource definition together
+// with the filesystem type requested by the capabilities, so that staging and deleting the volume work the same as
+// for volumes created by CreateVolume.
+func (d Driver) adoptVolume(ctx context.Context, existingVolume *volume.Info, rawParams map[string]string, caps []*csi.VolumeCapability) error {
+	log := d.logger(ctx).WithField(logging.FieldVolume, existingVolume.ID)
+
+	fsType, err := fsTypeForCapabilities(caps)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to adopt volume %s: %v", existingVolume.ID, err)
+	}
+
+	if existingVolume.FsType != "" && fsType != "" && existingVolume.FsType != fsType {
+		return status.Errorf(codes.FailedPrecondition, "failed to adopt volume %s: FsType don't match: existing: '%s', requested: '%s'", existingVolume.ID, existingVolume.FsType, fsType)
+	}
+
+	_, err = volume.NewParameters(rawParams)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to adopt volume %s: failed to parse parameters: %v", existingVolume.ID, err)
+	}
+
+	log.WithField("parameters", rawParams).Info("adopting existing volume")
+
+	err = d.Storage.Adopt(ctx, &volume.Info{
+		ID:         existingVolume.ID,
+		FsType:     fsType,
+		Properties: map[string]string{linstor.PropertyProvisioningCompletedBy: "linstor-csi/" + Version},
+	}, rawParams)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to adopt volume %s: %v", existingVolume.ID, err)
+	}
+
+	return nil
+}
+
+// adoptExistingVolume takes over the existing resource definition requested by CreateVolume with the adopt parameter.
+// Retries find the volume already adopted and return the same result.
+func (d Driver) adoptExistingVolume(ctx context.Context, existingVolume *volume.Info, params *volume.Parameters, rawParams map[string]string, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	if req.GetVolumeContentSource() != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "CreateVolume failed for %s: adopted volumes can't have a content source", req.GetName())
+	}
+
+	if existingVolume == nil {
+		return nil, status.Errorf(codes.NotFound, "CreateVolume failed for %s: no resource definition to adopt", req.GetName())
+	}
+
+	if existingVolume.SizeBytes < req.GetCapacityRange().GetRequiredBytes() {
+		return nil, status.Errorf(codes.AlreadyExists,
+			"CreateVolume failed for %s: volume to adopt is smaller than requested (existing: %d, wanted: %d)",
+			existingVolume.ID, existingVolume.SizeBytes, req.GetCapacityRange().GetRequiredBytes())
+	}
+
+	if limit := req.GetCapacityRange().GetLimitBytes(); limit != 0 && existingVolume.SizeBytes > limit {
+		return nil, status.Errorf(codes.AlreadyExists,
+			"CreateVolume failed for %s: volume to adopt is larger than allowed (existing: %d, limit: %d)",
+			existingVolume.ID, existingVolume.SizeBytes, limit)
+	}
+
+	err := d.adoptVolume(ctx, existingVolume, rawParams, req.GetVolumeCapabilities())
+	if err != nil {
+		return nil, err
+	}
+
+	topos, err := d.Storage.AccessibleTopologies(ctx, existingVolume.ID, params)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "CreateVolume failed for %s: unable to determine volume topology: %v", existingVolume.ID, err)
+	}
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:           existingVolume.ID,
+			CapacityBytes:      existingVolume.SizeBytes,
+			AccessibleTopology: topos,
+			VolumeContext:      VolumeContextFromParameters(params).ToMap(),
+		},
+	}, nil
+}
+
 func (d Driver) createNewVolume(ctx context.Context, info *volume.Info, params *volume.Parameters, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
-	logger := d.log.WithFields(logrus.Fields{
-		"volume": info.ID,
+	logger := d.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: info.ID,
 	})
 
 	logger.WithFields(logrus.Fields{
@@ -1205,7 +1823,7 @@ func (d Driver) createNewVolume(ctx context.Context, info *volume.Info, params *
 				return nil, status.Errorf(codes.InvalidArgument,
 					"CreateVolume failed for %s: empty snapshotId", req.GetName())
 			}
-			logger.Debugf("pre-populate volume from snapshot: %+v", snapshotID)
+			logger.WithField(logging.FieldSnapshot, snapshotID).Debug("pre-populate volume from snapshot")
 
 			snap, _, err := d.Snapshots.FindSnapByID(ctx, snapshotID)
 			if err != nil {
@@ -1229,7 +1847,7 @@ func (d Driver) createNewVolume(ctx context.Context, info *volume.Info, params *
 				return nil, status.Errorf(codes.InvalidArgument,
 					"CreateVolume failed for %s: empty volumeId", req.GetName())
 			}
-			logger.Debugf("pre-populate volume from snapshot: %+v", volumeId)
+			logger.WithField("source", volumeId).Debug("pre-populate volume from volume")
 
 			sourceVol, err := d.Storage.FindByID(ctx, volumeId)
 			if err != nil {
@@ -1241,19 +1859,15 @@ func (d Driver) createNewVolume(ctx context.Context, info *volume.Info, params *
 					"CreateVolume failed for %s: source volume not found in storage backend", req.GetName())
 			}
 
-			snap, err := d.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: snapshotForVolumeName(req.GetName()), SourceVolumeId: sourceVol.ID})
-			if err != nil {
-				return nil, status.Errorf(codes.Internal, "CreateVolume failed for %s: failed to create snapshot for source volume: %v", req.GetName(), err)
-			}
-
-			if !snap.Snapshot.ReadyToUse {
-				return nil, status.Errorf(codes.Internal, "CreateVolume failed for %s: snapshot not ready", req.GetName())
-			}
-
-			defer d.Snapshots.SnapDelete(ctx, snap.Snapshot)
+			err = d.Storage.VolFromVol(ctx, sourceVol, info, params, req.GetAccessibilityRequirements())
+			if errors.Is(err, volume.ErrCloneNotSupported) {
+				logger.WithError(err).Info("native clone not possible, fall back to cloning via temporary snapshot")
 
-			err = d.Snapshots.VolFromSnap(ctx, snap.Snapshot, info, params, req.GetAccessibilityRequirements())
-			if err != nil {
+				err = d.volFromVolViaSnapshot(ctx, sourceVol, info, params, req)
+				if err != nil {
+					return nil, err
+				}
+			} else if err != nil {
 				d.failpathDelete(ctx, info.ID)
 
 				return nil, status.Errorf(codes.Internal,
@@ -1313,9 +1927,14 @@ func parseAsInt(s string) (int, error) {
 	return int(i), nil
 }
 
+// blockStagingPath returns the location of the bind mounted device for block volumes inside the staging path.
+func blockStagingPath(stagingPath string) string {
+	return filepath.Join(stagingPath, "device")
+}
+
 // Returns the name of the snapshot used to populate data in volume-from-volume scenarios
 func snapshotForVolumeName(name string) string {
-	return fmt.Sprintf("for-%s", name)
+	return linstor.TemporarySnapshotPrefix + name
 }
 
 // failpathDelete deletes volumes and logs if that fails. Mostly useful
@@ -1323,12 +1942,36 @@ func snapshotForVolumeName(name string) string {
 // possible error from trying to clean up from that original error.
 func (d Driver) failpathDelete(ctx context.Context, volId string) {
 	if err := d.Storage.Delete(ctx, volId); err != nil {
-		d.log.WithFields(logrus.Fields{
-			"volume": volId,
+		d.logger(ctx).WithFields(logrus.Fields{
+			logging.FieldVolume: volId,
 		}).WithError(err).Error("failed to clean up volume")
 	}
 }
 
+// validateAccessMode checks that the requested access mode is supported for the access type of the capability.
+//
+// RWX is only supported for block volumes: DRBD can be primary on two nodes for a short time, for example during a live
+// migration of a virtual machine, but there is no cluster filesystem that could be mounted on both nodes. RWX
+// filesystem volumes are supported if nfsExport is set: the filesystem is mounted on one node and exported over NFS to
+// all other nodes. The single node modes, such as ReadWriteOncePod, are handled like RWO.
+func validateAccessMode(cap *csi.VolumeCapability, nfsExport bool) error {
+	switch mode := cap.GetAccessMode().GetMode(); mode {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY:
+		return nil
+	case csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER:
+		if cap.GetBlock() == nil && !nfsExport {
+			return fmt.Errorf("access mode %s is only supported for block volumes, or filesystem volumes exported over NFS", mode)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("volumes support only RWO, RWOP, ROX and RWX (block, or filesystem exported over NFS) mode, got %s", mode)
+	}
+}
+
 func fsTypeForCapabilities(caps []*csi.VolumeCapability) (string, error) {
 	fsType := ""
 
@@ -1,21 +1,30 @@
 package driver
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
 	lapi "github.com/LINBIT/golinstor/client"
-	"github.com/kubernetes-csi/csi-test/v4/pkg/sanity"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-csi/csi-test/v5/pkg/sanity"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/piraeusdatastore/linstor-csi/pkg/client"
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
 	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
 var (
@@ -28,7 +37,8 @@ var (
 	logLevel              = flag.String("sanity.log-level", "debug", "how much logging to do")
 	rps                   = flag.Float64("sanity.linstor-api-requests-per-second", 0, "Maximum allowed number of LINSTOR API requests per second. Default: Unlimited")
 	burst                 = flag.Int("sanity.linstor-api-burst", 1, "Maximum number of API requests allowed before being limited by requests-per-second. Default: 1 (no bursting)")
-	junitfile             = flag.String("sanity.junitfile", "", "File to write the test results to")
+	// Kept so existing invocations of the sanity tests don't fail on an unknown flag.
+	_ = flag.String("sanity.junitfile", "", "Deprecated: ignored, csi-test v5 no longer writes JUnit reports")
 )
 
 func TestDriver(t *testing.T) {
@@ -117,8 +127,579 @@ func TestDriver(t *testing.T) {
 	cfg.TargetPath = mntDir + "/csi-target"
 	cfg.StagingPath = mntStageDir + "/csi-staging"
 	cfg.TestVolumeParametersFile = *paramsFile
-	cfg.JUnitFile = *junitfile
+	cfg.TestVolumeMutableParameters = map[string]string{linstor.ParameterNamespace + "/placementCount": "2"}
 
 	// Now call the test suite
 	sanity.Test(t, cfg)
 }
+
+func TestDriver_CreateVolume(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := NewDriver()
+	assert.NoError(t, err)
+
+	_, err = d.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:          "pvc-a",
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 << 30},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}},
+		Parameters: map[string]string{linstor.ParameterNamespace + "/placementPolicy": "Random"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "unknown placement policy")
+
+	vol, err := d.Storage.FindByID(ctx, "pvc-a")
+	assert.NoError(t, err)
+	assert.Nil(t, vol, "volume must not be created")
+}
+
+// blockingSnapshots blocks SnapCreate until unblocked.
+type blockingSnapshots struct {
+	volume.SnapshotCreateDeleter
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingSnapshots) SnapCreate(ctx context.Context, id, sourceVolId string, params *volume.SnapshotParameters) (*csi.Snapshot, error) {
+	b.started <- struct{}{}
+	<-b.unblock
+
+	return b.SnapshotCreateDeleter.SnapCreate(ctx, id, sourceVolId, params)
+}
+
+func TestDriver_CreateSnapshot(t *testing.T) {
+	d, err := NewDriver()
+	assert.NoError(t, err)
+
+	snaps := &blockingSnapshots{SnapshotCreateDeleter: d.Snapshots, started: make(chan struct{}), unblock: make(chan struct{})}
+	d.Snapshots = snaps
+
+	params := map[string]string{
+		linstor.SnapshotParameterNamespace + "/type":               "Linstor",
+		linstor.SnapshotParameterNamespace + "/remote-name":        "dr-cluster",
+		linstor.SnapshotParameterNamespace + "/linstor-target-url": "https://dr.example.com:3371",
+	}
+
+	done := make(chan error)
+
+	go func() {
+		_, err := d.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap-1", SourceVolumeId: "pvc-a", Parameters: params})
+		done <- err
+	}()
+
+	<-snaps.started
+
+	// Shipping another snapshot of the same volume at the same time could map the wrong LINSTOR snapshot.
+	_, err = d.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{Name: "snap-2", SourceVolumeId: "pvc-a", Parameters: params})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	// The source volume must not be changed while the snapshot is taken.
+	_, err = d.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "pvc-a"})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	close(snaps.unblock)
+	assert.NoError(t, <-done)
+}
+
+func TestDriver_CreateVolumeGroupSnapshot(t *testing.T) {
+	d, err := NewDriver()
+	assert.NoError(t, err)
+
+	_, err = d.CreateVolumeGroupSnapshot(context.Background(), &csi.CreateVolumeGroupSnapshotRequest{
+		Name:            "group-1",
+		SourceVolumeIds: []string{"pvc-a", "pvc-b", "pvc-a"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "duplicate source volume")
+}
+
+func TestValidateAccessMode(t *testing.T) {
+	t.Parallel()
+
+	mount := &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}
+	block := &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}
+
+	testcases := []struct {
+		name      string
+		mode      csi.VolumeCapability_AccessMode_Mode
+		block     bool
+		nfsExport bool
+		wantErr   bool
+	}{
+		{name: "rwo", mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		{name: "rwop", mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER},
+		{name: "single-node-multi-writer", mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER},
+		{name: "rox", mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY},
+		{name: "rwx-block", mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, block: true},
+		{name: "rwx-nfs", mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, nfsExport: true},
+		{name: "rwx-filesystem", mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, wantErr: true},
+		{name: "multi-node-single-writer", mode: csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER, wantErr: true},
+	}
+
+	for i := range testcases {
+		tc := &testcases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cap := &csi.VolumeCapability{AccessType: mount, AccessMode: &csi.VolumeCapability_AccessMode{Mode: tc.mode}}
+			if tc.block {
+				cap.AccessType = block
+			}
+
+			err := validateAccessMode(cap, tc.nfsExport)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDriver_adoptVolume(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := NewDriver()
+	assert.NoError(t, err)
+
+	// A volume created outside of CreateVolume, as referenced by a statically provisioned PersistentVolume.
+	err = d.Storage.Create(ctx, &volume.Info{ID: "legacy-volume", SizeBytes: 1 << 30}, nil, nil)
+	assert.NoError(t, err)
+
+	existing, err := d.Storage.FindByID(ctx, "legacy-volume")
+	assert.NoError(t, err)
+
+	mountCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "xfs"}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+
+	err = d.adoptVolume(ctx, existing, map[string]string{"linstor.csi.linbit.com/unknown": "true"}, []*csi.VolumeCapability{mountCap})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = d.adoptVolume(ctx, existing, ParametersFromVolumeContext(map[string]string{
+		"linstor.csi.linbit.com/mountOpts": "noatime",
+		"csi.storage.k8s.io/pv/name":       "legacy-pv",
+	}), []*csi.VolumeCapability{mountCap})
+	assert.NoError(t, err)
+
+	adopted, err := d.Storage.FindByID(ctx, "legacy-volume")
+	assert.NoError(t, err)
+	assert.Equal(t, "xfs", adopted.FsType)
+	assert.True(t, provisionedByPlugin(adopted))
+
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+
+	// Using a volume with filesystem as block device is fine, but changing the filesystem type is not.
+	err = d.adoptVolume(ctx, adopted, nil, []*csi.VolumeCapability{blockCap})
+	assert.NoError(t, err)
+
+	mountCap.GetMount().FsType = "ext4"
+	err = d.adoptVolume(ctx, adopted, nil, []*csi.VolumeCapability{mountCap})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestDriver_CreateVolume_Adopt(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := NewDriver()
+	assert.NoError(t, err)
+
+	err = d.Storage.Create(ctx, &volume.Info{ID: "legacy-volume", SizeBytes: 1 << 30}, nil, nil)
+	assert.NoError(t, err)
+
+	req := &csi.CreateVolumeRequest{
+		Name:          "legacy-volume",
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 << 30},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "xfs"}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}},
+		Parameters: map[string]string{
+			linstor.ParameterNamespace + "/adopt":     "true",
+			linstor.ParameterNamespace + "/mountOpts": "noatime",
+		},
+	}
+
+	resp, err := d.CreateVolume(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-volume", resp.GetVolume().GetVolumeId())
+	assert.Equal(t, int64(1<<30), resp.GetVolume().GetCapacityBytes())
+	assert.Equal(t, VolumeContextFromParameters(&volume.Parameters{MountOpts: "noatime"}).ToMap(), resp.GetVolume().GetVolumeContext())
+
+	adopted, err := d.Storage.FindByID(ctx, "legacy-volume")
+	assert.NoError(t, err)
+	assert.Equal(t, "xfs", adopted.FsType)
+	assert.True(t, provisionedByPlugin(adopted))
+
+	// Retries return the same volume.
+	retry, err := d.CreateVolume(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.GetVolume(), retry.GetVolume())
+
+	req.CapacityRange.RequiredBytes = 2 << 30
+	_, err = d.CreateVolume(ctx, req)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err), "volume too small")
+
+	req.Name = "missing-volume"
+	_, err = d.CreateVolume(ctx, req)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestDriver_EphemeralVolume(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := NewDriver(NodeID("node-1"))
+	assert.NoError(t, err)
+
+	target := filepath.Join(t.TempDir(), "target")
+	mountCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:         "csi-ephemeral",
+		TargetPath:       target,
+		VolumeCapability: mountCap,
+		VolumeContext: map[string]string{
+			VolumeContextEphemeral:        "true",
+			"csi.storage.k8s.io/pod.name": "pod",
+		},
+	}
+
+	_, err = d.NodePublishVolume(ctx, req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "no resource groups configured")
+
+	d, err = NewDriver(NodeID("node-1"), EphemeralResourceGroups([]string{"ephemeral", "ephemeral-replicated"}))
+	assert.NoError(t, err)
+
+	_, err = d.NodePublishVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "size is required")
+
+	req.VolumeContext[EphemeralSize] = "100Gi"
+
+	_, err = d.NodePublishVolume(ctx, req)
+	assert.Equal(t, codes.OutOfRange, status.Code(err), "size above limit")
+
+	req.VolumeContext[EphemeralSize] = "1Gi"
+	req.VolumeContext["linstor.csi.linbit.com/storagePool"] = "thin"
+
+	_, err = d.NodePublishVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "storage class parameters are not allowed")
+
+	delete(req.VolumeContext, "linstor.csi.linbit.com/storagePool")
+	req.VolumeContext[EphemeralResourceGroup] = "other"
+
+	_, err = d.NodePublishVolume(ctx, req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "resource group not in list")
+
+	req.VolumeContext[EphemeralResourceGroup] = "ephemeral-replicated"
+
+	_, err = d.NodePublishVolume(ctx, req)
+	assert.NoError(t, err)
+
+	vol, err := d.Storage.FindByID(ctx, "csi-ephemeral")
+	assert.NoError(t, err)
+	assert.NotNil(t, vol)
+	assert.Equal(t, int64(1<<30), vol.SizeBytes)
+	assert.Equal(t, "ext4", vol.FsType)
+	assert.Equal(t, linstor.CreatedForEphemeralVolume, vol.Properties[linstor.PropertyCreatedFor])
+	assert.Equal(t, "ephemeral-replicated", vol.ResourceGroup)
+	assert.FileExists(t, filepath.Join(filepath.Dir(target), ephemeralMarker))
+
+	assignment, err := d.Assignments.FindAssignmentOnNode(ctx, "csi-ephemeral", "node-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, assignment)
+
+	// Publishing again is idempotent.
+	_, err = d.NodePublishVolume(ctx, req)
+	assert.NoError(t, err)
+
+	_, err = d.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: "csi-ephemeral", TargetPath: target})
+	assert.NoError(t, err)
+
+	vol, err = d.Storage.FindByID(ctx, "csi-ephemeral")
+	assert.NoError(t, err)
+	assert.Nil(t, vol)
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(target), ephemeralMarker))
+
+	// Volumes are only removed if they were published as ephemeral volume on this target.
+	err = d.Storage.Create(ctx, &volume.Info{
+		ID:         "persistent",
+		SizeBytes:  1 << 30,
+		Properties: map[string]string{linstor.PropertyCreatedFor: linstor.CreatedForEphemeralVolume},
+	}, nil, nil)
+	assert.NoError(t, err)
+
+	_, err = d.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: "persistent", TargetPath: target})
+	assert.NoError(t, err)
+
+	vol, err = d.Storage.FindByID(ctx, "persistent")
+	assert.NoError(t, err)
+	assert.NotNil(t, vol)
+}
+
+// unmountRecorder records the paths passed to Unmount, and the files present in the staging path at that time.
+type unmountRecorder struct {
+	volume.Mounter
+	unmounted []string
+	files     [][]string
+}
+
+func (u *unmountRecorder) Unmount(target string) error {
+	entries, _ := os.ReadDir(target)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	u.unmounted = append(u.unmounted, target)
+	u.files = append(u.files, names)
+
+	return u.Mounter.Unmount(target)
+}
+
+func TestDriver_NodeUnstageVolume(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := NewDriver(NodeID("node-1"))
+	assert.NoError(t, err)
+
+	recorder := &unmountRecorder{Mounter: d.Mounter}
+	d.Mounter = recorder
+
+	err = d.Assignments.Attach(ctx, "pvc-a", "node-1", false, false)
+	assert.NoError(t, err)
+
+	mountCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+
+	staging := filepath.Join(t.TempDir(), "staging")
+
+	_, err = d.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          "pvc-a",
+		StagingTargetPath: staging,
+		VolumeCapability:  mountCap,
+		VolumeContext:     (&VolumeContext{}).ToMap(),
+	})
+	assert.NoError(t, err)
+
+	// A file created by the user at the root of the filesystem, which happens to match the block staging path.
+	err = os.WriteFile(filepath.Join(staging, "device"), []byte("user data"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = d.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{VolumeId: "pvc-a", StagingTargetPath: staging})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{staging}, recorder.unmounted)
+	assert.Equal(t, [][]string{{"device"}}, recorder.files, "user file must still exist when unmounting the filesystem")
+
+	recorder.unmounted = nil
+	recorder.files = nil
+
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+
+	_, err = d.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          "pvc-a",
+		StagingTargetPath: staging,
+		VolumeCapability:  blockCap,
+		VolumeContext:     (&VolumeContext{}).ToMap(),
+	})
+	assert.NoError(t, err)
+
+	_, err = d.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{VolumeId: "pvc-a", StagingTargetPath: staging})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(staging, "device"), staging}, recorder.unmounted)
+	assert.NoDirExists(t, staging)
+}
+
+func TestDriver_NFSExport(t *testing.T) {
+	ctx := context.Background()
+
+	exportRoot := t.TempDir()
+
+	d, err := NewDriver(NodeID("node-1"), NFSExportRoot(exportRoot))
+	assert.NoError(t, err)
+
+	err = d.Storage.Create(ctx, &volume.Info{
+		ID:         "pvc-a",
+		SizeBytes:  1 << 30,
+		Properties: map[string]string{linstor.PropertyProvisioningCompletedBy: "linstor-csi/" + Version},
+	}, nil, nil)
+	assert.NoError(t, err)
+
+	rwxCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+	}
+
+	_, err = d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         "pvc-a",
+		NodeId:           "node-1",
+		VolumeCapability: rwxCap,
+		VolumeContext:    (&VolumeContext{}).ToMap(),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "RWX filesystem requires NFS export")
+
+	volCtx := (&VolumeContext{NFSExport: true}).ToMap()
+
+	serverResp, err := d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         "pvc-a",
+		NodeId:           "node-1",
+		VolumeCapability: rwxCap,
+		VolumeContext:    volCtx,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		linstor.PublishedReadOnlyKey:  "false",
+		linstor.PublishedNFSServerKey: "node-1.example.com",
+		linstor.PublishedNFSExportKey: "true",
+	}, serverResp.GetPublishContext())
+
+	clientResp, err := d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         "pvc-a",
+		NodeId:           "node-2",
+		VolumeCapability: rwxCap,
+		VolumeContext:    volCtx,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		linstor.PublishedReadOnlyKey:  "false",
+		linstor.PublishedNFSServerKey: "node-1.example.com",
+	}, clientResp.GetPublishContext())
+
+	// Only the NFS server attaches the volume.
+	assignment, err := d.Assignments.FindAssignmentOnNode(ctx, "pvc-a", "node-2")
+	assert.NoError(t, err)
+	assert.Nil(t, assignment)
+
+	staging := filepath.Join(t.TempDir(), "staging")
+	exportPath := filepath.Join(exportRoot, "pvc-a")
+
+	_, err = d.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          "pvc-a",
+		StagingTargetPath: staging,
+		VolumeCapability:  rwxCap,
+		PublishContext:    serverResp.GetPublishContext(),
+		VolumeContext:     volCtx,
+	})
+	assert.NoError(t, err)
+	assert.DirExists(t, exportPath)
+	assert.DirExists(t, staging)
+
+	// The export does not depend on the volume being used on the server node.
+	_, err = d.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{VolumeId: "pvc-a", StagingTargetPath: staging})
+	assert.NoError(t, err)
+	assert.NoDirExists(t, staging)
+	assert.DirExists(t, exportPath)
+
+	_, err = d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: "pvc-a", NodeId: "node-1"})
+	assert.NoError(t, err)
+
+	assignment, err = d.Assignments.FindAssignmentOnNode(ctx, "pvc-a", "node-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, assignment, "server stays attached while node-2 uses the volume")
+
+	d.reconcileNFS(ctx)
+	assert.DirExists(t, exportPath)
+
+	// The server has to stop serving before it can be detached.
+	_, err = d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: "pvc-a", NodeId: "node-2"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	d.reconcileNFS(ctx)
+	assert.NoDirExists(t, exportPath)
+
+	_, err = d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: "pvc-a", NodeId: "node-2"})
+	assert.NoError(t, err)
+
+	assignment, err = d.Assignments.FindAssignmentOnNode(ctx, "pvc-a", "node-1")
+	assert.NoError(t, err)
+	assert.Nil(t, assignment)
+}
+
+func TestDriver_NFSFailover(t *testing.T) {
+	ctx := context.Background()
+
+	// The mock storage considers nodes named "fake-node-id" offline.
+	server, err := NewDriver(NodeID("fake-node-id-1"), NFSExportRoot(t.TempDir()))
+	assert.NoError(t, err)
+
+	err = server.Storage.Create(ctx, &volume.Info{
+		ID:         "pvc-a",
+		SizeBytes:  1 << 30,
+		Properties: map[string]string{linstor.PropertyProvisioningCompletedBy: "linstor-csi/" + Version},
+	}, nil, nil)
+	assert.NoError(t, err)
+
+	volCtx := (&VolumeContext{NFSExport: true}).ToMap()
+	rwxCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+	}
+
+	// The server was chosen while fake-node-id-1 was still online.
+	_, _, err = server.NFS.NFSServer(ctx, "pvc-a", "fake-node-id-1")
+	assert.NoError(t, err)
+
+	for _, node := range []string{"node-2", "node-3"} {
+		_, err := server.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+			VolumeId:         "pvc-a",
+			NodeId:           node,
+			VolumeCapability: rwxCap,
+			VolumeContext:    volCtx,
+		})
+		assert.NoError(t, err)
+	}
+
+	// A node that is not a client never takes over.
+	other := *server
+	other.nodeID = "node-4"
+	other.nfsExportRoot = t.TempDir()
+	other.reconcileNFS(ctx)
+	assert.NoDirExists(t, other.nfsExportPath("pvc-a"))
+
+	client := *server
+	client.nodeID = "node-2"
+	client.nfsExportRoot = t.TempDir()
+	client.reconcileNFS(ctx)
+	assert.DirExists(t, client.nfsExportPath("pvc-a"))
+
+	vol, err := server.NFS.NFSVolume(ctx, "pvc-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "node-2", vol.Server)
+
+	// node-3 keeps using node-2, which is online.
+	third := *server
+	third.nodeID = "node-3"
+	third.nfsExportRoot = t.TempDir()
+	third.reconcileNFS(ctx)
+	assert.NoDirExists(t, third.nfsExportPath("pvc-a"))
+}
+
+func TestDriver_GetCapacity(t *testing.T) {
+	d, err := NewDriver()
+	assert.NoError(t, err)
+
+	resp, err := d.GetCapacity(context.Background(), &csi.GetCapacityRequest{
+		Parameters: map[string]string{"linstor.csi.linbit.com/storagePool": "thin"},
+		AccessibleTopology: &csi.Topology{
+			Segments: map[string]string{topology.LinstorNodeKey: "node-1"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50000000), resp.GetAvailableCapacity())
+	assert.Equal(t, int64(50000000), resp.GetMaximumVolumeSize().GetValue())
+	assert.Equal(t, int64(volume.MinimumSizeBytes), resp.GetMinimumVolumeSize().GetValue())
+}
@@ -0,0 +1,216 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+const (
+	// VolumeContextEphemeral is set by Kubernetes in the volume context of CSI ephemeral inline volumes.
+	VolumeContextEphemeral = "csi.storage.k8s.io/ephemeral"
+	// EphemeralSize is the volume attribute setting the size of an ephemeral inline volume, for example "1Gi".
+	EphemeralSize = linstor.ParameterNamespace + "/size"
+	// EphemeralResourceGroup is the volume attribute selecting one of the resource groups configured for ephemeral
+	// inline volumes.
+	EphemeralResourceGroup = linstor.ParameterNamespace + "/resourceGroup"
+	// DefaultEphemeralMaxSize is the default limit for the size of ephemeral inline volumes.
+	DefaultEphemeralMaxSize = 10 << 30
+
+	// ephemeralMarker is the file created next to the target path of ephemeral volumes, containing the LINSTOR
+	// volume id. Kubernetes does not tell NodeUnpublishVolume if the volume was ephemeral.
+	ephemeralMarker = "linstor-ephemeral"
+
+	// podInfoPrefix is the prefix of the pod information Kubernetes adds to the volume context.
+	podInfoPrefix = "csi.storage.k8s.io/"
+)
+
+func isEphemeral(volCtx map[string]string) bool {
+	return volCtx[VolumeContextEphemeral] == "true"
+}
+
+func ephemeralMarkerPath(targetPath string) string {
+	return filepath.Join(filepath.Dir(targetPath), ephemeralMarker)
+}
+
+// ephemeralVolumeId returns the LINSTOR resource name for an ephemeral volume. Kubernetes generates volume ids for
+// ephemeral volumes that are too long for LINSTOR.
+func (d Driver) ephemeralVolumeId(volumeId string) string {
+	return d.Storage.CompatibleVolumeId(volumeId, "", "")
+}
+
+// nodePublishEphemeral creates the volume described by the volume attributes, makes it available on the local node
+// and mounts it at the target path. Ephemeral volumes are never staged.
+func (d Driver) nodePublishEphemeral(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	mnt := req.GetVolumeCapability().GetMount()
+	if mnt == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: ephemeral volumes require access type mount", req.GetVolumeId())
+	}
+
+	// Volume attributes are controlled by anyone who can create pods, so they may only pick the size and one of the
+	// resource groups configured by the administrator.
+	for k := range req.GetVolumeContext() {
+		if k != EphemeralSize && k != EphemeralResourceGroup && !strings.HasPrefix(k, podInfoPrefix) {
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: attribute '%s' is not supported for ephemeral volumes", req.GetVolumeId(), k)
+		}
+	}
+
+	if len(d.ephemeralResourceGroups) == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "NodePublishVolume failed for %s: no resource groups configured for ephemeral volumes", req.GetVolumeId())
+	}
+
+	rg := d.ephemeralResourceGroups[0]
+	if v, ok := req.GetVolumeContext()[EphemeralResourceGroup]; ok {
+		if !slices.Contains(d.ephemeralResourceGroups, v) {
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: resource group '%s' is not allowed for ephemeral volumes, choose from %v", req.GetVolumeId(), v, d.ephemeralResourceGroups)
+		}
+
+		rg = v
+	}
+
+	rawSize, ok := req.GetVolumeContext()[EphemeralSize]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: ephemeral volumes require the '%s' attribute", req.GetVolumeId(), EphemeralSize)
+	}
+
+	size, err := resource.ParseQuantity(rawSize)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: invalid size '%s': %v", req.GetVolumeId(), rawSize, err)
+	}
+
+	if size.Value() > d.ephemeralMaxSize {
+		return nil, status.Errorf(codes.OutOfRange, "NodePublishVolume failed for %s: size %s exceeds the limit of %d bytes for ephemeral volumes", req.GetVolumeId(), rawSize, d.ephemeralMaxSize)
+	}
+
+	params, err := d.Storage.ResourceGroupParameters(ctx, rg)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	fsType := "ext4"
+	if mnt.GetFsType() != "" {
+		fsType = mnt.GetFsType()
+	}
+
+	volId := d.ephemeralVolumeId(req.GetVolumeId())
+
+	// The marker is written first, so a volume that was partially created is still removed on unpublish.
+	err = os.WriteFile(ephemeralMarkerPath(req.GetTargetPath()), []byte(volId), 0o600)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: failed to mark volume as ephemeral: %v", req.GetVolumeId(), err)
+	}
+
+	existingVolume, err := d.Storage.FindByID(ctx, volId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	if existingVolume != nil && existingVolume.Properties[linstor.PropertyCreatedFor] != linstor.CreatedForEphemeralVolume {
+		return nil, status.Errorf(codes.AlreadyExists, "NodePublishVolume failed for %s: volume %s exists, but is not an ephemeral volume", req.GetVolumeId(), volId)
+	}
+
+	if existingVolume == nil {
+		requiredKiB, err := d.Storage.AllocationSizeKiB(size.Value(), 0)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+		}
+
+		info := &volume.Info{
+			ID:            volId,
+			SizeBytes:     requiredKiB << 10,
+			ResourceGroup: params.ResourceGroup,
+			FsType:        fsType,
+			Properties: map[string]string{
+				linstor.PropertyProvisioningCompletedBy: "linstor-csi/" + Version,
+				linstor.PropertyCreatedFor:              linstor.CreatedForEphemeralVolume,
+			},
+		}
+
+		// Prefer a local replica, but let the scheduler fall back to other nodes, the volume is attached below.
+		local := []*csi.Topology{{Segments: map[string]string{topology.LinstorNodeKey: d.nodeID}}}
+
+		err = d.Storage.Create(ctx, info, params, &csi.TopologyRequirement{Preferred: local})
+		if err != nil {
+			d.failpathDelete(ctx, volId)
+			return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: failed to create volume: %v", req.GetVolumeId(), err)
+		}
+	}
+
+	err = d.Assignments.Attach(ctx, volId, d.nodeID, req.GetReadonly(), false)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: failed to attach volume: %v", req.GetVolumeId(), err)
+	}
+
+	assignment, err := d.Assignments.FindAssignmentOnNode(ctx, volId, d.nodeID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	if assignment == nil {
+		return nil, status.Errorf(codes.NotFound, "NodePublishVolume failed for %s: assignment not found", req.GetVolumeId())
+	}
+
+	mountOpts := append(VolumeContextFromParameters(params).MountOptions, mnt.GetMountFlags()...)
+
+	err = d.Mounter.Mount(ctx, assignment.Path, req.GetTargetPath(), fsType, req.GetReadonly(), mountOpts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// removeIfEphemeral deletes the volume if it was published as ephemeral inline volume at the target path. The caller
+// must already have unmounted the volume.
+func (d Driver) removeIfEphemeral(ctx context.Context, targetPath string) error {
+	markerPath := ephemeralMarkerPath(targetPath)
+
+	content, err := os.ReadFile(markerPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to check for ephemeral volume: %w", err)
+	}
+
+	volId := string(content)
+
+	info, err := d.Storage.FindByID(ctx, volId)
+	if err != nil {
+		return fmt.Errorf("failed to check for ephemeral volume: %w", err)
+	}
+
+	// Never remove a volume that was not created for an ephemeral volume, even if the marker says so.
+	if info != nil && info.Properties[linstor.PropertyCreatedFor] == linstor.CreatedForEphemeralVolume {
+		d.logger(ctx).WithField(logging.FieldVolume, volId).Info("removing ephemeral volume")
+
+		err := d.Storage.Delete(ctx, volId)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Kubernetes removes the directory holding the target path after unpublishing, which fails if it is not empty.
+	err = os.Remove(markerPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove ephemeral volume marker: %w", err)
+	}
+
+	return nil
+}
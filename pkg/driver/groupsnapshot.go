@@ -0,0 +1,143 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/client"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+// GroupControllerGetCapabilities https://github.com/container-storage-interface/spec/blob/v1.9.0/spec.md#groupcontrollergetcapabilities
+func (d Driver) GroupControllerGetCapabilities(ctx context.Context, req *csi.GroupControllerGetCapabilitiesRequest) (*csi.GroupControllerGetCapabilitiesResponse, error) {
+	return &csi.GroupControllerGetCapabilitiesResponse{
+		Capabilities: []*csi.GroupControllerServiceCapability{
+			{Type: &csi.GroupControllerServiceCapability_Rpc{
+				Rpc: &csi.GroupControllerServiceCapability_RPC{
+					Type: csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+				},
+			}},
+		},
+	}, nil
+}
+
+// CreateVolumeGroupSnapshot https://github.com/container-storage-interface/spec/blob/v1.9.0/spec.md#createvolumegroupsnapshot
+func (d Driver) CreateVolumeGroupSnapshot(ctx context.Context, req *csi.CreateVolumeGroupSnapshotRequest) (*csi.CreateVolumeGroupSnapshotResponse, error) {
+	if req.GetName() == "" {
+		return nil, missingAttr("CreateVolumeGroupSnapshot", req.GetName(), "Name")
+	}
+
+	if len(req.GetSourceVolumeIds()) == 0 {
+		return nil, missingAttr("CreateVolumeGroupSnapshot", req.GetName(), "SourceVolumeIds")
+	}
+
+	for i, volId := range req.GetSourceVolumeIds() {
+		if slices.Contains(req.GetSourceVolumeIds()[:i], volId) {
+			return nil, status.Errorf(codes.InvalidArgument, "CreateVolumeGroupSnapshot failed for %s: source volume %s is listed more than once", req.GetName(), volId)
+		}
+	}
+
+	params, err := volume.NewSnapshotParameters(req.GetParameters(), req.GetSecrets())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid group snapshot parameters: %v", err)
+	}
+
+	if params.Type != volume.SnapshotTypeInCluster {
+		return nil, status.Errorf(codes.InvalidArgument, "group snapshots of type `%s` are not supported", params.Type)
+	}
+
+	id := d.GroupSnapshots.CompatibleGroupSnapshotId(req.GetName())
+
+	ctx = logging.WithFields(ctx, logrus.Fields{logging.FieldSnapshot: id})
+
+	release, err := d.lockSnapshot("CreateVolumeGroupSnapshot", id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Every source volume is locked, so no other operation modifies them while the snapshots are taken.
+	for _, volId := range req.GetSourceVolumeIds() {
+		releaseVol, err := d.lockVolume("CreateVolumeGroupSnapshot", volId)
+		if err != nil {
+			return nil, err
+		}
+		defer releaseVol()
+
+		vol, err := d.Storage.FindByID(ctx, volId)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to find source volume %s: %v", volId, err)
+		}
+
+		if vol == nil {
+			return nil, status.Errorf(codes.NotFound, "source volume %s does not exist", volId)
+		}
+	}
+
+	group, err := d.GroupSnapshots.GroupSnapCreate(ctx, id, req.GetSourceVolumeIds(), params)
+	if err != nil {
+		var mismatch *client.GroupSnapshotMismatchError
+		if errors.As(err, &mismatch) {
+			return nil, status.Errorf(codes.AlreadyExists, "failed to create group snapshot: %v", err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to create group snapshot: %v", err)
+	}
+
+	return &csi.CreateVolumeGroupSnapshotResponse{GroupSnapshot: group}, nil
+}
+
+// DeleteVolumeGroupSnapshot https://github.com/container-storage-interface/spec/blob/v1.9.0/spec.md#deletevolumegroupsnapshot
+func (d Driver) DeleteVolumeGroupSnapshot(ctx context.Context, req *csi.DeleteVolumeGroupSnapshotRequest) (*csi.DeleteVolumeGroupSnapshotResponse, error) {
+	if req.GetGroupSnapshotId() == "" {
+		return nil, missingAttr("DeleteVolumeGroupSnapshot", req.GetGroupSnapshotId(), "GroupSnapshotId")
+	}
+
+	release, err := d.lockSnapshot("DeleteVolumeGroupSnapshot", req.GetGroupSnapshotId())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	err = d.GroupSnapshots.GroupSnapDelete(ctx, req.GetGroupSnapshotId(), req.GetSnapshotIds())
+	if err != nil {
+		var mismatch *client.GroupSnapshotMismatchError
+		if errors.As(err, &mismatch) {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to delete group snapshot: %v", err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to delete group snapshot %s: %v", req.GetGroupSnapshotId(), err)
+	}
+
+	return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+}
+
+// GetVolumeGroupSnapshot https://github.com/container-storage-interface/spec/blob/v1.9.0/spec.md#getvolumegroupsnapshot
+func (d Driver) GetVolumeGroupSnapshot(ctx context.Context, req *csi.GetVolumeGroupSnapshotRequest) (*csi.GetVolumeGroupSnapshotResponse, error) {
+	if req.GetGroupSnapshotId() == "" {
+		return nil, missingAttr("GetVolumeGroupSnapshot", req.GetGroupSnapshotId(), "GroupSnapshotId")
+	}
+
+	group, ok, err := d.GroupSnapshots.GroupSnapGet(ctx, req.GetGroupSnapshotId(), req.GetSnapshotIds())
+	if err != nil {
+		var mismatch *client.GroupSnapshotMismatchError
+		if errors.As(err, &mismatch) {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to get group snapshot: %v", err)
+		}
+
+		return nil, status.Errorf(codes.Internal, "failed to get group snapshot %s: %v", req.GetGroupSnapshotId(), err)
+	}
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "group snapshot %s does not exist", req.GetGroupSnapshotId())
+	}
+
+	return &csi.GetVolumeGroupSnapshotResponse{GroupSnapshot: group}, nil
+}
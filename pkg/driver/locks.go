@@ -0,0 +1,65 @@
+package driver
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// operationLocks keeps track of volumes and snapshots that have an operation in flight.
+//
+// The CSI spec requires plugins to return Aborted if an operation for the same volume is already in progress, instead
+// of waiting for it to complete. The CO will retry the call later.
+type operationLocks struct {
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+}
+
+func newOperationLocks() *operationLocks {
+	return &operationLocks{inFlight: make(map[string]struct{})}
+}
+
+// tryAcquire marks the key as in flight. It returns false if the key is already in flight.
+func (o *operationLocks) tryAcquire(key string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.inFlight[key]; ok {
+		return false
+	}
+
+	o.inFlight[key] = struct{}{}
+
+	return true
+}
+
+// release removes the key from the in flight operations.
+func (o *operationLocks) release(key string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.inFlight, key)
+}
+
+// lockVolume ensures only one operation is in flight for the volume. The returned function must be called once the
+// operation completes.
+func (d Driver) lockVolume(method, volId string) (func(), error) {
+	return d.lockOperation(method, "volume", volId)
+}
+
+// lockSnapshot ensures only one operation is in flight for the snapshot. The returned function must be called once
+// the operation completes.
+func (d Driver) lockSnapshot(method, snapId string) (func(), error) {
+	return d.lockOperation(method, "snapshot", snapId)
+}
+
+func (d Driver) lockOperation(method, kind, id string) (func(), error) {
+	key := kind + "/" + id
+
+	if !d.locks.tryAcquire(key) {
+		return nil, status.Errorf(codes.Aborted, "%s failed for %s: an operation for this %s is already in progress", method, id, kind)
+	}
+
+	return func() { d.locks.release(key) }, nil
+}
@@ -0,0 +1,32 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDriver_lockVolume(t *testing.T) {
+	d, err := NewDriver()
+	assert.NoError(t, err)
+
+	release, err := d.lockVolume("CreateVolume", "pvc-1")
+	assert.NoError(t, err)
+
+	_, err = d.lockVolume("DeleteVolume", "pvc-1")
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	// Snapshots and volumes with the same ID don't conflict.
+	releaseSnap, err := d.lockSnapshot("CreateSnapshot", "pvc-1")
+	assert.NoError(t, err)
+
+	releaseSnap()
+	release()
+
+	release, err = d.lockVolume("DeleteVolume", "pvc-1")
+	assert.NoError(t, err)
+
+	release()
+}
@@ -0,0 +1,172 @@
+package driver
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	protov1 "github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+)
+
+// logger returns the driver's logger with the request scoped fields from the context.
+func (d Driver) logger(ctx context.Context) *logrus.Entry {
+	return logging.FromContext(ctx, d.log)
+}
+
+// requestFields returns the log fields identifying the call and the objects a CSI request refers to.
+func requestFields(method, correlationID string, req interface{}) logrus.Fields {
+	fields := logrus.Fields{
+		logging.FieldMethod:        method,
+		logging.FieldCorrelationID: correlationID,
+	}
+
+	if r, ok := req.(interface{ GetVolumeId() string }); ok {
+		fields[logging.FieldVolume] = r.GetVolumeId()
+	}
+
+	if r, ok := req.(interface{ GetSnapshotId() string }); ok {
+		fields[logging.FieldSnapshot] = r.GetSnapshotId()
+	}
+
+	if r, ok := req.(interface{ GetNodeId() string }); ok {
+		fields[logging.FieldNode] = r.GetNodeId()
+	}
+
+	// CreateSnapshot only has the name of the new snapshot, and the volume it is taken from.
+	if r, ok := req.(*csi.CreateSnapshotRequest); ok {
+		fields[logging.FieldVolume] = r.GetSourceVolumeId()
+	}
+
+	return fields
+}
+
+// spanAttributes converts the request fields to attributes of the span tracing the call.
+func spanAttributes(fields logrus.Fields) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(fields))
+
+	for k, v := range fields {
+		if s, ok := v.(string); ok && s != "" {
+			attrs = append(attrs, attribute.String(k, s))
+		}
+	}
+
+	return attrs
+}
+
+// redactedPlaceholder replaces the value of secret fields in logged messages.
+const redactedPlaceholder = "***stripped***"
+
+// loggableMessage wraps a CSI request or response for structured logging. All secrets are replaced by a placeholder.
+//
+// The text formatter uses the String method, the JSON formatter embeds the message as JSON object.
+type loggableMessage struct {
+	msg proto.Message
+}
+
+// newLoggableMessage returns a copy of the given message that is safe to log. Values that are not protobuf messages
+// are not logged at all, as we can't tell which of their fields are secret.
+func newLoggableMessage(v interface{}) *loggableMessage {
+	m, ok := v.(protov1.Message)
+	if !ok || m == nil {
+		return nil
+	}
+
+	m2 := protov1.MessageV2(m)
+	if !m2.ProtoReflect().IsValid() {
+		return nil
+	}
+
+	clone := proto.Clone(m2)
+	stripSecrets(clone.ProtoReflect())
+
+	return &loggableMessage{msg: clone}
+}
+
+func (l *loggableMessage) String() string {
+	if l == nil {
+		return "<nil>"
+	}
+
+	b, err := protojson.Marshal(l.msg)
+	if err != nil {
+		return "<unprintable: " + err.Error() + ">"
+	}
+
+	return string(b)
+}
+
+func (l *loggableMessage) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("null"), nil
+	}
+
+	return protojson.Marshal(l.msg)
+}
+
+// stripSecrets replaces all secret values in the message with a placeholder.
+//
+// A field is considered secret if it is marked with the csi_secret option in the CSI spec, or if it is a map named
+// "secrets", in case a message does not carry the option.
+func stripSecrets(msg protoreflect.Message) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case isSecretField(fd):
+			redactField(msg, fd, v)
+		case fd.IsMap():
+			if fd.MapValue().Kind() == protoreflect.MessageKind {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					stripSecrets(mv.Message())
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Kind() == protoreflect.MessageKind {
+				list := v.List()
+				for i := 0; i < list.Len(); i++ {
+					stripSecrets(list.Get(i).Message())
+				}
+			}
+		case fd.Kind() == protoreflect.MessageKind:
+			stripSecrets(v.Message())
+		}
+
+		return true
+	})
+}
+
+func isSecretField(fd protoreflect.FieldDescriptor) bool {
+	if fd.IsMap() && fd.Name() == "secrets" {
+		return true
+	}
+
+	opts := fd.Options()
+	if opts == nil {
+		return false
+	}
+
+	secret, ok := proto.GetExtension(opts, csi.E_CsiSecret).(bool)
+
+	return ok && secret
+}
+
+func redactField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value) {
+	switch {
+	case fd.IsMap() && fd.MapValue().Kind() == protoreflect.StringKind:
+		m := v.Map()
+		m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			m.Set(k, protoreflect.ValueOfString(redactedPlaceholder))
+			return true
+		})
+	case !fd.IsList() && fd.Kind() == protoreflect.StringKind:
+		msg.Set(fd, protoreflect.ValueOfString(redactedPlaceholder))
+	default:
+		// We don't know how to replace this with a placeholder, so we drop it entirely.
+		msg.Clear(fd)
+	}
+}
@@ -0,0 +1,67 @@
+package driver
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+)
+
+func TestNewLoggableMessage(t *testing.T) {
+	req := &csi.CreateSnapshotRequest{
+		SourceVolumeId: "pvc-1",
+		Name:           "snapshot-1",
+		Secrets:        map[string]string{"access-key": "ACCESS", "secret-key": "SECRET"},
+		Parameters:     map[string]string{"snap.linstor.csi.linbit.com/type": "S3"},
+	}
+
+	msg := newLoggableMessage(req)
+
+	assert.NotContains(t, msg.String(), "ACCESS")
+	assert.NotContains(t, msg.String(), "SECRET")
+	assert.Contains(t, msg.String(), "snapshot-1")
+
+	var decoded map[string]interface{}
+	b, err := json.Marshal(msg)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, map[string]interface{}{"access-key": redactedPlaceholder, "secret-key": redactedPlaceholder}, decoded["secrets"])
+	assert.Equal(t, "pvc-1", decoded["sourceVolumeId"])
+
+	// The original request must not be modified.
+	assert.Equal(t, "SECRET", req.Secrets["secret-key"])
+
+	// Secrets nested in other messages are also redacted.
+	nested := newLoggableMessage(&csi.ControllerPublishVolumeRequest{
+		VolumeId: "pvc-1",
+		Secrets:  map[string]string{"password": "hunter2"},
+	})
+	assert.NotContains(t, nested.String(), "hunter2")
+
+	var nilResp *csi.CreateVolumeResponse
+	assert.Nil(t, newLoggableMessage(nilResp))
+	assert.Nil(t, newLoggableMessage("not a message"))
+}
+
+func TestRequestFields(t *testing.T) {
+	fields := requestFields("/csi.v1.Controller/ControllerPublishVolume", "1234", &csi.ControllerPublishVolumeRequest{
+		VolumeId: "pvc-1",
+		NodeId:   "node-1",
+	})
+	assert.Equal(t, logrus.Fields{
+		logging.FieldMethod:        "/csi.v1.Controller/ControllerPublishVolume",
+		logging.FieldCorrelationID: "1234",
+		logging.FieldVolume:        "pvc-1",
+		logging.FieldNode:          "node-1",
+	}, fields)
+
+	fields = requestFields("/csi.v1.Controller/CreateSnapshot", "1234", &csi.CreateSnapshotRequest{SourceVolumeId: "pvc-1", Name: "snap-1"})
+	assert.Equal(t, "pvc-1", fields[logging.FieldVolume])
+
+	fields = requestFields("/csi.v1.Controller/DeleteSnapshot", "1234", &csi.DeleteSnapshotRequest{SnapshotId: "snap-1"})
+	assert.Equal(t, "snap-1", fields[logging.FieldSnapshot])
+}
@@ -0,0 +1,328 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+// DefaultNFSExportRoot is the directory where volumes exported over NFS are mounted on the NFS server node.
+const DefaultNFSExportRoot = "/var/lib/linstor-csi/nfs"
+
+// usesNFSExport returns true if the volume is shared with other nodes over NFS instead of attaching it to every node.
+// Only filesystem volumes with multi-node write access are exported, all other access modes use DRBD directly.
+func usesNFSExport(volCtx *VolumeContext, cap *csi.VolumeCapability) bool {
+	if volCtx == nil || !volCtx.NFSExport {
+		return false
+	}
+
+	return cap.GetMount() != nil && cap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+}
+
+// controllerPublishNFS publishes a volume shared over NFS. Only the NFS server node attaches the DRBD device, all nodes
+// receive the address to mount the export from. The node is recorded as client, so the server keeps serving the
+// volume until all clients are unpublished.
+func (d Driver) controllerPublishNFS(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	server, address, err := d.NFS.NFSServer(ctx, req.GetVolumeId(), req.GetNodeId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ControllerPublishVolume failed for %s: failed to determine NFS server: %v", req.GetVolumeId(), err)
+	}
+
+	d.logger(ctx).WithFields(logrus.Fields{
+		logging.FieldVolume: req.GetVolumeId(),
+		logging.FieldNode:   req.GetNodeId(),
+		"nfsServer":         server,
+	}).Debug("publishing volume over NFS")
+
+	err = d.NFS.AddNFSClient(ctx, req.GetVolumeId(), req.GetNodeId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ControllerPublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	publishContext := map[string]string{
+		linstor.PublishedReadOnlyKey:  strconv.FormatBool(req.GetReadonly()),
+		linstor.PublishedNFSServerKey: address,
+	}
+
+	if server != req.GetNodeId() {
+		return &csi.ControllerPublishVolumeResponse{PublishContext: publishContext}, nil
+	}
+
+	// The server needs write access to the volume, even if the pods on the server node only read from it.
+	err = d.Assignments.Attach(ctx, req.GetVolumeId(), req.GetNodeId(), false, false)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ControllerPublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	publishContext[linstor.PublishedNFSExportKey] = "true"
+
+	return &csi.ControllerPublishVolumeResponse{PublishContext: publishContext}, nil
+}
+
+// controllerUnpublishNFS removes the node from the clients of a volume shared over NFS. It returns false if the volume
+// is not shared over NFS.
+//
+// The server stays attached while other clients use the volume. Once the last client is removed, the server is
+// detached after it stopped serving the volume, which happens on the next run of RunNFSServer on the server node.
+func (d Driver) controllerUnpublishNFS(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (bool, error) {
+	err := d.NFS.RemoveNFSClient(ctx, req.GetVolumeId(), req.GetNodeId())
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "ControllerUnpublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	vol, err := d.NFS.NFSVolume(ctx, req.GetVolumeId())
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "ControllerUnpublishVolume failed for %s: %v", req.GetVolumeId(), err)
+	}
+
+	if vol == nil {
+		return false, nil
+	}
+
+	if len(vol.Clients) > 0 {
+		if vol.Server == req.GetNodeId() {
+			d.logger(ctx).WithFields(logrus.Fields{
+				logging.FieldVolume: req.GetVolumeId(),
+				logging.FieldNode:   req.GetNodeId(),
+				"nfsClients":        vol.Clients,
+			}).Info("keeping NFS server attached for remaining clients")
+
+			return true, nil
+		}
+
+		return true, d.detach(ctx, req.GetVolumeId(), req.GetNodeId())
+	}
+
+	if vol.ServerInUse {
+		return true, status.Errorf(codes.Unavailable, "ControllerUnpublishVolume failed for %s: waiting for NFS server %s to stop serving the volume", req.GetVolumeId(), vol.Server)
+	}
+
+	if vol.Server != "" && vol.Server != req.GetNodeId() {
+		err := d.detach(ctx, req.GetVolumeId(), vol.Server)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, d.detach(ctx, req.GetVolumeId(), req.GetNodeId())
+}
+
+// nfsExportPath returns the path where the volume is exported on the NFS server node. Clients use the same path to
+// mount the export.
+func (d Driver) nfsExportPath(volId string) string {
+	return filepath.Join(d.nfsExportRoot, volId)
+}
+
+// nodeStageNFS stages a volume shared over NFS. On the NFS server, the export is bind mounted to the staging path,
+// all other nodes mount the export from the address in the publish context.
+func (d Driver) nodeStageNFS(ctx context.Context, req *csi.NodeStageVolumeRequest, stagingPath string, readOnly bool) error {
+	if req.GetPublishContext()[linstor.PublishedNFSExportKey] == "true" {
+		vol, err := d.NFS.NFSVolume(ctx, req.GetVolumeId())
+		if err != nil {
+			return err
+		}
+
+		// The server might have changed since the volume was published on this node, in which case it is mounted
+		// like on any other client.
+		if vol != nil && vol.Server == d.nodeID {
+			assignment, err := d.Assignments.FindAssignmentOnNode(ctx, req.GetVolumeId(), d.nodeID)
+			if err != nil {
+				return err
+			}
+
+			if assignment != nil {
+				err := d.checkLuksPassphrase(ctx, req, assignment)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = d.serveNFS(ctx, vol)
+			if err != nil {
+				return err
+			}
+
+			return d.Mounter.BindMount(ctx, d.nfsExportPath(req.GetVolumeId()), stagingPath, false, readOnly)
+		}
+	}
+
+	address := req.GetPublishContext()[linstor.PublishedNFSServerKey]
+
+	return d.Mounter.MountNFS(ctx, address, d.nfsExportPath(req.GetVolumeId()), stagingPath, readOnly, req.GetVolumeCapability().GetMount().GetMountFlags())
+}
+
+// serveNFS makes this node serve the volume: it is attached, mounted at the export path, exported, and the floating
+// address of the volume is assigned to this node. The export is independent of the staging path, so the volume stays
+// available to other nodes when it is no longer used on this node.
+func (d Driver) serveNFS(ctx context.Context, vol *volume.NFSVolume) error {
+	exportPath := d.nfsExportPath(vol.ID)
+
+	notMounted, err := d.Mounter.IsNotMountPoint(exportPath)
+	if err != nil {
+		return fmt.Errorf("failed to check export path: %w", err)
+	}
+
+	if notMounted {
+		assignment, err := d.Assignments.FindAssignmentOnNode(ctx, vol.ID, d.nodeID)
+		if err != nil {
+			return err
+		}
+
+		if assignment == nil {
+			err := d.Assignments.Attach(ctx, vol.ID, d.nodeID, false, false)
+			if err != nil {
+				return fmt.Errorf("failed to attach volume on NFS server: %w", err)
+			}
+
+			assignment, err = d.Assignments.FindAssignmentOnNode(ctx, vol.ID, d.nodeID)
+			if err != nil {
+				return err
+			}
+
+			if assignment == nil {
+				return fmt.Errorf("volume not attached on NFS server after attach")
+			}
+		}
+
+		fsType := vol.FsType
+		if fsType == "" {
+			fsType = "ext4"
+		}
+
+		var mntOpts []string
+		if fsType == "xfs" {
+			mntOpts = append(mntOpts, "nouuid")
+		}
+
+		err = d.Mounter.Mount(ctx, assignment.Path, exportPath, fsType, false, mntOpts)
+		if err != nil {
+			return fmt.Errorf("failed to mount export path: %w", err)
+		}
+	}
+
+	err = d.NFS.Export(ctx, exportPath)
+	if err != nil {
+		return err
+	}
+
+	if vol.Address != "" {
+		return d.NFS.AddFloatingAddress(ctx, vol.Address)
+	}
+
+	return nil
+}
+
+// stopServingNFS stops serving the volume over NFS, if it was served from this node.
+func (d Driver) stopServingNFS(ctx context.Context, vol *volume.NFSVolume) error {
+	exportPath := d.nfsExportPath(vol.ID)
+
+	notMounted, err := d.Mounter.IsNotMountPoint(exportPath)
+	if err != nil {
+		return fmt.Errorf("failed to check export path: %w", err)
+	}
+
+	if notMounted {
+		return nil
+	}
+
+	d.logger(ctx).WithField(logging.FieldVolume, vol.ID).Info("stop serving volume over NFS")
+
+	if vol.Address != "" {
+		err := d.NFS.RemoveFloatingAddress(ctx, vol.Address)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.NFS.Unexport(ctx, exportPath)
+	if err != nil {
+		return err
+	}
+
+	return d.Mounter.Unmount(exportPath)
+}
+
+// RunNFSServer serves the volumes shared over NFS this node is responsible for, checking at the given interval until
+// the context is cancelled.
+//
+// A node serves a volume while it is the NFS server of the volume and the volume has clients. If the server goes
+// offline, one of the clients takes over. With floating addresses, the address of the volume moves to the new server,
+// so clients keep their mounts. Without floating addresses, clients keep using the address of the old server until the
+// volume is published to them again.
+func (d Driver) RunNFSServer(ctx context.Context, interval time.Duration) {
+	d.log.WithField("interval", interval).Info("starting NFS server")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.reconcileNFS(ctx)
+
+		select {
+		case <-ctx.Done():
+			d.log.Info("stopping NFS server")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileNFS starts or stops serving all volumes shared over NFS, as needed.
+func (d Driver) reconcileNFS(ctx context.Context) {
+	vols, err := d.NFS.NFSVolumes(ctx)
+	if err != nil {
+		d.log.WithError(err).Warn("failed to list volumes shared over NFS")
+		return
+	}
+
+	for i := range vols {
+		vol := &vols[i]
+
+		// Volumes with an operation in flight are checked again on the next run.
+		release, err := d.lockVolume("RunNFSServer", vol.ID)
+		if err != nil {
+			continue
+		}
+
+		err = d.reconcileNFSVolume(ctx, vol)
+
+		release()
+
+		if err != nil {
+			d.log.WithError(err).WithField(logging.FieldVolume, vol.ID).Warn("failed to reconcile NFS server")
+		}
+	}
+}
+
+func (d Driver) reconcileNFSVolume(ctx context.Context, vol *volume.NFSVolume) error {
+	hasClients := len(vol.Clients) > 0
+
+	if hasClients && vol.Server != d.nodeID && slices.Contains(vol.Clients, d.nodeID) {
+		claimed, err := d.NFS.ClaimNFSServer(ctx, vol.ID, d.nodeID)
+		if err != nil {
+			return err
+		}
+
+		if claimed {
+			vol.Server = d.nodeID
+		}
+	}
+
+	if hasClients && vol.Server == d.nodeID {
+		return d.serveNFS(ctx, vol)
+	}
+
+	return d.stopServingNFS(ctx, vol)
+}
@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
@@ -11,12 +12,15 @@ const (
 	VolumeContextMarker = linstor.ParameterNamespace + "/uses-volume-context"
 	MountOptions        = linstor.ParameterNamespace + "/mount-options"
 	PostMountXfsOpts    = linstor.ParameterNamespace + "/post-mount-xfs-opts"
+	NFSExport           = linstor.ParameterNamespace + "/nfs-export"
 )
 
 // VolumeContext stores the context parameters required to mount a volume.
 type VolumeContext struct {
 	MountOptions        []string
 	PostMountXfsOptions string
+	// NFSExport is set if RWX filesystem volumes are shared over NFS.
+	NFSExport bool
 }
 
 // NewVolumeContext creates a new default volume context, which does not specify any fancy mkfs/mount/post-mount options
@@ -30,6 +34,7 @@ func VolumeContextFromParameters(params *volume.Parameters) *VolumeContext {
 	return &VolumeContext{
 		MountOptions:        mountOpts,
 		PostMountXfsOptions: params.PostMountXfsOpts,
+		NFSExport:           params.NFSExport,
 	}
 }
 
@@ -40,18 +45,38 @@ func VolumeContextFromMap(ctx map[string]string) *VolumeContext {
 	}
 
 	mountOpts := parseMountOpts(ctx[MountOptions])
+	nfsExport, _ := strconv.ParseBool(ctx[NFSExport])
 
 	return &VolumeContext{
 		MountOptions:        mountOpts,
 		PostMountXfsOptions: ctx[PostMountXfsOpts],
+		NFSExport:           nfsExport,
 	}
 }
 
+// ParametersFromVolumeContext returns the storage class parameters contained in the volume context. For statically
+// provisioned volumes, the volume context is set by the user and may contain any storage class parameter.
+func ParametersFromVolumeContext(ctx map[string]string) map[string]string {
+	params := make(map[string]string, len(ctx))
+
+	for k, v := range ctx {
+		switch k {
+		case VolumeContextMarker, MountOptions, PostMountXfsOpts, NFSExport:
+			continue
+		default:
+			params[k] = v
+		}
+	}
+
+	return params
+}
+
 func (v *VolumeContext) ToMap() map[string]string {
 	return map[string]string{
 		VolumeContextMarker: "true",
 		MountOptions:        encodeMountOpts(v.MountOptions),
 		PostMountXfsOpts:    v.PostMountXfsOptions,
+		NFSExport:           strconv.FormatBool(v.NFSExport),
 	}
 }
 
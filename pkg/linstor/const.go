@@ -35,12 +35,64 @@ const (
 	// resource) exists.
 	PropertyCreatedFor = lc.NamespcAuxiliary + "/csi-created-for"
 
+	// PropertyBackupTargetRemote is the property LINSTOR sets on snapshots taken for a backup, naming the remote the
+	// backup is shipped to.
+	PropertyBackupTargetRemote = lc.NamespcBackupShipping + "/BackupTargetRemote"
+
+	// PropertyGroupSnapshotMembers is the Aux props key on the snapshots of a group snapshot storing the sorted,
+	// comma separated list of all volumes in the group.
+	PropertyGroupSnapshotMembers = lc.NamespcAuxiliary + "/csi-group-snapshot-members"
+
+	// PropertyCreatedAt is the Aux props key on resource groups storing when the driver created them, in RFC 3339
+	// format. Resource groups are not removed as orphaned shortly after being created.
+	PropertyCreatedAt = lc.NamespcAuxiliary + "/csi-created-at"
+
 	// CreatedForTemporaryDisklessAttach marks a resource as temporary, i.e. it should be removed after it is no longer
 	// needed.
 	CreatedForTemporaryDisklessAttach = "temporary-diskless-attach"
 
+	// CreatedForEphemeralVolume marks a resource definition as backing a CSI ephemeral inline volume. It is removed
+	// when the volume is unpublished.
+	CreatedForEphemeralVolume = "ephemeral-volume"
+
 	PublishedReadOnlyKey = lc.NamespcAuxiliary + "/csi-publish-readonly"
 
+	// PropertyBackupClass is the Aux props key on resource definitions that opts a volume in to scheduled backups. The
+	// value is the name of the VolumeSnapshotClass holding the backup schedule and retention.
+	PropertyBackupClass = lc.NamespcAuxiliary + "/csi-backup-class"
+
+	// PropertyShippedSnapshotPrefix is the prefix of the Aux props keys on resource definitions mapping the ID of a
+	// requested snapshot to the snapshot LINSTOR created when shipping the volume to a LINSTOR remote. The requested
+	// ID is appended to the prefix, the value is the name of the shipped snapshot.
+	PropertyShippedSnapshotPrefix = lc.NamespcAuxiliary + "/csi-shipped-snapshot/"
+
+	// PropertyMigratedFrom is the Aux props key on a resource added to replace the replica on another node during a
+	// migration. The value is the node of the replaced replica.
+	PropertyMigratedFrom = lc.NamespcAuxiliary + "/csi-migrated-from"
+
+	// PropertyNFSServer is the Aux props key on resource definitions storing the node that serves an NFS exported
+	// volume to other nodes.
+	PropertyNFSServer = lc.NamespcAuxiliary + "/csi-nfs-server"
+
+	// PropertyNFSClientPrefix is the prefix of the Aux props keys on resource definitions recording the nodes an NFS
+	// exported volume is published on. The node name is appended to the prefix.
+	PropertyNFSClientPrefix = lc.NamespcAuxiliary + "/csi-nfs-client/"
+
+	// PropertyNFSAddress is the Aux props key on resource definitions storing the floating address allocated to an
+	// NFS exported volume.
+	PropertyNFSAddress = lc.NamespcAuxiliary + "/csi-nfs-address"
+
+	// PublishedNFSServerKey is the publish context key with the address of the NFS server clients mount the volume
+	// from.
+	PublishedNFSServerKey = lc.NamespcAuxiliary + "/csi-publish-nfs-server"
+
+	// PublishedNFSExportKey is the publish context key marking the node that exports the volume over NFS.
+	PublishedNFSExportKey = lc.NamespcAuxiliary + "/csi-publish-nfs-export"
+
+	// PropertyAllowTwoPrimaries is the DRBD option set on resource definitions while a block volume is published
+	// read-write on two nodes, for example during a live migration of a virtual machine.
+	PropertyAllowTwoPrimaries = lc.NamespcDrbdNetOptions + "/allow-two-primaries"
+
 	// ParameterNamespace is the preferred namespace when setting parameters in
 	ParameterNamespace = "linstor.csi.linbit.com"
 
@@ -50,6 +102,20 @@ const (
 	// PropertyNamespace is the namespace for LINSTOR properties in kubernetes storage class parameters.
 	PropertyNamespace = "property.linstor.csi.linbit.com"
 
+	// SchedulerParameterNamespace is the namespace for options passed to the volume scheduler in storage class
+	// parameters.
+	SchedulerParameterNamespace = "scheduler.linstor.csi.linbit.com"
+
 	// ResourceGroupNamespace is the UUID namespace for generated resource groups
 	ResourceGroupNamespace = "resourcegroup.linstor.csi.linbit.com"
+
+	// GeneratedResourceGroupPrefix is the prefix of resource groups generated from storage class parameters.
+	GeneratedResourceGroupPrefix = "sc-"
+
+	// TemporarySnapshotPrefix is the prefix of snapshots created to clone a volume.
+	TemporarySnapshotPrefix = "for-"
+
+	// ScheduledBackupPrefix is the prefix of snapshots created for scheduled backups. Only backups of such snapshots
+	// are removed by the backup retention.
+	ScheduledBackupPrefix = "scheduled-"
 )
@@ -0,0 +1,267 @@
+// Package credentials provides TLS certificates and bearer tokens, for the LINSTOR API and the admission webhook, that
+// are read from files and reloaded when the files change, for example when cert-manager or Kubernetes rotate a mounted
+// secret.
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// watchedFile caches the content of a file until its modification time or size changes.
+type watchedFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	content []byte
+}
+
+// read returns the current content of the file, and whether it changed since the last call.
+func (w *watchedFile) read() ([]byte, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Stat follows symlinks, so this also detects the symlink swap used to update Kubernetes secret volumes.
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if w.content != nil && info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return w.content, false, nil
+	}
+
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := !bytes.Equal(content, w.content)
+
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	w.content = content
+
+	return content, changed, nil
+}
+
+// KeyPair is a TLS certificate loaded from a certificate and key file. It can be used as client certificate for the
+// LINSTOR API or as server certificate, as done by the admission webhook.
+type KeyPair struct {
+	cert *watchedFile
+	key  *watchedFile
+
+	mu      sync.Mutex
+	current *tls.Certificate
+}
+
+// NewKeyPair loads the certificate and key from the given PEM files.
+func NewKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	c := &KeyPair{cert: &watchedFile{path: certFile}, key: &watchedFile{path: keyFile}}
+
+	_, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetClientCertificate returns the current certificate, reloading it if the files changed. It can be used as
+// tls.Config.GetClientCertificate.
+//
+// If the new files can't be loaded, for example because only one of certificate and key was updated so far, the
+// previous certificate is returned.
+func (c *KeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.load()
+}
+
+// GetCertificate works like GetClientCertificate, but can be used as tls.Config.GetCertificate to serve the
+// certificate.
+func (c *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.load()
+}
+
+func (c *KeyPair) load() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	certPEM, certChanged, certErr := c.cert.read()
+	keyPEM, keyChanged, keyErr := c.key.read()
+
+	if err := firstErr(certErr, keyErr); err != nil {
+		if c.current != nil {
+			return c.current, nil
+		}
+
+		return nil, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+
+	if c.current != nil && !certChanged && !keyChanged {
+		return c.current, nil
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		if c.current != nil {
+			return c.current, nil
+		}
+
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	c.current = &pair
+
+	return c.current, nil
+}
+
+// RootCAs is a pool of CA certificates loaded from a PEM file.
+type RootCAs struct {
+	file *watchedFile
+
+	mu      sync.Mutex
+	current *x509.CertPool
+}
+
+// NewRootCAs loads the CA certificates from the given PEM file.
+func NewRootCAs(caFile string) (*RootCAs, error) {
+	r := &RootCAs{file: &watchedFile{path: caFile}}
+
+	_, err := r.Pool()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Pool returns the current CA certificates, reloading them if the file changed. If the new file can't be loaded,
+// the previous certificates are returned.
+func (r *RootCAs) Pool() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content, changed, err := r.file.read()
+	if err != nil {
+		if r.current != nil {
+			return r.current, nil
+		}
+
+		return nil, fmt.Errorf("failed to read root CA: %w", err)
+	}
+
+	if r.current != nil && !changed {
+		return r.current, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		if r.current != nil {
+			return r.current, nil
+		}
+
+		return nil, fmt.Errorf("no valid certificate in %s", r.file.path)
+	}
+
+	r.current = pool
+
+	return r.current, nil
+}
+
+// DialTLSContext returns a function that can be used as http.Transport.DialTLSContext. Every connection uses a copy of
+// config with the current CA certificates, so the server certificate is verified against the rotated CA, including
+// the host name. Unless config sets a ServerName, the certificate is verified against the dialed host.
+func (r *RootCAs) DialTLSContext(config *tls.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		pool, err := r.Pool()
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := config.Clone()
+		cfg.RootCAs = pool
+
+		if cfg.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+
+			cfg.ServerName = host
+		}
+
+		dialer := &tls.Dialer{Config: cfg}
+
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// BearerToken is a token for the LINSTOR API loaded from a file.
+type BearerToken struct {
+	file *watchedFile
+}
+
+// NewBearerToken loads the token from the given file.
+func NewBearerToken(tokenFile string) (*BearerToken, error) {
+	t := &BearerToken{file: &watchedFile{path: tokenFile}}
+
+	_, err := t.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Token returns the current token, re-reading the file if it changed.
+func (t *BearerToken) Token() (string, error) {
+	content, _, err := t.file.read()
+	if err != nil {
+		return "", fmt.Errorf("failed to read bearer token: %w", err)
+	}
+
+	return string(bytes.TrimSpace(content)), nil
+}
+
+// RoundTripper adds the current token as Authorization header to every request sent through next.
+func (t *BearerToken) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	return &bearerTokenRoundTripper{next: next, token: t}
+}
+
+type bearerTokenRoundTripper struct {
+	next  http.RoundTripper
+	token *BearerToken
+}
+
+func (b *bearerTokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := b.token.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the original request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return b.next.RoundTrip(req)
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
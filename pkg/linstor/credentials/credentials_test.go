@@ -0,0 +1,170 @@
+package credentials_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/credentials"
+)
+
+// selfSigned returns a new PEM encoded certificate and key.
+func selfSigned(t *testing.T, cn string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// write replaces the file, making sure the modification time changes even on file systems with coarse timestamps.
+func write(t *testing.T, path string, content []byte) {
+	var previous time.Time
+	if info, err := os.Stat(path); err == nil {
+		previous = info.ModTime()
+	}
+
+	assert.NoError(t, os.WriteFile(path, content, 0o600))
+
+	modTime := time.Now()
+	if !modTime.After(previous) {
+		modTime = previous.Add(time.Second)
+	}
+
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestKeyPair(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	_, err := credentials.NewKeyPair(certFile, keyFile)
+	assert.Error(t, err)
+
+	cert1, key1 := selfSigned(t, "first")
+	write(t, certFile, cert1)
+	write(t, keyFile, key1)
+
+	cc, err := credentials.NewKeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+
+	first, err := cc.GetClientCertificate(nil)
+	assert.NoError(t, err)
+
+	// Only the certificate was updated so far: keep using the old pair.
+	cert2, key2 := selfSigned(t, "second")
+	write(t, certFile, cert2)
+
+	current, err := cc.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, first, current)
+
+	write(t, keyFile, key2)
+
+	current, err = cc.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, current)
+
+	parsed, err := x509.ParseCertificate(current.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "second", parsed.Subject.CommonName)
+}
+
+func TestRootCAs(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	write(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	rootCAs, err := credentials.NewRootCAs(caFile)
+	assert.NoError(t, err)
+
+	client := &http.Client{Transport: &http.Transport{DialTLSContext: rootCAs.DialTLSContext(&tls.Config{})}}
+
+	// The certificate is valid for the dialed IP address.
+	resp, err := client.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// The host name is verified, even though the server is reachable under that name.
+	_, err = client.Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+	assert.Error(t, err)
+
+	withServerName := &http.Client{Transport: &http.Transport{DialTLSContext: rootCAs.DialTLSContext(&tls.Config{ServerName: "example.com"})}}
+
+	resp, err = withServerName.Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// After rotating the CA, the old server certificate is no longer trusted.
+	other, _ := selfSigned(t, "other-ca")
+	write(t, caFile, other)
+
+	client.CloseIdleConnections()
+
+	_, err = client.Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	t.Parallel()
+
+	var received string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		received = req.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	write(t, tokenFile, []byte("first\n"))
+
+	token, err := credentials.NewBearerToken(tokenFile)
+	assert.NoError(t, err)
+
+	client := &http.Client{Transport: token.RoundTripper(http.DefaultTransport)}
+
+	resp, err := client.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer first", received)
+
+	write(t, tokenFile, []byte("second-token"))
+
+	resp, err = client.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer second-token", received)
+}
@@ -0,0 +1,255 @@
+// Package failover routes requests to the LINSTOR API to one of several controller endpoints, switching to another
+// endpoint when the active one stops responding.
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// healthPath is the LINSTOR API path used to check if an endpoint is the active controller.
+const healthPath = "/v1/controller/version"
+
+// probeTimeout limits how long a single health check may take.
+var probeTimeout = 5 * time.Second
+
+// RoundTripper sends every request to the currently active endpoint.
+//
+// If a request to the active endpoint fails because the controller can't be reached, all endpoints are checked in
+// order, and the first one that answers the controller version API becomes the new active endpoint. The failed
+// request is retried once on the new endpoint, provided that it is safe to do so: either the connection could not be
+// established at all, or the request is idempotent.
+type RoundTripper struct {
+	next      http.RoundTripper
+	endpoints []*url.URL
+	log       *logrus.Entry
+
+	mu     sync.RWMutex
+	active int
+}
+
+var _ http.RoundTripper = &RoundTripper{}
+
+// NewRoundTripper creates a new RoundTripper, initially using the first endpoint. Requests are sent using next,
+// which should handle TLS and authentication.
+func NewRoundTripper(next http.RoundTripper, endpoints []*url.URL, log *logrus.Entry) (*RoundTripper, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("need at least one LINSTOR endpoint")
+	}
+
+	for _, ep := range endpoints {
+		if ep.Scheme == "" || ep.Host == "" {
+			return nil, fmt.Errorf("invalid LINSTOR endpoint '%s': need scheme and host", ep)
+		}
+	}
+
+	return &RoundTripper{next: next, endpoints: endpoints, log: log.WithField("component", "failover")}, nil
+}
+
+// Active returns the endpoint requests are currently sent to.
+func (r *RoundTripper) Active() *url.URL {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.endpoints[r.active]
+}
+
+func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.RLock()
+	active := r.active
+	r.mu.RUnlock()
+
+	resp, err := r.next.RoundTrip(withEndpoint(req, r.endpoints[active]))
+	if err == nil || len(r.endpoints) == 1 || req.Context().Err() != nil || !retryable(req, err) {
+		return resp, err
+	}
+
+	r.log.WithError(err).WithField("endpoint", r.endpoints[active]).Warn("LINSTOR endpoint not reachable, trying others")
+
+	next, ferr := r.failover(req.Context(), active)
+	if ferr != nil {
+		r.log.WithError(ferr).Warn("failover failed")
+		return nil, err
+	}
+
+	retry, berr := rewind(req)
+	if berr != nil {
+		return nil, err
+	}
+
+	return r.next.RoundTrip(withEndpoint(retry, next))
+}
+
+// Watch checks the active endpoint at the given interval, and switches to another endpoint if it is not healthy.
+// It returns when the context is cancelled.
+func (r *RoundTripper) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.RLock()
+		active := r.active
+		r.mu.RUnlock()
+
+		err := r.probe(ctx, r.endpoints[active])
+		if err == nil {
+			continue
+		}
+
+		r.log.WithError(err).WithField("endpoint", r.endpoints[active]).Warn("LINSTOR endpoint not healthy, trying others")
+
+		_, err = r.failover(ctx, active)
+		if err != nil {
+			r.log.WithError(err).Warn("failover failed")
+		}
+	}
+}
+
+// failover switches away from the failed endpoint to the first healthy endpoint. Endpoints after the failed one are
+// tried first, the failed endpoint itself is tried last. If another request already switched endpoints, the new
+// active endpoint is returned without further checks.
+//
+// Endpoints are probed without holding the lock, so requests to the active endpoint are not blocked while a probe
+// waits for an unreachable controller. The lock is only taken to switch the active endpoint.
+func (r *RoundTripper) failover(ctx context.Context, failed int) (*url.URL, error) {
+	var errs []error
+
+	for i := 1; i <= len(r.endpoints); i++ {
+		if current, switched := r.switchedFrom(failed); switched {
+			return current, nil
+		}
+
+		candidate := (failed + i) % len(r.endpoints)
+
+		err := r.probe(ctx, r.endpoints[candidate])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.endpoints[candidate], err))
+			continue
+		}
+
+		return r.activate(failed, candidate), nil
+	}
+
+	return nil, fmt.Errorf("no healthy LINSTOR endpoint: %v", errs)
+}
+
+// switchedFrom returns the active endpoint, and whether it differs from the failed one.
+func (r *RoundTripper) switchedFrom(failed int) (*url.URL, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.endpoints[r.active], r.active != failed
+}
+
+// activate makes candidate the active endpoint, unless another request switched away from the failed endpoint while
+// probing. It returns the endpoint that is active afterwards.
+func (r *RoundTripper) activate(failed, candidate int) *url.URL {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active != failed {
+		return r.endpoints[r.active]
+	}
+
+	if candidate != failed {
+		r.log.WithField("endpoint", r.endpoints[candidate]).Info("switched to new LINSTOR endpoint")
+	}
+
+	r.active = candidate
+
+	return r.endpoints[candidate]
+}
+
+// probe checks that the endpoint answers the controller version API.
+func (r *RoundTripper) probe(ctx context.Context, endpoint *url.URL) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	u := *endpoint
+	u.Path = healthPath
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// withEndpoint returns a copy of the request, sent to the given endpoint.
+func withEndpoint(req *http.Request, endpoint *url.URL) *http.Request {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = endpoint.Scheme
+	out.URL.Host = endpoint.Host
+	out.Host = ""
+
+	return out
+}
+
+// retryable returns true if the request can safely be sent again after it failed with the given error.
+func retryable(req *http.Request, err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		// The request never reached the controller.
+		return true
+	}
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// rewind returns a copy of the request with a fresh body, so it can be sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	out := req.Clone(req.Context())
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return out, nil
+	}
+
+	if req.GetBody == nil {
+		return nil, errors.New("request body can't be replayed")
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	out.Body = body
+
+	return out, nil
+}
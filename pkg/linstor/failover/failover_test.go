@@ -0,0 +1,169 @@
+package failover_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/failover"
+)
+
+// controller returns a fake LINSTOR controller that echos the body of any request except the version API.
+func controller(t *testing.T, healthy bool) *url.URL {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1/controller/version" {
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+
+			return
+		}
+
+		_, _ = io.Copy(w, req.Body)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	assert.NoError(t, err)
+
+	return u
+}
+
+// unreachable returns an endpoint that refuses connections.
+func unreachable(t *testing.T) *url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	return &url.URL{Scheme: "http", Host: addr}
+}
+
+func post(t *testing.T, rt http.RoundTripper, body string) (string, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "http://ignored/v1/resource-definitions", strings.NewReader(body))
+	assert.NoError(t, err)
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	out, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return string(out), nil
+}
+
+func TestRoundTripper(t *testing.T) {
+	t.Parallel()
+
+	log := logrus.WithField("test", t.Name())
+
+	t.Run("single endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		ep := controller(t, true)
+
+		rt, err := failover.NewRoundTripper(http.DefaultTransport, []*url.URL{ep}, log)
+		assert.NoError(t, err)
+
+		out, err := post(t, rt, "hello")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", out)
+	})
+
+	t.Run("fail over to healthy endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		dead := unreachable(t)
+		standby := controller(t, false)
+		active := controller(t, true)
+
+		rt, err := failover.NewRoundTripper(http.DefaultTransport, []*url.URL{dead, standby, active}, log)
+		assert.NoError(t, err)
+		assert.Equal(t, dead, rt.Active())
+
+		out, err := post(t, rt, "hello")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", out)
+		assert.Equal(t, active, rt.Active())
+
+		// Following requests go to the new endpoint directly.
+		out, err = post(t, rt, "again")
+		assert.NoError(t, err)
+		assert.Equal(t, "again", out)
+	})
+
+	t.Run("probes do not block requests", func(t *testing.T) {
+		t.Parallel()
+
+		probing := make(chan struct{})
+		release := make(chan struct{})
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			close(probing)
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		slow, err := url.Parse(srv.URL)
+		assert.NoError(t, err)
+
+		dead := unreachable(t)
+		active := controller(t, true)
+
+		rt, err := failover.NewRoundTripper(http.DefaultTransport, []*url.URL{dead, slow, active}, log)
+		assert.NoError(t, err)
+
+		done := make(chan error)
+
+		go func() {
+			_, err := post(t, rt, "hello")
+			done <- err
+		}()
+
+		<-probing
+		// The active endpoint is still readable while the slow endpoint is being probed.
+		assert.Equal(t, dead, rt.Active())
+		close(release)
+
+		assert.NoError(t, <-done)
+		assert.Equal(t, active, rt.Active())
+	})
+
+	t.Run("no healthy endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		dead := unreachable(t)
+		standby := controller(t, false)
+
+		rt, err := failover.NewRoundTripper(http.DefaultTransport, []*url.URL{dead, standby}, log)
+		assert.NoError(t, err)
+
+		_, err = post(t, rt, "hello")
+		assert.Error(t, err)
+		assert.Equal(t, dead, rt.Active())
+	})
+
+	t.Run("invalid endpoints", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := failover.NewRoundTripper(http.DefaultTransport, nil, log)
+		assert.Error(t, err)
+
+		_, err = failover.NewRoundTripper(http.DefaultTransport, []*url.URL{{Path: "localhost"}}, log)
+		assert.Error(t, err)
+	})
+}
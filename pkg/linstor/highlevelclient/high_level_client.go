@@ -36,6 +36,15 @@ import (
 // HighLevelClient is a golinstor client with convience functions.
 type HighLevelClient struct {
 	*lapi.Client
+	// MultiSnapshots creates consistent snapshots of multiple resources. Optional, group snapshots are not supported
+	// if nil.
+	MultiSnapshots MultiSnapshotProvider
+	// ResourceGroupMover changes the resource group of resource definitions. Optional, volumes can't be moved to
+	// another resource group if nil.
+	ResourceGroupMover ResourceGroupMover
+	// EncryptedVolumeDefinitions creates volume definitions with a user provided LUKS passphrase. Optional, volumes
+	// can only use keys generated by LINSTOR if nil.
+	EncryptedVolumeDefinitions EncryptedVolumeDefinitionCreator
 }
 
 // NewHighLevelClient returns a pointer to a golinstor client with convience.
@@ -44,7 +53,7 @@ func NewHighLevelClient(options ...lapi.Option) (*HighLevelClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &HighLevelClient{c}, nil
+	return &HighLevelClient{Client: c}, nil
 }
 
 // GenericAccessibleTopologies returns topologies based on linstor storage pools
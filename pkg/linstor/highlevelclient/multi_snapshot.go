@@ -0,0 +1,37 @@
+package highlevelclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	lapi "github.com/LINBIT/golinstor/client"
+)
+
+// MultiSnapshotProvider creates snapshots of multiple resources at the same DRBD point in time.
+//
+// golinstor does not support the multi-snapshot API of LINSTOR yet, so this is implemented here.
+type MultiSnapshotProvider interface {
+	// CreateMultiple creates all snapshots in a single operation. Either all snapshots are created, or none.
+	CreateMultiple(ctx context.Context, snapshots ...lapi.Snapshot) error
+}
+
+// MultiSnapshotService sends multi-snapshot requests to the LINSTOR API.
+type MultiSnapshotService struct {
+	// Client sends the requests. It should use the same transport as the golinstor client.
+	Client *http.Client
+	// BaseURL of the LINSTOR API.
+	BaseURL *url.URL
+	// BasicAuth credentials, if any.
+	BasicAuth *lapi.BasicAuthCfg
+}
+
+var _ MultiSnapshotProvider = &MultiSnapshotService{}
+
+type createMultiSnapshotRequest struct {
+	Snapshots []lapi.Snapshot `json:"snapshots"`
+}
+
+func (m *MultiSnapshotService) CreateMultiple(ctx context.Context, snapshots ...lapi.Snapshot) error {
+	return doJSON(ctx, m.Client, m.BaseURL, m.BasicAuth, http.MethodPost, "/v1/actions/snapshot/multi", createMultiSnapshotRequest{Snapshots: snapshots})
+}
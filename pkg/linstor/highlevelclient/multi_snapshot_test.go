@@ -0,0 +1,60 @@
+package highlevelclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/stretchr/testify/assert"
+
+	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+)
+
+func TestMultiSnapshotService_CreateMultiple(t *testing.T) {
+	t.Parallel()
+
+	var received struct {
+		Snapshots []lapi.Snapshot `json:"snapshots"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/actions/snapshot/multi" || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if len(received.Snapshots) > 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode([]lapi.ApiCallRc{{RetCode: -1, Message: "too many snapshots"}})
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode([]lapi.ApiCallRc{{RetCode: 1, Message: "created"}})
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	assert.NoError(t, err)
+
+	svc := &lc.MultiSnapshotService{Client: srv.Client(), BaseURL: u, BasicAuth: &lapi.BasicAuthCfg{Username: "user", Password: "pass"}}
+
+	err = svc.CreateMultiple(context.Background(), lapi.Snapshot{Name: "snap-a", ResourceName: "pvc-a"}, lapi.Snapshot{Name: "snap-b", ResourceName: "pvc-b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []lapi.Snapshot{{Name: "snap-a", ResourceName: "pvc-a"}, {Name: "snap-b", ResourceName: "pvc-b"}}, received.Snapshots)
+
+	err = svc.CreateMultiple(context.Background(), lapi.Snapshot{Name: "a"}, lapi.Snapshot{Name: "b"}, lapi.Snapshot{Name: "c"})
+	assert.IsType(t, lapi.ApiCallError{}, err)
+	assert.Contains(t, err.Error(), "too many snapshots")
+}
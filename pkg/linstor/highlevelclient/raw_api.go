@@ -0,0 +1,59 @@
+package highlevelclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	lapi "github.com/LINBIT/golinstor/client"
+)
+
+// doJSON sends a request with a JSON body to a LINSTOR API endpoint not supported by golinstor. A 404 response is
+// returned as lapi.NotFoundError, other error responses are decoded as lapi.ApiCallError, if possible.
+func doJSON(ctx context.Context, client *http.Client, baseURL *url.URL, auth *lapi.BasicAuthCfg, method, path string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	u := baseURL.ResolveReference(&url.URL{Path: path})
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	if auth != nil && auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return lapi.NotFoundError
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var rets lapi.ApiCallError
+
+		err := json.NewDecoder(resp.Body).Decode(&rets)
+		if err != nil || len(rets) == 0 {
+			return fmt.Errorf("%s %s failed with status %s", method, path, resp.Status)
+		}
+
+		return rets
+	}
+
+	return nil
+}
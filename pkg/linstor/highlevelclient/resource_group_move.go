@@ -0,0 +1,35 @@
+package highlevelclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	lapi "github.com/LINBIT/golinstor/client"
+)
+
+// ResourceGroupMover moves resource definitions to a different resource group.
+//
+// golinstor only supports changing the properties of a resource definition, so this is implemented here.
+type ResourceGroupMover interface {
+	// MoveToResourceGroup changes the resource group of the resource definition. The resource group has to exist.
+	MoveToResourceGroup(ctx context.Context, resName, resourceGroup string) error
+}
+
+// ResourceGroupMoveService sends resource definition modify requests to the LINSTOR API.
+type ResourceGroupMoveService struct {
+	// Client sends the requests. It should use the same transport as the golinstor client.
+	Client *http.Client
+	// BaseURL of the LINSTOR API.
+	BaseURL *url.URL
+	// BasicAuth credentials, if any.
+	BasicAuth *lapi.BasicAuthCfg
+}
+
+var _ ResourceGroupMover = &ResourceGroupMoveService{}
+
+func (m *ResourceGroupMoveService) MoveToResourceGroup(ctx context.Context, resName, resourceGroup string) error {
+	path := "/v1/resource-definitions/" + url.PathEscape(resName)
+
+	return doJSON(ctx, m.Client, m.BaseURL, m.BasicAuth, http.MethodPut, path, lapi.ResourceDefinitionModify{ResourceGroup: resourceGroup})
+}
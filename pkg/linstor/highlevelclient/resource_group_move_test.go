@@ -0,0 +1,54 @@
+package highlevelclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/stretchr/testify/assert"
+
+	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+)
+
+func TestResourceGroupMoveService_MoveToResourceGroup(t *testing.T) {
+	t.Parallel()
+
+	var received lapi.ResourceDefinitionModify
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Path != "/v1/resource-definitions/pvc-a" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode([]lapi.ApiCallRc{{RetCode: 1, Message: "modified"}})
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	assert.NoError(t, err)
+
+	svc := &lc.ResourceGroupMoveService{Client: srv.Client(), BaseURL: u}
+
+	err = svc.MoveToResourceGroup(context.Background(), "pvc-a", "rg-fast")
+	assert.NoError(t, err)
+	assert.Equal(t, "rg-fast", received.ResourceGroup)
+
+	err = svc.MoveToResourceGroup(context.Background(), "pvc-b", "rg-fast")
+	assert.Equal(t, lapi.NotFoundError, err)
+}
@@ -0,0 +1,44 @@
+package highlevelclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	lapi "github.com/LINBIT/golinstor/client"
+)
+
+// EncryptedVolumeDefinitionCreator creates volume definitions with a user provided LUKS passphrase.
+//
+// golinstor does not support passing a passphrase when creating a volume definition, so this is implemented here.
+type EncryptedVolumeDefinitionCreator interface {
+	// CreateEncryptedVolumeDefinition creates the volume definition. The LUKS layer of the volume uses the
+	// passphrase instead of a key generated by LINSTOR.
+	CreateEncryptedVolumeDefinition(ctx context.Context, resName string, create lapi.VolumeDefinitionCreate, passphrase string) error
+}
+
+// EncryptedVolumeDefinitionService sends volume definition create requests to the LINSTOR API.
+type EncryptedVolumeDefinitionService struct {
+	// Client sends the requests. It should use the same transport as the golinstor client.
+	Client *http.Client
+	// BaseURL of the LINSTOR API.
+	BaseURL *url.URL
+	// BasicAuth credentials, if any.
+	BasicAuth *lapi.BasicAuthCfg
+}
+
+var _ EncryptedVolumeDefinitionCreator = &EncryptedVolumeDefinitionService{}
+
+type encryptedVolumeDefinitionCreate struct {
+	lapi.VolumeDefinitionCreate
+	Passphrase string `json:"passphrase"`
+}
+
+func (e *EncryptedVolumeDefinitionService) CreateEncryptedVolumeDefinition(ctx context.Context, resName string, create lapi.VolumeDefinitionCreate, passphrase string) error {
+	path := "/v1/resource-definitions/" + url.PathEscape(resName) + "/volume-definitions"
+
+	return doJSON(ctx, e.Client, e.BaseURL, e.BasicAuth, http.MethodPost, path, encryptedVolumeDefinitionCreate{
+		VolumeDefinitionCreate: create,
+		Passphrase:             passphrase,
+	})
+}
@@ -0,0 +1,61 @@
+package highlevelclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/stretchr/testify/assert"
+
+	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+)
+
+func TestEncryptedVolumeDefinitionService_CreateEncryptedVolumeDefinition(t *testing.T) {
+	t.Parallel()
+
+	var received struct {
+		lapi.VolumeDefinitionCreate
+		Passphrase string `json:"passphrase"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Path != "/v1/resource-definitions/pvc-a/volume-definitions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode([]lapi.ApiCallRc{{RetCode: 1, Message: "created"}})
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	assert.NoError(t, err)
+
+	svc := &lc.EncryptedVolumeDefinitionService{Client: srv.Client(), BaseURL: u}
+
+	err = svc.CreateEncryptedVolumeDefinition(context.Background(), "pvc-a", lapi.VolumeDefinitionCreate{
+		VolumeDefinition: lapi.VolumeDefinition{SizeKib: 1024},
+	}, "hunter2")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1024), received.VolumeDefinition.SizeKib)
+	assert.Equal(t, "hunter2", received.Passphrase)
+
+	err = svc.CreateEncryptedVolumeDefinition(context.Background(), "pvc-b", lapi.VolumeDefinitionCreate{}, "hunter2")
+	assert.Equal(t, lapi.NotFoundError, err)
+}
@@ -0,0 +1,86 @@
+// Package logging configures log output and carries request scoped log fields through a context.Context, so that
+// every log line written while handling a CSI call can be correlated.
+package logging
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the fields attached to log lines.
+const (
+	FieldCorrelationID = "correlationID"
+	FieldMethod        = "method"
+	FieldVolume        = "volume"
+	FieldSnapshot      = "snapshot"
+	FieldNode          = "node"
+)
+
+// Supported log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// NewFormatter returns the logrus formatter for the given format name.
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case FormatText:
+		return &logrus.TextFormatter{}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format '%s', expected '%s' or '%s'", format, FormatText, FormatJSON)
+	}
+}
+
+// NewCorrelationID returns a new random ID to identify a single request in the logs.
+func NewCorrelationID() string {
+	return uuid.New().String()
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying the given log fields in addition to the fields already in ctx. Empty string
+// values are skipped.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := make(logrus.Fields)
+
+	for k, v := range Fields(ctx) {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		if s, ok := v.(string); ok && s == "" {
+			continue
+		}
+
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Fields returns the log fields stored in the context.
+func Fields(ctx context.Context) logrus.Fields {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+
+	return fields
+}
+
+// FromContext returns the given log entry with all fields stored in the context added.
+func FromContext(ctx context.Context, log *logrus.Entry) *logrus.Entry {
+	fields := Fields(ctx)
+	if len(fields) == 0 {
+		return log
+	}
+
+	return log.WithFields(fields)
+}
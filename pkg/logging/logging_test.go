@@ -0,0 +1,58 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
+)
+
+func TestNewFormatter(t *testing.T) {
+	t.Parallel()
+
+	f, err := logging.NewFormatter("json")
+	assert.NoError(t, err)
+	assert.IsType(t, &logrus.JSONFormatter{}, f)
+
+	f, err = logging.NewFormatter("text")
+	assert.NoError(t, err)
+	assert.IsType(t, &logrus.TextFormatter{}, f)
+
+	_, err = logging.NewFormatter("xml")
+	assert.Error(t, err)
+}
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	ctx := logging.WithFields(context.Background(), logrus.Fields{
+		logging.FieldCorrelationID: "1234",
+		logging.FieldVolume:        "pvc-1",
+		logging.FieldSnapshot:      "",
+	})
+	ctx = logging.WithFields(ctx, logrus.Fields{logging.FieldNode: "node-1"})
+
+	logging.FromContext(ctx, logrus.NewEntry(logger)).Info("test")
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, "1234", decoded[logging.FieldCorrelationID])
+	assert.Equal(t, "pvc-1", decoded[logging.FieldVolume])
+	assert.Equal(t, "node-1", decoded[logging.FieldNode])
+	assert.NotContains(t, decoded, logging.FieldSnapshot)
+
+	// Without fields, the entry is returned unchanged.
+	entry := logrus.NewEntry(logger)
+	assert.Same(t, entry, logging.FromContext(context.Background(), entry))
+}
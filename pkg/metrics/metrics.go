@@ -0,0 +1,188 @@
+// Package metrics collects Prometheus metrics about CSI calls and requests to the LINSTOR API.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/codes"
+)
+
+const namespace = "linstor_csi"
+
+// Most CSI calls and LINSTOR requests finish in a few milliseconds, but creating volumes or waiting for snapshots
+// can take well over a minute.
+var durationBuckets = prometheus.ExponentialBuckets(0.005, 2, 16)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "Number of CSI gRPC calls handled, by method and status code.",
+	}, []string{"method", "code"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of CSI gRPC calls, by method.",
+		Buckets:   durationBuckets,
+	}, []string{"method"})
+
+	linstorRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "linstor_api",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of requests to the LINSTOR API, by HTTP method, endpoint and status code.",
+		Buckets:   durationBuckets,
+	}, []string{"method", "endpoint", "code"})
+
+	rateLimiterWaiting = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "linstor_api",
+		Name:      "rate_limiter_waiting_requests",
+		Help:      "Number of requests to the LINSTOR API currently waiting for the rate limiter.",
+	})
+
+	rateLimiterLastWait = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "linstor_api",
+		Name:      "rate_limiter_last_wait_seconds",
+		Help:      "Time the most recent request to the LINSTOR API spent waiting for the rate limiter.",
+	})
+
+	reconcilerRemoved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciler",
+		Name:      "removed_total",
+		Help:      "Number of leftover objects removed by the background reconciler, by kind.",
+	}, []string{"kind"})
+
+	reconcilerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciler",
+		Name:      "errors_total",
+		Help:      "Number of failed background reconciler runs, by kind.",
+	}, []string{"kind"})
+
+	scheduledBackupsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciler",
+		Name:      "scheduled_backups_created_total",
+		Help:      "Number of scheduled backups created by the background reconciler, by snapshot class.",
+	}, []string{"class"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		grpcRequests,
+		grpcDuration,
+		linstorRequestDuration,
+		rateLimiterWaiting,
+		rateLimiterLastWait,
+		reconcilerRemoved,
+		reconcilerErrors,
+		scheduledBackupsCreated,
+	)
+}
+
+// Handler returns the HTTP handler serving all collected metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRPC records a finished CSI call.
+func ObserveRPC(method string, code codes.Code, duration time.Duration) {
+	grpcRequests.WithLabelValues(method, code.String()).Inc()
+	grpcDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// RateLimiterWaitStarted records that a request to the LINSTOR API started waiting for the rate limiter.
+func RateLimiterWaitStarted() {
+	rateLimiterWaiting.Inc()
+}
+
+// RateLimiterWaitDone records that a request to the LINSTOR API is no longer waiting for the rate limiter.
+func RateLimiterWaitDone(wait time.Duration) {
+	rateLimiterWaiting.Dec()
+	rateLimiterLastWait.Set(wait.Seconds())
+}
+
+// ReconcilerRemoved records that the background reconciler removed n leftover objects of the given kind.
+func ReconcilerRemoved(kind string, n int) {
+	reconcilerRemoved.WithLabelValues(kind).Add(float64(n))
+}
+
+// ReconcilerFailed records that the background reconciler failed to clean up objects of the given kind.
+func ReconcilerFailed(kind string) {
+	reconcilerErrors.WithLabelValues(kind).Inc()
+}
+
+// ScheduledBackupsCreated records that the background reconciler created n scheduled backups for the given snapshot
+// class.
+func ScheduledBackupsCreated(class string, n int) {
+	scheduledBackupsCreated.WithLabelValues(class).Add(float64(n))
+}
+
+// InstrumentRoundTripper records the latency of every request to the LINSTOR API sent through the given
+// http.RoundTripper.
+func InstrumentRoundTripper(next http.RoundTripper) http.RoundTripper {
+	return &instrumentedRoundTripper{next: next}
+}
+
+type instrumentedRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (i *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	resp, err := i.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+
+	linstorRequestDuration.WithLabelValues(req.Method, Endpoint(req.URL.Path), code).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
+
+// staticPathSegments are the parts of LINSTOR API paths that do not reference a specific object.
+var staticPathSegments = map[string]struct{}{
+	"v1": {}, "activate": {}, "autoplace": {}, "backups": {}, "clone": {}, "controller": {}, "deactivate": {},
+	"diskful": {}, "diskless": {}, "encryption": {}, "events": {}, "info": {}, "linstor": {}, "make-available": {},
+	"nodes": {}, "passphrase": {}, "properties": {}, "query-max-volume-size": {}, "query-size-info": {},
+	"remotes": {}, "resource-definitions": {}, "resource-groups": {}, "resources": {}, "restore": {}, "s3": {},
+	"ship": {}, "snapshot-restore-resource": {}, "snapshot-restore-volume-definition": {}, "snapshot-shipping": {},
+	"snapshots": {}, "spawn": {}, "storage-pool-definitions": {}, "storage-pools": {}, "toggle-disk": {},
+	"version": {}, "view": {}, "volume-definitions": {}, "volumes": {},
+}
+
+// Endpoint returns the LINSTOR API path with all object names replaced by a placeholder, so that metrics don't create
+// a new series for every volume.
+func Endpoint(path string) string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return "/"
+	}
+
+	segments := strings.Split(trimmed, "/")
+	for i := range segments {
+		if _, ok := staticPathSegments[segments[i]]; !ok {
+			segments[i] = ":name"
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,33 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/metrics"
+)
+
+func TestEndpoint(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "", expected: "/"},
+		{path: "/v1/controller/version", expected: "/v1/controller/version"},
+		{path: "/v1/view/resources", expected: "/v1/view/resources"},
+		{path: "/v1/resource-definitions/pvc-1234", expected: "/v1/resource-definitions/:name"},
+		{path: "/v1/resource-definitions/pvc-1234/resources/node-1/volumes/0", expected: "/v1/resource-definitions/:name/resources/:name/volumes/:name"},
+		{path: "/v1/remotes/s3-remote/backups/ship", expected: "/v1/remotes/:name/backups/ship"},
+	}
+
+	for i := range testcases {
+		tcase := &testcases[i]
+		t.Run(tcase.path, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tcase.expected, metrics.Endpoint(tcase.path))
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+// LeaderElection makes the reconciler run only while holding the Lease with the given name in namespace, so that the
+// controller can run with more than one replica. The identity must be unique for every replica, for example the pod
+// name.
+func LeaderElection(client kubernetes.Interface, namespace, name, identity string) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		if namespace == "" || name == "" || identity == "" {
+			return fmt.Errorf("leader election requires namespace, name and identity, got '%s', '%s' and '%s'", namespace, name, identity)
+		}
+
+		r.lock = &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		}
+
+		return nil
+	}
+}
+
+// KubernetesAttachments lists attached volumes from the VolumeAttachment objects of a Kubernetes cluster.
+type KubernetesAttachments struct {
+	Client kubernetes.Interface
+	// DriverName is the name the driver is registered with, only attachments handled by this driver are considered.
+	DriverName string
+}
+
+var _ AttachmentSource = &KubernetesAttachments{}
+
+func (k *KubernetesAttachments) Attachments(ctx context.Context) (map[volume.Attachment]struct{}, error) {
+	vas, err := k.Client.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume attachments: %w", err)
+	}
+
+	pvs, err := k.Client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+	}
+
+	volumeHandles := make(map[string]string)
+
+	for i := range pvs.Items {
+		csiSource := pvs.Items[i].Spec.CSI
+		if csiSource != nil && csiSource.Driver == k.DriverName {
+			volumeHandles[pvs.Items[i].Name] = csiSource.VolumeHandle
+		}
+	}
+
+	result := make(map[volume.Attachment]struct{})
+
+	for i := range vas.Items {
+		va := &vas.Items[i]
+
+		if va.Spec.Attacher != k.DriverName {
+			continue
+		}
+
+		var volumeID string
+
+		switch {
+		case va.Spec.Source.PersistentVolumeName != nil:
+			volumeID = volumeHandles[*va.Spec.Source.PersistentVolumeName]
+		case va.Spec.Source.InlineVolumeSpec != nil && va.Spec.Source.InlineVolumeSpec.CSI != nil:
+			volumeID = va.Spec.Source.InlineVolumeSpec.CSI.VolumeHandle
+		}
+
+		if volumeID == "" {
+			continue
+		}
+
+		result[volume.Attachment{VolumeID: volumeID, Node: va.Spec.NodeName}] = struct{}{}
+	}
+
+	return result, nil
+}
+
+// VolumeSnapshotClassResource is the resource of the VolumeSnapshotClass objects of the external-snapshotter.
+var VolumeSnapshotClassResource = schema.GroupVersionResource{
+	Group:    "snapshot.storage.k8s.io",
+	Version:  "v1",
+	Resource: "volumesnapshotclasses",
+}
+
+const (
+	snapshotterSecretNameKey      = "csi.storage.k8s.io/snapshotter-secret-name"
+	snapshotterSecretNamespaceKey = "csi.storage.k8s.io/snapshotter-secret-namespace"
+)
+
+// KubernetesBackupClasses lists the VolumeSnapshotClass objects of a Kubernetes cluster that configure a backup
+// schedule.
+type KubernetesBackupClasses struct {
+	// Client is used to read the snapshotter secrets referenced by a class.
+	Client kubernetes.Interface
+	// Dynamic is used to list the VolumeSnapshotClass objects, which are not part of the core API.
+	Dynamic dynamic.Interface
+	// DriverName is the name the driver is registered with, only classes handled by this driver are considered.
+	DriverName string
+}
+
+var _ BackupClassSource = &KubernetesBackupClasses{}
+
+func (k *KubernetesBackupClasses) BackupClasses(ctx context.Context) (map[string]*volume.SnapshotParameters, error) {
+	classes, err := k.Dynamic.Resource(VolumeSnapshotClassResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume snapshot classes: %w", err)
+	}
+
+	result := make(map[string]*volume.SnapshotParameters)
+
+	for i := range classes.Items {
+		class := &classes.Items[i]
+
+		driver, _, _ := unstructured.NestedString(class.Object, "driver")
+		if driver != k.DriverName {
+			continue
+		}
+
+		params, _, err := unstructured.NestedStringMap(class.Object, "parameters")
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameters in volume snapshot class %s: %w", class.GetName(), err)
+		}
+
+		if _, ok := params[linstor.SnapshotParameterNamespace+"/backup-schedule"]; !ok {
+			continue
+		}
+
+		secrets, err := k.snapshotterSecrets(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secrets for volume snapshot class %s: %w", class.GetName(), err)
+		}
+
+		snapParams, err := volume.NewSnapshotParameters(params, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameters in volume snapshot class %s: %w", class.GetName(), err)
+		}
+
+		result[class.GetName()] = snapParams
+	}
+
+	return result, nil
+}
+
+// snapshotterSecrets returns the secret referenced by the snapshot class parameters. Secret references using
+// templates can only be resolved for a specific VolumeSnapshot, they are ignored. In that case, the remote must
+// already exist.
+func (k *KubernetesBackupClasses) snapshotterSecrets(ctx context.Context, params map[string]string) (map[string]string, error) {
+	name := params[snapshotterSecretNameKey]
+	namespace := params[snapshotterSecretNamespaceKey]
+
+	if name == "" || namespace == "" || strings.Contains(name, "${") || strings.Contains(namespace, "${") {
+		return nil, nil
+	}
+
+	secret, err := k.Client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		result[key] = string(value)
+	}
+
+	return result, nil
+}
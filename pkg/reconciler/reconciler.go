@@ -0,0 +1,275 @@
+// Package reconciler periodically removes objects in LINSTOR that the driver created for its own use, but which were
+// left behind, for example because the CO never called ControllerUnpublishVolume, or gave up on CreateVolume.
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/metrics"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+// Kinds of objects removed by the reconciler, used to label metrics.
+const (
+	KindTemporaryResource = "temporary-resource"
+	KindTemporarySnapshot = "temporary-snapshot"
+	KindResourceGroup     = "resource-group"
+	KindScheduledBackup   = "scheduled-backup"
+)
+
+// AttachmentSource lists the volumes the CO currently considers attached.
+type AttachmentSource interface {
+	Attachments(ctx context.Context) (map[volume.Attachment]struct{}, error)
+}
+
+// BackupClassSource lists the snapshot classes with a backup schedule, by name.
+type BackupClassSource interface {
+	BackupClasses(ctx context.Context) (map[string]*volume.SnapshotParameters, error)
+}
+
+// Reconciler runs the garbage collection of leftover objects at a fixed interval.
+type Reconciler struct {
+	gc             volume.GarbageCollector
+	attachments    AttachmentSource
+	backups        volume.BackupScheduler
+	backupClasses  BackupClassSource
+	interval       time.Duration
+	snapshotMaxAge time.Duration
+	lock           resourcelock.Interface
+	// running is held while reconciling, so that a run started before losing leadership finishes before the next
+	// one starts.
+	running sync.Mutex
+	log     *logrus.Entry
+}
+
+// NewReconciler creates a new reconciler using the given garbage collector.
+func NewReconciler(gc volume.GarbageCollector, options ...func(*Reconciler) error) (*Reconciler, error) {
+	r := &Reconciler{
+		gc:             gc,
+		interval:       10 * time.Minute,
+		snapshotMaxAge: time.Hour,
+		log:            logrus.NewEntry(logrus.New()),
+	}
+
+	for _, opt := range options {
+		err := opt(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.log = r.log.WithField("component", "reconciler")
+
+	return r, nil
+}
+
+// Attachments sets the source of attachment information. Without it, temporary resources are only removed once they
+// are no longer marked as published.
+func Attachments(source AttachmentSource) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		r.attachments = source
+		return nil
+	}
+}
+
+// ScheduledBackups enables scheduled backups for the snapshot classes returned by classes. Backups are created and
+// pruned on every reconciler run, so the interval limits how precisely a schedule is followed.
+func ScheduledBackups(scheduler volume.BackupScheduler, classes BackupClassSource) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		r.backups = scheduler
+		r.backupClasses = classes
+
+		return nil
+	}
+}
+
+// Interval sets the time between two reconciler runs.
+func Interval(interval time.Duration) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		if interval <= 0 {
+			return fmt.Errorf("reconcile interval must be positive, got %s", interval)
+		}
+
+		r.interval = interval
+
+		return nil
+	}
+}
+
+// SnapshotMaxAge sets the age after which temporary snapshots are considered orphaned.
+func SnapshotMaxAge(maxAge time.Duration) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		if maxAge <= 0 {
+			return fmt.Errorf("snapshot max age must be positive, got %s", maxAge)
+		}
+
+		r.snapshotMaxAge = maxAge
+
+		return nil
+	}
+}
+
+// LogOut sets the reconciler's log output.
+func LogOut(out io.Writer) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		r.log.Logger.SetOutput(out)
+		return nil
+	}
+}
+
+// LogFmt sets the format of the reconciler's log output.
+func LogFmt(fmt logrus.Formatter) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		r.log.Logger.SetFormatter(fmt)
+		return nil
+	}
+}
+
+// LogLevel sets the reconciler's log level.
+func LogLevel(s string) func(*Reconciler) error {
+	return func(r *Reconciler) error {
+		level, err := logrus.ParseLevel(s)
+		if err != nil {
+			return err
+		}
+
+		r.log.Logger.SetLevel(level)
+
+		return nil
+	}
+}
+
+// Run reconciles at the configured interval until the context is cancelled. With leader election configured, it only
+// reconciles while holding the lease. Without it, only one replica may run the reconciler.
+func (r *Reconciler) Run(ctx context.Context) {
+	if r.lock == nil {
+		r.run(ctx)
+		return
+	}
+
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            r.lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Name:            "reconciler",
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: r.run,
+				OnStoppedLeading: func() {
+					r.log.Info("stopped leading")
+				},
+			},
+		})
+	}
+}
+
+func (r *Reconciler) run(ctx context.Context) {
+	r.running.Lock()
+	defer r.running.Unlock()
+
+	r.log.WithField("interval", r.interval).Info("starting reconciler")
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Info("stopping reconciler")
+			return
+		case <-ticker.C:
+			r.ReconcileOnce(ctx)
+		}
+	}
+}
+
+// ReconcileOnce runs all garbage collection steps once. A failing step is logged and does not prevent the other
+// steps from running.
+func (r *Reconciler) ReconcileOnce(ctx context.Context) {
+	r.step(ctx, KindTemporaryResource, func(ctx context.Context) (int, error) {
+		var attachments map[volume.Attachment]struct{}
+
+		if r.attachments != nil {
+			var err error
+
+			attachments, err = r.attachments.Attachments(ctx)
+			if err != nil {
+				return 0, fmt.Errorf("failed to list attachments: %w", err)
+			}
+		}
+
+		return r.gc.RemoveOrphanedTemporaryResources(ctx, attachments)
+	})
+
+	r.step(ctx, KindTemporarySnapshot, func(ctx context.Context) (int, error) {
+		return r.gc.RemoveOrphanedTemporarySnapshots(ctx, r.snapshotMaxAge)
+	})
+
+	r.step(ctx, KindResourceGroup, r.gc.RemoveOrphanedResourceGroups)
+
+	if r.backups != nil {
+		r.step(ctx, KindScheduledBackup, r.reconcileScheduledBackups)
+	}
+}
+
+// reconcileScheduledBackups creates and prunes backups for every snapshot class with a backup schedule. It returns
+// the number of deleted backups.
+func (r *Reconciler) reconcileScheduledBackups(ctx context.Context) (int, error) {
+	classes, err := r.backupClasses.BackupClasses(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshot classes: %w", err)
+	}
+
+	deleted := 0
+
+	var errs []string
+
+	for name, params := range classes {
+		created, d, err := r.backups.ReconcileScheduledBackups(ctx, name, params)
+
+		metrics.ScheduledBackupsCreated(name, created)
+
+		deleted += d
+
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		sort.Strings(errs)
+
+		return deleted, fmt.Errorf("failed to reconcile scheduled backups: %s", strings.Join(errs, "; "))
+	}
+
+	return deleted, nil
+}
+
+func (r *Reconciler) step(ctx context.Context, kind string, f func(ctx context.Context) (int, error)) {
+	log := r.log.WithField("kind", kind)
+
+	removed, err := f(ctx)
+
+	metrics.ReconcilerRemoved(kind, removed)
+
+	if err != nil {
+		metrics.ReconcilerFailed(kind)
+		log.WithError(err).Warn("reconcile step failed")
+
+		return
+	}
+
+	log.WithField("removed", removed).Debug("reconcile step done")
+}
@@ -0,0 +1,287 @@
+package reconciler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/reconciler"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+const driverName = "linstor.csi.linbit.com"
+
+type fakeGC struct {
+	attachments    map[volume.Attachment]struct{}
+	snapshotMaxAge time.Duration
+	resourceErr    error
+	groupsCalled   bool
+}
+
+func (f *fakeGC) RemoveOrphanedTemporaryResources(_ context.Context, attachments map[volume.Attachment]struct{}) (int, error) {
+	f.attachments = attachments
+	return 0, f.resourceErr
+}
+
+func (f *fakeGC) RemoveOrphanedTemporarySnapshots(_ context.Context, maxAge time.Duration) (int, error) {
+	f.snapshotMaxAge = maxAge
+	return 0, nil
+}
+
+func (f *fakeGC) RemoveOrphanedResourceGroups(context.Context) (int, error) {
+	f.groupsCalled = true
+	return 0, nil
+}
+
+func TestReconciler_ReconcileOnce(t *testing.T) {
+	t.Parallel()
+
+	t.Run("without attachment source", func(t *testing.T) {
+		t.Parallel()
+
+		gc := &fakeGC{}
+
+		r, err := reconciler.NewReconciler(gc, reconciler.SnapshotMaxAge(2*time.Hour))
+		assert.NoError(t, err)
+
+		r.ReconcileOnce(context.Background())
+
+		assert.Nil(t, gc.attachments)
+		assert.Equal(t, 2*time.Hour, gc.snapshotMaxAge)
+		assert.True(t, gc.groupsCalled)
+	})
+
+	t.Run("failing step continues", func(t *testing.T) {
+		t.Parallel()
+
+		gc := &fakeGC{resourceErr: errors.New("fake")}
+
+		r, err := reconciler.NewReconciler(gc)
+		assert.NoError(t, err)
+
+		r.ReconcileOnce(context.Background())
+
+		assert.Equal(t, time.Hour, gc.snapshotMaxAge)
+		assert.True(t, gc.groupsCalled)
+	})
+}
+
+func TestNewReconciler_InvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := reconciler.NewReconciler(&fakeGC{}, reconciler.Interval(0))
+	assert.Error(t, err)
+
+	_, err = reconciler.NewReconciler(&fakeGC{}, reconciler.SnapshotMaxAge(-time.Second))
+	assert.Error(t, err)
+
+	_, err = reconciler.NewReconciler(&fakeGC{}, reconciler.LeaderElection(fake.NewSimpleClientset(), "", "lease", "pod-1"))
+	assert.Error(t, err)
+}
+
+type countingGC struct {
+	runs atomic.Int32
+}
+
+func (c *countingGC) RemoveOrphanedTemporaryResources(context.Context, map[volume.Attachment]struct{}) (int, error) {
+	c.runs.Add(1)
+	return 0, nil
+}
+
+func (c *countingGC) RemoveOrphanedTemporarySnapshots(context.Context, time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (c *countingGC) RemoveOrphanedResourceGroups(context.Context) (int, error) {
+	return 0, nil
+}
+
+func TestReconciler_LeaderElection(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leaderGC := &countingGC{}
+	leader, err := reconciler.NewReconciler(leaderGC, reconciler.Interval(10*time.Millisecond), reconciler.LeaderElection(client, "kube-system", "lease", "pod-1"))
+	assert.NoError(t, err)
+
+	go leader.Run(ctx)
+
+	assert.Eventually(t, func() bool { return leaderGC.runs.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	followerGC := &countingGC{}
+	follower, err := reconciler.NewReconciler(followerGC, reconciler.Interval(10*time.Millisecond), reconciler.LeaderElection(client, "kube-system", "lease", "pod-2"))
+	assert.NoError(t, err)
+
+	go follower.Run(ctx)
+
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Zero(t, followerGC.runs.Load())
+
+	lease, err := client.CoordinationV1().Leases("kube-system").Get(ctx, "lease", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-1", *lease.Spec.HolderIdentity)
+}
+
+func TestKubernetesAttachments(t *testing.T) {
+	t.Parallel()
+
+	pvName := func(name string) *string { return &name }
+
+	client := fake.NewSimpleClientset(
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: "pvc-1"},
+			}},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-other"},
+			Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "other.csi.example.com", VolumeHandle: "other"},
+			}},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "va-1"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: driverName,
+				NodeName: "node-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: pvName("pv-1")},
+			},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "va-inline"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: driverName,
+				NodeName: "node-2",
+				Source: storagev1.VolumeAttachmentSource{InlineVolumeSpec: &corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						CSI: &corev1.CSIPersistentVolumeSource{Driver: driverName, VolumeHandle: "pvc-2"},
+					},
+				}},
+			},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "va-other"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: "other.csi.example.com",
+				NodeName: "node-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: pvName("pv-other")},
+			},
+		},
+	)
+
+	source := &reconciler.KubernetesAttachments{Client: client, DriverName: driverName}
+
+	attachments, err := source.Attachments(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[volume.Attachment]struct{}{
+		{VolumeID: "pvc-1", Node: "node-1"}: {},
+		{VolumeID: "pvc-2", Node: "node-2"}: {},
+	}, attachments)
+}
+
+type fakeBackups struct {
+	classes map[string]*volume.SnapshotParameters
+	err     error
+}
+
+func (f *fakeBackups) BackupClasses(context.Context) (map[string]*volume.SnapshotParameters, error) {
+	return f.classes, nil
+}
+
+func (f *fakeBackups) ReconcileScheduledBackups(_ context.Context, class string, params *volume.SnapshotParameters) (int, int, error) {
+	delete(f.classes, class)
+	return 1, 0, f.err
+}
+
+func TestReconciler_ScheduledBackups(t *testing.T) {
+	t.Parallel()
+
+	backups := &fakeBackups{
+		classes: map[string]*volume.SnapshotParameters{
+			"daily":  {Type: volume.SnapshotTypeS3, RemoteName: "s3", BackupSchedule: 24 * time.Hour},
+			"hourly": {Type: volume.SnapshotTypeS3, RemoteName: "s3", BackupSchedule: time.Hour},
+		},
+		err: errors.New("fake"),
+	}
+
+	r, err := reconciler.NewReconciler(&fakeGC{}, reconciler.ScheduledBackups(backups, backups))
+	assert.NoError(t, err)
+
+	r.ReconcileOnce(context.Background())
+
+	// A failing class does not prevent the other classes from being reconciled.
+	assert.Empty(t, backups.classes)
+}
+
+func TestKubernetesBackupClasses(t *testing.T) {
+	t.Parallel()
+
+	snapshotClass := func(name, driver string, params map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion":     "snapshot.storage.k8s.io/v1",
+			"kind":           "VolumeSnapshotClass",
+			"metadata":       map[string]interface{}{"name": name},
+			"driver":         driver,
+			"deletionPolicy": "Delete",
+			"parameters":     params,
+		}}
+	}
+
+	scheme := runtime.NewScheme()
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		reconciler.VolumeSnapshotClassResource: "VolumeSnapshotClassList",
+	},
+		snapshotClass("daily", driverName, map[string]interface{}{
+			linstor.SnapshotParameterNamespace + "/type":            "S3",
+			linstor.SnapshotParameterNamespace + "/remote-name":     "s3",
+			linstor.SnapshotParameterNamespace + "/backup-schedule": "24h",
+			"csi.storage.k8s.io/snapshotter-secret-name":            "s3-keys",
+			"csi.storage.k8s.io/snapshotter-secret-namespace":       "storage",
+		}),
+		snapshotClass("unscheduled", driverName, map[string]interface{}{
+			linstor.SnapshotParameterNamespace + "/type":        "S3",
+			linstor.SnapshotParameterNamespace + "/remote-name": "s3",
+		}),
+		snapshotClass("other", "other.csi.example.com", map[string]interface{}{
+			linstor.SnapshotParameterNamespace + "/backup-schedule": "24h",
+		}),
+	)
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-keys", Namespace: "storage"},
+		Data:       map[string][]byte{"access-key": []byte("admin"), "secret-key": []byte("password")},
+	})
+
+	source := &reconciler.KubernetesBackupClasses{Client: client, Dynamic: dyn, DriverName: driverName}
+
+	classes, err := source.BackupClasses(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*volume.SnapshotParameters{
+		"daily": {
+			Type:           volume.SnapshotTypeS3,
+			RemoteName:     "s3",
+			BackupSchedule: 24 * time.Hour,
+			S3AccessKey:    "admin",
+			S3SecretKey:    "password",
+		},
+	}, classes)
+}
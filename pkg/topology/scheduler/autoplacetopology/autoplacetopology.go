@@ -15,10 +15,17 @@ import (
 	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/util"
 	"github.com/piraeusdatastore/linstor-csi/pkg/slice"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
 	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
+func init() {
+	scheduler.Register(topology.AutoPlaceTopology, func(c *lc.HighLevelClient, log *logrus.Entry) (scheduler.Interface, error) {
+		return NewScheduler(c, log), nil
+	})
+}
+
 // Scheduler places volumes according to both CSI Topology and user-provided autoplace parameters.
 //
 // This scheduler works like autoplace.Scheduler with a few key differences:
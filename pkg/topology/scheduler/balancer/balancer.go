@@ -16,6 +16,7 @@ import (
 	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/util"
 	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
@@ -297,6 +298,17 @@ func pickStoragePool(ctx context.Context, nClient NodeLinstorClient, clientset k
 	return pickStoragePoolFromNodes(ctx, nClient, nodeList)
 }
 
+func init() {
+	scheduler.Register(topology.Balanced, func(c *lc.HighLevelClient, log *logrus.Entry) (scheduler.Interface, error) {
+		b, err := NewScheduler(c, log)
+		if err != nil {
+			return nil, err
+		}
+
+		return b, nil
+	})
+}
+
 type BalanceScheduler struct {
 	log *logrus.Entry
 	*lc.HighLevelClient
@@ -30,9 +30,16 @@ import (
 
 	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
 	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
+func init() {
+	scheduler.Register(topology.FollowTopology, func(c *lc.HighLevelClient, log *logrus.Entry) (scheduler.Interface, error) {
+		return NewScheduler(c, log), nil
+	})
+}
+
 // Scheduler places volumes according to linstor's autoplace feature.
 type Scheduler struct {
 	*lc.HighLevelClient
@@ -22,11 +22,20 @@ import (
 	"context"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
 
 	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
+func init() {
+	scheduler.Register(topology.Manual, func(c *lc.HighLevelClient, _ *logrus.Entry) (scheduler.Interface, error) {
+		return NewScheduler(c), nil
+	})
+}
+
 // Scheduler places volumes according to linstor's autoplace feature.
 type Scheduler struct {
 	*lc.HighLevelClient
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+// Factory creates a new scheduler using the given client.
+type Factory func(c *lc.HighLevelClient, log *logrus.Entry) (Interface, error)
+
+// Validator returns an error if a scheduler does not support the given parameters.
+type Validator func(params *volume.Parameters) error
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[topology.PlacementPolicy]Factory)
+	validators = make(map[topology.PlacementPolicy]Validator)
+)
+
+// Register makes a scheduler available for the given placement policy. It is meant to be called from the init
+// function of the package implementing the scheduler.
+//
+// Register panics if a scheduler for the policy is already registered.
+func Register(policy topology.PlacementPolicy, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("scheduler factory for %s is nil", policy))
+	}
+
+	if _, ok := registry[policy]; ok {
+		panic(fmt.Sprintf("scheduler for %s already registered", policy))
+	}
+
+	registry[policy] = factory
+}
+
+// RegisterValidator makes Supported reject parameters the scheduler for the given placement policy does not support,
+// instead of silently ignoring them. It is meant to be called from the init function of the package implementing the
+// scheduler.
+func RegisterValidator(policy topology.PlacementPolicy, validator Validator) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	validators[policy] = validator
+}
+
+// New creates the scheduler registered for the given placement policy.
+func New(policy topology.PlacementPolicy, c *lc.HighLevelClient, log *logrus.Entry) (Interface, error) {
+	registryMu.RLock()
+	factory, ok := registry[policy]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, unsupportedError(policy)
+	}
+
+	return factory(c, log)
+}
+
+// Supported returns an error if no scheduler is registered for the placement policy of the parameters, or if the
+// scheduler does not support the parameters. It allows rejecting parameters before any volume is created.
+func Supported(params *volume.Parameters) error {
+	registryMu.RLock()
+	_, ok := registry[params.PlacementPolicy]
+	validator := validators[params.PlacementPolicy]
+	registryMu.RUnlock()
+
+	if !ok {
+		return unsupportedError(params.PlacementPolicy)
+	}
+
+	if validator != nil {
+		return validator(params)
+	}
+
+	return nil
+}
+
+func unsupportedError(policy topology.PlacementPolicy) error {
+	return fmt.Errorf("unsupported volume scheduler: '%s', expected one of %v", policy, Registered())
+}
+
+// Registered returns all placement policies with a registered scheduler, sorted by name.
+func Registered() []topology.PlacementPolicy {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	result := make([]topology.PlacementPolicy, 0, len(registry))
+	for policy := range registry {
+		result = append(result, policy)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+
+	return result
+}
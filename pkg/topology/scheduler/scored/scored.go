@@ -0,0 +1,399 @@
+// Package scored implements a scheduler that ranks all candidate nodes by a weighted score and places replicas on the
+// best nodes.
+package scored
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	lapiconsts "github.com/LINBIT/golinstor"
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor/util"
+	"github.com/piraeusdatastore/linstor-csi/pkg/slice"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+// Options for the scheduler, set via the scheduler.linstor.csi.linbit.com namespace in the storage class parameters.
+const (
+	// OptionFreeCapacityWeight is the weight of the free capacity in the storage pool.
+	OptionFreeCapacityWeight = "freeCapacityWeight"
+	// OptionReplicaCountWeight is the weight of the number of replicas already deployed on the node.
+	OptionReplicaCountWeight = "replicaCountWeight"
+	// OptionAffinityWeight is the weight of the matching node properties.
+	OptionAffinityWeight = "affinityWeight"
+	// OptionNodeAffinity is a space separated list of "key=value" node properties. Keys without namespace refer to
+	// the "Aux/" namespace.
+	OptionNodeAffinity = "nodeAffinity"
+)
+
+const defaultWeight = 1.0
+
+func init() {
+	scheduler.Register(topology.Scored, func(c *lc.HighLevelClient, log *logrus.Entry) (scheduler.Interface, error) {
+		return NewScheduler(c, log), nil
+	})
+	scheduler.RegisterValidator(topology.Scored, validate)
+}
+
+// validate rejects the placement constraints of the LINSTOR autoplacer, which the scheduler does not implement.
+func validate(params *volume.Parameters) error {
+	if len(params.ReplicasOnSame) != 0 || len(params.ReplicasOnDifferent) != 0 || params.DoNotPlaceWithRegex != "" {
+		return fmt.Errorf("placement policy %s does not support replicasOnSame, replicasOnDifferent and doNotPlaceWithRegex", topology.Scored)
+	}
+
+	return nil
+}
+
+// Scheduler places replicas on the nodes with the highest score.
+//
+// Every candidate node is scored from:
+// * the free capacity of its storage pool, relative to the node with the most free capacity.
+// * the number of diskful replicas already on the node, relative to the node with the most replicas. Fewer is better.
+// * the fraction of the configured node affinity properties set on the node.
+//
+// Each factor is in the range [0, 1] and multiplied by its configured weight.
+type Scheduler struct {
+	*lc.HighLevelClient
+	log *logrus.Entry
+}
+
+var _ scheduler.Interface = &Scheduler{}
+
+func NewScheduler(c *lc.HighLevelClient, l *logrus.Entry) *Scheduler {
+	return &Scheduler{HighLevelClient: c, log: l.WithField("scheduler", "scored")}
+}
+
+type options struct {
+	freeCapacityWeight float64
+	replicaCountWeight float64
+	affinityWeight     float64
+	nodeAffinity       map[string]string
+}
+
+func parseOptions(raw map[string]string) (*options, error) {
+	opts := &options{
+		freeCapacityWeight: defaultWeight,
+		replicaCountWeight: defaultWeight,
+		affinityWeight:     defaultWeight,
+		nodeAffinity:       make(map[string]string),
+	}
+
+	for k, v := range raw {
+		var err error
+
+		switch k {
+		case OptionFreeCapacityWeight:
+			opts.freeCapacityWeight, err = parseWeight(v)
+		case OptionReplicaCountWeight:
+			opts.replicaCountWeight, err = parseWeight(v)
+		case OptionAffinityWeight:
+			opts.affinityWeight, err = parseWeight(v)
+		case OptionNodeAffinity:
+			for _, term := range strings.Fields(v) {
+				parts := strings.SplitN(term, "=", 2)
+				if len(parts) != 2 || parts[0] == "" {
+					return nil, fmt.Errorf("invalid node affinity '%s', expected 'key=value'", term)
+				}
+
+				key := parts[0]
+				if !strings.Contains(key, "/") {
+					key = lapiconsts.NamespcAuxiliary + "/" + key
+				}
+
+				opts.nodeAffinity[key] = parts[1]
+			}
+		default:
+			return nil, fmt.Errorf("unknown option '%s'", k)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid option '%s': %w", k, err)
+		}
+	}
+
+	return opts, nil
+}
+
+func parseWeight(v string) (float64, error) {
+	w, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if w < 0 {
+		return 0, fmt.Errorf("weight must not be negative")
+	}
+
+	return w, nil
+}
+
+// candidate is a node that can receive a new replica.
+type candidate struct {
+	node         string
+	storagePool  string
+	freeCapacity int64
+	replicas     int
+	affinity     float64
+	score        float64
+}
+
+// Create places the missing replicas of the volume on the nodes with the highest score.
+//
+// If the volume has no replica yet, the first replica is placed on the best node in the first preferred topology
+// segment that has any candidate. If requisite topologies are given, only nodes accessible from them are considered.
+func (s *Scheduler) Create(ctx context.Context, volId string, params *volume.Parameters, topologies *csi.TopologyRequirement) error {
+	log := s.log.WithField("volume", volId)
+
+	opts, err := parseOptions(params.SchedulerOptions)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid scheduler options: %v", err)
+	}
+
+	existingRes, err := s.Resources.GetAll(ctx, volId)
+	if err != nil {
+		return fmt.Errorf("failed to check existing resources: %w", err)
+	}
+
+	diskfulNodes := util.DeployedDiskfullyNodes(existingRes)
+
+	remaining := int(params.PlacementCount) - len(diskfulNodes)
+	if remaining <= 0 {
+		log.Debug("resource already deployed with required replica count")
+		return nil
+	}
+
+	candidates, err := s.candidates(ctx, params, topologies, diskfulNodes, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(diskfulNodes) == 0 {
+		candidates, err = s.preferFirst(ctx, candidates, topologies.GetPreferred())
+		if err != nil {
+			return err
+		}
+	}
+
+	log.WithField("candidates", candidates).Trace("scored candidate nodes")
+
+	placed := 0
+
+	for _, c := range candidates {
+		if placed >= remaining {
+			break
+		}
+
+		create, err := params.ToDiskfullResourceCreate(volId, c.node)
+		if err != nil {
+			return err
+		}
+
+		create.Resource.Props[lapiconsts.KeyStorPoolName] = c.storagePool
+
+		err = s.Resources.Create(ctx, create)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"node":   c.node,
+				"reason": err,
+			}).Info("unable to place replica on node, skipping...")
+
+			continue
+		}
+
+		placed++
+	}
+
+	if placed < remaining {
+		return status.Errorf(codes.ResourceExhausted, "only placed %d of %d missing replicas", placed, remaining)
+	}
+
+	return nil
+}
+
+// candidates returns all nodes that could receive a new replica, sorted by score, best first.
+func (s *Scheduler) candidates(ctx context.Context, params *volume.Parameters, topologies *csi.TopologyRequirement, diskfulNodes []string, opts *options) ([]candidate, error) {
+	var allowedNodes []string
+
+	if len(topologies.GetRequisite()) > 0 {
+		var err error
+
+		allowedNodes, err = s.GetAllTopologyNodes(ctx, params.AllowRemoteVolumeAccess, topologies.GetRequisite())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get requisite node list: %w", err)
+		}
+	}
+
+	nodes, err := s.Nodes.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	pools, err := s.Nodes.GetStoragePoolView(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage pools: %w", err)
+	}
+
+	allResources, err := s.Resources.GetResourceView(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	replicas := make(map[string]int)
+
+	for i := range allResources {
+		if util.DeployedDiskfully(allResources[i].Resource) {
+			replicas[allResources[i].NodeName]++
+		}
+	}
+
+	var result []candidate
+
+	for i := range nodes {
+		node := &nodes[i]
+
+		if node.ConnectionStatus != "ONLINE" || slice.ContainsString(diskfulNodes, node.Name) {
+			continue
+		}
+
+		if allowedNodes != nil && !slice.ContainsString(allowedNodes, node.Name) {
+			continue
+		}
+
+		pool := bestStoragePool(pools, node.Name, params.StoragePool)
+		if pool == nil {
+			continue
+		}
+
+		result = append(result, candidate{
+			node:         node.Name,
+			storagePool:  pool.StoragePoolName,
+			freeCapacity: pool.FreeCapacity,
+			replicas:     replicas[node.Name],
+			affinity:     affinity(node.Props, opts.nodeAffinity),
+		})
+	}
+
+	score(result, opts)
+
+	return result, nil
+}
+
+// bestStoragePool returns the storage pool on the node that should receive a replica. If a storage pool name is
+// configured, only that pool is considered. Otherwise, the diskful pool with the most free capacity is chosen.
+func bestStoragePool(pools []lapi.StoragePool, node, name string) *lapi.StoragePool {
+	var best *lapi.StoragePool
+
+	for i := range pools {
+		pool := &pools[i]
+
+		if pool.NodeName != node || pool.ProviderKind == lapi.DISKLESS {
+			continue
+		}
+
+		if name != "" && pool.StoragePoolName != name {
+			continue
+		}
+
+		if best == nil || pool.FreeCapacity > best.FreeCapacity {
+			best = pool
+		}
+	}
+
+	return best
+}
+
+// affinity returns the fraction of wanted properties set on the node.
+func affinity(props, wanted map[string]string) float64 {
+	if len(wanted) == 0 {
+		return 0
+	}
+
+	matched := 0
+
+	for k, v := range wanted {
+		if props[k] == v {
+			matched++
+		}
+	}
+
+	return float64(matched) / float64(len(wanted))
+}
+
+// score computes the score of all candidates and sorts them, best first. Candidates with the same score are sorted
+// by name, so placement is deterministic.
+func score(candidates []candidate, opts *options) {
+	var maxFree int64
+
+	maxReplicas := 0
+
+	for i := range candidates {
+		if candidates[i].freeCapacity > maxFree {
+			maxFree = candidates[i].freeCapacity
+		}
+
+		if candidates[i].replicas > maxReplicas {
+			maxReplicas = candidates[i].replicas
+		}
+	}
+
+	for i := range candidates {
+		c := &candidates[i]
+
+		capacityScore := 0.0
+		if maxFree > 0 {
+			capacityScore = float64(c.freeCapacity) / float64(maxFree)
+		}
+
+		replicaScore := 1.0
+		if maxReplicas > 0 {
+			replicaScore = 1 - float64(c.replicas)/float64(maxReplicas)
+		}
+
+		c.score = opts.freeCapacityWeight*capacityScore + opts.replicaCountWeight*replicaScore + opts.affinityWeight*c.affinity
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+
+		return candidates[i].node < candidates[j].node
+	})
+}
+
+// preferFirst moves the best candidate of the first preferred segment with any candidate to the front.
+func (s *Scheduler) preferFirst(ctx context.Context, candidates []candidate, preferred []*csi.Topology) ([]candidate, error) {
+	for _, pref := range preferred {
+		nodes, err := s.NodesForTopology(ctx, pref.GetSegments())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get preferred node list from segments: %w", err)
+		}
+
+		for i := range candidates {
+			if slice.ContainsString(nodes, candidates[i].node) {
+				best := candidates[i]
+				copy(candidates[1:i+1], candidates[:i])
+				candidates[0] = best
+
+				return candidates, nil
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+func (s *Scheduler) AccessibleTopologies(ctx context.Context, volId string, remoteAccessPolicy volume.RemoteAccessPolicy) ([]*csi.Topology, error) {
+	return s.GenericAccessibleTopologies(ctx, volId, remoteAccessPolicy)
+}
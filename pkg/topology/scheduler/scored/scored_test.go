@@ -0,0 +1,201 @@
+package scored_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lapiconsts "github.com/LINBIT/golinstor"
+	lapi "github.com/LINBIT/golinstor/client"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/client/mocks"
+	lc "github.com/piraeusdatastore/linstor-csi/pkg/linstor/highlevelclient"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/scored"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+const volumeId = "test-volume"
+
+var (
+	nodes = []lapi.Node{
+		{Name: "node1", ConnectionStatus: "ONLINE", Props: map[string]string{"Aux/zone": "a"}},
+		{Name: "node2", ConnectionStatus: "ONLINE", Props: map[string]string{"Aux/zone": "b"}},
+		{Name: "node3", ConnectionStatus: "ONLINE", Props: map[string]string{"Aux/zone": "b"}},
+		{Name: "node4", ConnectionStatus: "OFFLINE", Props: map[string]string{"Aux/zone": "a"}},
+	}
+	pools = []lapi.StoragePool{
+		{NodeName: "node1", StoragePoolName: "DfltDisklessStorPool", ProviderKind: lapi.DISKLESS},
+		{NodeName: "node1", StoragePoolName: "thin", ProviderKind: lapi.LVM_THIN, FreeCapacity: 1000},
+		{NodeName: "node1", StoragePoolName: "thick", ProviderKind: lapi.LVM, FreeCapacity: 100},
+		{NodeName: "node2", StoragePoolName: "thin", ProviderKind: lapi.LVM_THIN, FreeCapacity: 500},
+		{NodeName: "node3", StoragePoolName: "thin", ProviderKind: lapi.LVM_THIN, FreeCapacity: 800},
+		{NodeName: "node3", StoragePoolName: "thick", ProviderKind: lapi.LVM, FreeCapacity: 900},
+		{NodeName: "node4", StoragePoolName: "thin", ProviderKind: lapi.LVM_THIN, FreeCapacity: 10000},
+	}
+	// node1 already hosts 2 replicas of other volumes, node3 one.
+	otherResources = []lapi.ResourceWithVolumes{
+		{Resource: lapi.Resource{Name: "other1", NodeName: "node1"}},
+		{Resource: lapi.Resource{Name: "other2", NodeName: "node1"}},
+		{Resource: lapi.Resource{Name: "other2", NodeName: "node3"}},
+		{Resource: lapi.Resource{Name: "other3", NodeName: "node2", Flags: []string{lapiconsts.FlagDiskless}}},
+	}
+)
+
+func TestRegistered(t *testing.T) {
+	assert.Contains(t, scheduler.Registered(), topology.Scored)
+
+	sched, err := scheduler.New(topology.Scored, &lc.HighLevelClient{}, logrus.WithField("test", t.Name()))
+	assert.NoError(t, err)
+	assert.IsType(t, &scored.Scheduler{}, sched)
+}
+
+func TestSupported(t *testing.T) {
+	testcases := []struct {
+		name    string
+		params  volume.Parameters
+		wantErr bool
+	}{
+		{name: "default", params: volume.Parameters{PlacementPolicy: topology.Scored}},
+		{name: "replicas-on-same", params: volume.Parameters{PlacementPolicy: topology.Scored, ReplicasOnSame: []string{"zone"}}, wantErr: true},
+		{name: "replicas-on-different", params: volume.Parameters{PlacementPolicy: topology.Scored, ReplicasOnDifferent: []string{"zone"}}, wantErr: true},
+		{name: "do-not-place-with-regex", params: volume.Parameters{PlacementPolicy: topology.Scored, DoNotPlaceWithRegex: "db-.*"}, wantErr: true},
+	}
+
+	for i := range testcases {
+		tcase := &testcases[i]
+		t.Run(tcase.name, func(t *testing.T) {
+			err := scheduler.Supported(&tcase.params)
+			if tcase.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestScheduler_Create(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		params      volume.Parameters
+		topologies  *csi.TopologyRequirement
+		existing    []lapi.Resource
+		failOn      string
+		expected    map[string]string
+		expectedErr codes.Code
+	}{
+		{
+			name:     "default weights",
+			params:   volume.Parameters{PlacementCount: 2},
+			expected: map[string]string{"node3": "thick", "node2": "thin"},
+		},
+		{
+			name:     "only capacity",
+			params:   volume.Parameters{PlacementCount: 2, SchedulerOptions: map[string]string{scored.OptionReplicaCountWeight: "0"}},
+			expected: map[string]string{"node1": "thin", "node3": "thick"},
+		},
+		{
+			name:     "fixed storage pool",
+			params:   volume.Parameters{PlacementCount: 1, StoragePool: "thick", SchedulerOptions: map[string]string{scored.OptionReplicaCountWeight: "0"}},
+			expected: map[string]string{"node3": "thick"},
+		},
+		{
+			name: "affinity",
+			params: volume.Parameters{PlacementCount: 1, SchedulerOptions: map[string]string{
+				scored.OptionNodeAffinity:   "zone=a",
+				scored.OptionAffinityWeight: "10",
+			}},
+			expected: map[string]string{"node1": "thin"},
+		},
+		{
+			name:     "already placed",
+			params:   volume.Parameters{PlacementCount: 2},
+			existing: []lapi.Resource{{Name: volumeId, NodeName: "node3"}},
+			expected: map[string]string{"node2": "thin"},
+		},
+		{
+			name:   "requisite",
+			params: volume.Parameters{PlacementCount: 1, AllowRemoteVolumeAccess: volume.RemoteAccessPolicyLocalOnly},
+			topologies: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{{Segments: map[string]string{topology.LinstorNodeKey: "node1"}}},
+			},
+			expected: map[string]string{"node1": "thin"},
+		},
+		{
+			name:   "preferred",
+			params: volume.Parameters{PlacementCount: 2},
+			topologies: &csi.TopologyRequirement{
+				Preferred: []*csi.Topology{{Segments: map[string]string{topology.LinstorNodeKey: "node1"}}},
+			},
+			expected: map[string]string{"node1": "thin", "node2": "thin"},
+		},
+		{
+			name:     "skip failed nodes",
+			params:   volume.Parameters{PlacementCount: 2},
+			failOn:   "node2",
+			expected: map[string]string{"node3": "thick", "node1": "thin"},
+		},
+		{
+			name:        "not enough nodes",
+			params:      volume.Parameters{PlacementCount: 4},
+			expected:    map[string]string{"node1": "thin", "node2": "thin", "node3": "thick"},
+			expectedErr: codes.ResourceExhausted,
+		},
+		{
+			name:        "invalid options",
+			params:      volume.Parameters{PlacementCount: 1, SchedulerOptions: map[string]string{scored.OptionAffinityWeight: "-1"}},
+			expected:    map[string]string{},
+			expectedErr: codes.InvalidArgument,
+		},
+	}
+
+	for i := range testcases {
+		tcase := &testcases[i]
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			nodeMock := &mocks.NodeProvider{}
+			nodeMock.On("GetAll", mock.Anything).Return(nodes, nil)
+			nodeMock.On("GetStoragePoolView", mock.Anything).Return(pools, nil)
+
+			created := make(map[string]string)
+
+			resMock := &mocks.ResourceProvider{}
+			resMock.On("GetAll", mock.Anything, volumeId).Return(tcase.existing, nil)
+			resMock.On("GetResourceView", mock.Anything).Return(otherResources, nil)
+			resMock.On("Create", mock.Anything, mock.Anything).Return(func(_ context.Context, create lapi.ResourceCreate) error {
+				if create.Resource.NodeName == tcase.failOn {
+					return errors.New("fake")
+				}
+
+				created[create.Resource.NodeName] = create.Resource.Props[lapiconsts.KeyStorPoolName]
+
+				return nil
+			})
+
+			cl := &lc.HighLevelClient{Client: &lapi.Client{Nodes: nodeMock, Resources: resMock}}
+			sched := scored.NewScheduler(cl, logrus.WithField("test", t.Name()))
+
+			err := sched.Create(ctx, volumeId, &tcase.params, tcase.topologies)
+			if tcase.expectedErr != codes.OK {
+				assert.Equal(t, tcase.expectedErr, status.Code(err))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tcase.expected, created)
+		})
+	}
+}
@@ -20,30 +20,41 @@ package topology
 
 import "fmt"
 
-//go:generate go run github.com/alvaroloes/enumer@v1.1.2 -type=PlacementPolicy
-
 // PlacementPolicy determines which scheduler will create volumes and report
 // their accessible topology.
-type PlacementPolicy int
+//
+// Schedulers register themselves for a policy, see scheduler.Register.
+type PlacementPolicy string
 
 const (
 	// Unknown placement policy
-	Unknown PlacementPolicy = iota
+	Unknown PlacementPolicy = ""
 	// Manual place volumes with a list of nodes and clients.
-	Manual
+	Manual PlacementPolicy = "Manual"
 	// AutoPlace volumes using linstor's built in autoplace feature.
-	AutoPlace
+	AutoPlace PlacementPolicy = "AutoPlace"
 	// FollowTopology place volumes local to topology preferences, in order
 	// of those preferences.
-	FollowTopology
+	FollowTopology PlacementPolicy = "FollowTopology"
 	// Balanced places remote volumes in the same zone(Rack)
 	// and pick Node, StoragePool, PrefNic based on utilization
-	Balanced
+	Balanced PlacementPolicy = "Balanced"
 	// AutoPlaceTopology places volumes based on topology parameters and LINSTOR
 	// autoplace selection in the storage class.
-	AutoPlaceTopology
+	AutoPlaceTopology PlacementPolicy = "AutoPlaceTopology"
+	// Scored places volumes on the nodes with the highest score, computed from
+	// weighted free capacity, existing replica count and node property affinity.
+	Scored PlacementPolicy = "Scored"
 )
 
+func (p PlacementPolicy) String() string {
+	if p == Unknown {
+		return "Unknown"
+	}
+
+	return string(p)
+}
+
 const (
 	// LinstorNodeKey refers to a node running the LINSTOR csi node service
 	// and the linstor Satellite and is therefore capable of hosting LINSTOR volumes.
@@ -0,0 +1,93 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/tracing"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	oldProvider := otel.GetTracerProvider()
+	oldPropagator := otel.GetTextMapPropagator()
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+
+	return recorder
+}
+
+func TestStartEnd(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	_, child := tracing.Start(ctx, "child")
+	tracing.End(child, errors.New("failed"))
+	tracing.End(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "child", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "failed", spans[0].Status().Description)
+
+	assert.Equal(t, "parent", spans[1].Name())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestRoundTripper(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var traceparent string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/resource-definitions/pvc-1234", nil)
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: tracing.RoundTripper(http.DefaultTransport)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	tracing.End(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "GET /v1/resource-definitions/:name", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Contains(t, traceparent, spans[0].SpanContext().TraceID().String())
+}
+
+func TestSetupInvalidEndpoint(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), "grpc://collector:4317", "v0.0.0")
+	assert.Error(t, err)
+}
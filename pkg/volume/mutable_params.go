@@ -0,0 +1,106 @@
+package volume
+
+import (
+	"fmt"
+	"strings"
+
+	lc "github.com/LINBIT/golinstor"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+)
+
+// MutableParameters are the parameters that can be changed on an existing volume, for example using a
+// VolumeAttributesClass. They use the same keys as the storage class parameters.
+type MutableParameters struct {
+	// ResourceGroup the volume is moved to. Unchanged if empty.
+	ResourceGroup string
+	// PlacementCount is the number of diskful replicas of the volume. Unchanged if 0.
+	PlacementCount int32
+	// Properties are set on the resource definition of the volume.
+	Properties map[string]string
+	// StoragePool all diskful replicas are migrated to. Unchanged if empty.
+	StoragePool string
+	// EvacuateNodes are the nodes diskful replicas are migrated away from.
+	EvacuateNodes []string
+}
+
+// NeedsMigration returns true if replicas of the volume may have to be moved to other storage pools or nodes.
+func (p *MutableParameters) NeedsMigration() bool {
+	return p.StoragePool != "" || len(p.EvacuateNodes) > 0
+}
+
+// NewMutableParameters parses the parameters to change on an existing volume. Parameters that can only be set when
+// the volume is created are rejected.
+func NewMutableParameters(params map[string]string) (*MutableParameters, error) {
+	p := &MutableParameters{
+		Properties: make(map[string]string),
+	}
+
+	for k, v := range params {
+		parts := strings.SplitN(k, "/", 2)
+
+		var namespace, rawkey string
+		if len(parts) < 2 {
+			namespace = ""
+			rawkey = k
+		} else {
+			namespace = parts[0]
+			rawkey = parts[1]
+		}
+
+		var param paramKey
+
+		switch namespace {
+		case lc.NamespcDrbdOptions:
+			p.Properties[lc.NamespcDrbdOptions+"/"+rawkey] = v
+			continue
+		case linstor.PropertyNamespace:
+			p.Properties[rawkey] = v
+			continue
+		case linstor.SchedulerParameterNamespace:
+			return nil, fmt.Errorf("parameter '%s' cannot be changed on an existing volume", k)
+		case linstor.ParameterNamespace, "":
+			parsed, err := paramKeyString(strings.ToLower(rawkey))
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameter: %w", err)
+			}
+
+			param = parsed
+		default:
+			// Probably some external parameter, ignore
+			continue
+		}
+
+		switch param {
+		case resourcegroup:
+			if v == "" {
+				return nil, fmt.Errorf("invalid resource group: must not be empty")
+			}
+
+			p.ResourceGroup = v
+		case autoplace, placementcount:
+			count, err := parsePlacementCount(v)
+			if err != nil {
+				return nil, err
+			}
+
+			if count < 1 {
+				return nil, fmt.Errorf("invalid placement count %d: must be at least 1", count)
+			}
+
+			p.PlacementCount = count
+		case storagepool:
+			if v == "" {
+				return nil, fmt.Errorf("invalid storage pool: must not be empty")
+			}
+
+			p.StoragePool = v
+		case evacuatenodes:
+			p.EvacuateNodes = strings.Fields(v)
+		default:
+			return nil, fmt.Errorf("parameter '%s' cannot be changed on an existing volume", k)
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,100 @@
+package volume_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+)
+
+func TestNewMutableParameters(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		rawParameters map[string]string
+		expected      *volume.MutableParameters
+		expectedErr   string
+	}{
+		{
+			name:     "empty",
+			expected: &volume.MutableParameters{Properties: map[string]string{}},
+		},
+		{
+			name: "all-mutable",
+			rawParameters: map[string]string{
+				linstor.ParameterNamespace + "/resourceGroup":              "rg-fast",
+				linstor.ParameterNamespace + "/placementCount":             "3",
+				linstor.PropertyNamespace + "/DrbdOptions/Net/max-buffers": "10000",
+				"DrbdOptions/auto-quorum":                                  "suspend-io",
+				"csi.storage.k8s.io/some-external-parameter":               "ignored",
+				linstor.PropertyNamespace + "/Aux/csi-backup-class":        "daily",
+			},
+			expected: &volume.MutableParameters{
+				ResourceGroup:  "rg-fast",
+				PlacementCount: 3,
+				Properties: map[string]string{
+					"DrbdOptions/Net/max-buffers": "10000",
+					"DrbdOptions/auto-quorum":     "suspend-io",
+					"Aux/csi-backup-class":        "daily",
+				},
+			},
+		},
+		{
+			name: "migration",
+			rawParameters: map[string]string{
+				linstor.ParameterNamespace + "/storagePool":   "nvme",
+				linstor.ParameterNamespace + "/evacuateNodes": "node-1 node-2",
+			},
+			expected: &volume.MutableParameters{
+				StoragePool:   "nvme",
+				EvacuateNodes: []string{"node-1", "node-2"},
+				Properties:    map[string]string{},
+			},
+		},
+		{
+			name:          "empty-storage-pool",
+			rawParameters: map[string]string{linstor.ParameterNamespace + "/storagePool": ""},
+			expectedErr:   "invalid storage pool: must not be empty",
+		},
+		{
+			name:          "immutable-layer-list",
+			rawParameters: map[string]string{linstor.ParameterNamespace + "/layerList": "drbd storage"},
+			expectedErr:   "parameter 'linstor.csi.linbit.com/layerList' cannot be changed on an existing volume",
+		},
+		{
+			name:          "immutable-scheduler-option",
+			rawParameters: map[string]string{linstor.SchedulerParameterNamespace + "/weights": "1"},
+			expectedErr:   "parameter 'scheduler.linstor.csi.linbit.com/weights' cannot be changed on an existing volume",
+		},
+		{
+			name:          "zero-placement-count",
+			rawParameters: map[string]string{"placementCount": "0"},
+			expectedErr:   "invalid placement count 0: must be at least 1",
+		},
+		{
+			name:          "unknown-parameter",
+			rawParameters: map[string]string{linstor.ParameterNamespace + "/foo": "bar"},
+			expectedErr:   "invalid parameter: foo does not belong to paramKey values",
+		},
+	}
+
+	for i := range cases {
+		tcase := &cases[i]
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := volume.NewMutableParameters(tcase.rawParameters)
+
+			if tcase.expected != nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tcase.expectedErr)
+			}
+
+			assert.Equal(t, tcase.expected, actual)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package volume
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -40,6 +41,9 @@ const (
 	postmountxfsopts
 	resourcegroup
 	usepvcname
+	nfsexport
+	evacuatenodes
+	adopt
 )
 
 // Parameters configuration for linstor volumes.
@@ -89,8 +93,38 @@ type Parameters struct {
 	ResourceGroup string
 	// Properties are the properties to be set on the resource group.
 	Properties map[string]string
+	// SchedulerOptions are passed to the scheduler selected by PlacementPolicy. Their meaning depends on the
+	// scheduler.
+	SchedulerOptions map[string]string
 	// UsePvcName derives the volume name from the PVC name+namespace, if that information is available.
 	UsePvcName bool
+	// NFSExport makes filesystem volumes available in RWX mode: the node using the volume exports it over NFS to all
+	// other nodes.
+	NFSExport bool
+	// Adopt makes CreateVolume take over an existing resource definition with the volume ID that was not created by
+	// the plugin, instead of creating a new volume.
+	Adopt bool
+	// LuksPassphrase is used by the LUKS layer of the volume instead of a key generated by LINSTOR. Set from the
+	// provisioner secrets, see ApplySecrets.
+	LuksPassphrase Secret `json:"-"`
+}
+
+// LuksPassphraseKey is the key of the LUKS passphrase in provisioner and node-stage secrets.
+const LuksPassphraseKey = "luks-passphrase"
+
+// Secret is a string that is never printed, so it does not end up in logs.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return "***"
+}
+
+func (s Secret) GoString() string {
+	return s.String()
 }
 
 const DefaultDisklessStoragePoolName = "DfltDisklessStorPool"
@@ -110,6 +144,7 @@ func NewParameters(params map[string]string) (Parameters, error) {
 		PlacementPolicy:         topology.AutoPlaceTopology,
 		AllowRemoteVolumeAccess: DefaultRemoteAccessPolicy,
 		Properties:              make(map[string]string),
+		SchedulerOptions:        make(map[string]string),
 	}
 
 	for k, v := range params {
@@ -135,6 +170,10 @@ func NewParameters(params map[string]string) (Parameters, error) {
 			k = k[len(linstor.PropertyNamespace)+1:]
 			p.Properties[k] = v
 
+			continue
+		case linstor.SchedulerParameterNamespace:
+			p.SchedulerOptions[rawkey] = v
+
 			continue
 		case linstor.ParameterNamespace, "":
 			parsed, err := paramKeyString(strings.ToLower(rawkey))
@@ -167,16 +206,12 @@ func NewParameters(params map[string]string) (Parameters, error) {
 		case disklessstoragepool:
 			p.DisklessStoragePool = v
 		case autoplace, placementcount:
-			if v == "" {
-				v = "1"
-			}
-
-			count, err := strconv.ParseInt(v, 10, 32)
+			count, err := parsePlacementCount(v)
 			if err != nil {
-				return p, fmt.Errorf("bad parameters: unable to parse %q as a 32 bit integer", v)
+				return p, err
 			}
 
-			p.PlacementCount = int32(count)
+			p.PlacementCount = count
 		case donotplacewithregex:
 			p.DoNotPlaceWithRegex = v
 		case encryption:
@@ -204,12 +239,13 @@ func NewParameters(params map[string]string) (Parameters, error) {
 		case clientlist:
 			p.ClientList = strings.Split(v, " ")
 		case placementpolicy:
-			policy, err := topology.PlacementPolicyString(v)
-			if err != nil {
-				return p, fmt.Errorf("invalid placement policy: %w", err)
+			if v == "" {
+				return p, fmt.Errorf("invalid placement policy: must not be empty")
 			}
 
-			p.PlacementPolicy = policy
+			// Whether a scheduler exists for the policy is checked when the scheduler is created, as external
+			// schedulers may register additional policies.
+			p.PlacementPolicy = topology.PlacementPolicy(v)
 		case mountopts:
 			p.MountOpts = v
 		case fsopts:
@@ -225,6 +261,23 @@ func NewParameters(params map[string]string) (Parameters, error) {
 			}
 
 			p.UsePvcName = u
+		case nfsexport:
+			n, err := strconv.ParseBool(v)
+			if err != nil {
+				return p, err
+			}
+
+			p.NFSExport = n
+		case adopt:
+			a, err := strconv.ParseBool(v)
+			if err != nil {
+				return p, err
+			}
+
+			p.Adopt = a
+		case evacuatenodes:
+			// Only used to migrate existing volumes, see MutableParameters. Mutable parameters are also passed on
+			// volume creation, so the parameter is ignored here.
 		case sizekib:
 			// This parameter was unused. It is just parsed to not break any old storage classes that might be using
 			// it. Storage sizes are handled via CSI requests directly.
@@ -244,7 +297,7 @@ func NewParameters(params map[string]string) (Parameters, error) {
 		}
 
 		namespace := uuid.UUID(linstor.ResourceGroupNamespace)
-		p.ResourceGroup = "sc-" + uuid.NewSHA1(namespace, encoded).String()
+		p.ResourceGroup = linstor.GeneratedResourceGroupPrefix + uuid.NewSHA1(namespace, encoded).String()
 	}
 
 	// User has manually configured deployments, ignore autoplacing options.
@@ -259,6 +312,44 @@ func NewParameters(params map[string]string) (Parameters, error) {
 	return p, nil
 }
 
+// DeprecatedParameters returns a warning for every parameter that NewParameters still accepts, but that no longer has
+// any effect.
+func DeprecatedParameters(params map[string]string) []string {
+	var warnings []string
+
+	for k := range params {
+		rawkey := k
+		if namespace, key, ok := strings.Cut(k, "/"); ok {
+			if namespace != linstor.ParameterNamespace {
+				continue
+			}
+
+			rawkey = key
+		}
+
+		if strings.ToLower(rawkey) == sizekib.String() {
+			warnings = append(warnings, fmt.Sprintf("parameter '%s' is deprecated and has no effect: volume sizes are set by the PersistentVolumeClaim", k))
+		}
+	}
+
+	slices.Sort(warnings)
+
+	return warnings
+}
+
+func parsePlacementCount(v string) (int32, error) {
+	if v == "" {
+		v = "1"
+	}
+
+	count, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad parameters: unable to parse %q as a 32 bit integer", v)
+	}
+
+	return int32(count), nil
+}
+
 // Convert parameters into a modify-object that reconciles any differences between parameters and resource group
 func (params *Parameters) ToResourceGroupModify(rg *lapi.ResourceGroup) (lapi.ResourceGroupModify, bool, error) {
 	changed := false
@@ -350,6 +441,26 @@ func (params *Parameters) DisklessFlag() (string, error) {
 	return "", fmt.Errorf("could not determine diskless flag for layers: %v", params.LayerList)
 }
 
+// ApplySecrets sets the parameters passed as provisioner secrets. A LUKS passphrase requires the Luks layer.
+func (params *Parameters) ApplySecrets(secrets map[string]string) error {
+	passphrase, ok := secrets[LuksPassphraseKey]
+	if !ok {
+		return nil
+	}
+
+	if passphrase == "" {
+		return fmt.Errorf("secret '%s' is empty", LuksPassphraseKey)
+	}
+
+	if !slices.Contains(params.LayerList, devicelayerkind.Luks) {
+		return fmt.Errorf("secret '%s' requires the %s layer in the layer list", LuksPassphraseKey, devicelayerkind.Luks)
+	}
+
+	params.LuksPassphrase = Secret(passphrase)
+
+	return nil
+}
+
 // ParseLayerList returns a slice of LayerType from a string of space-separated layers.
 func ParseLayerList(s string) ([]devicelayerkind.DeviceLayerKind, error) {
 	list := strings.Split(s, " ")
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -21,15 +22,25 @@ const (
 )
 
 type SnapshotParameters struct {
-	Type             SnapshotType `json:"type,omitempty"`
-	AllowIncremental bool         `json:"allow-incremental"`
-	RemoteName       string       `json:"remote-name,omitempty"`
-	S3Endpoint       string       `json:"s3-endpoint,omitempty"`
-	S3Bucket         string       `json:"s3-bucket,omitempty"`
-	S3SigningRegion  string       `json:"s3-signing-region,omitempty"`
-	S3UsePathStyle   bool         `json:"s3-use-path-style"`
-	S3AccessKey      string       `json:"-"`
-	S3SecretKey      string       `json:"-"`
+	Type                     SnapshotType `json:"type,omitempty"`
+	AllowIncremental         bool         `json:"allow-incremental"`
+	RemoteName               string       `json:"remote-name,omitempty"`
+	S3Endpoint               string       `json:"s3-endpoint,omitempty"`
+	S3Bucket                 string       `json:"s3-bucket,omitempty"`
+	S3SigningRegion          string       `json:"s3-signing-region,omitempty"`
+	S3UsePathStyle           bool         `json:"s3-use-path-style"`
+	S3AccessKey              string       `json:"-"`
+	S3SecretKey              string       `json:"-"`
+	LinstorTargetUrl         string       `json:"linstor-target-url,omitempty"`
+	LinstorTargetClusterID   string       `json:"linstor-target-cluster-id,omitempty"`
+	LinstorTargetStoragePool string       `json:"linstor-target-storage-pool,omitempty"`
+	// BackupSchedule is the interval between two scheduled backups of volumes that opted in to scheduled backups
+	// using this snapshot class. Zero disables scheduled backups.
+	BackupSchedule time.Duration `json:"backup-schedule,omitempty"`
+	// BackupRetentionCount is the number of scheduled backups kept per volume. Zero keeps all backups.
+	BackupRetentionCount int `json:"backup-retention-count,omitempty"`
+	// BackupRetentionAge is the age after which scheduled backups are deleted. Zero keeps all backups.
+	BackupRetentionAge time.Duration `json:"backup-retention-age,omitempty"`
 }
 
 func NewSnapshotParameters(params, secrets map[string]string) (*SnapshotParameters, error) {
@@ -73,6 +84,37 @@ func NewSnapshotParameters(params, secrets map[string]string) (*SnapshotParamete
 			}
 
 			p.S3UsePathStyle = b
+		case "/linstor-target-url":
+			p.LinstorTargetUrl = v
+		case "/linstor-target-cluster-id":
+			p.LinstorTargetClusterID = v
+		case "/linstor-target-storage-pool":
+			p.LinstorTargetStoragePool = v
+		case "/backup-schedule":
+			d, err := parsePositiveDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid backup schedule: %w", err)
+			}
+
+			p.BackupSchedule = d
+		case "/backup-retention-count":
+			c, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+
+			if c < 0 {
+				return nil, fmt.Errorf("backup retention count must not be negative, got %d", c)
+			}
+
+			p.BackupRetentionCount = c
+		case "/backup-retention-age":
+			d, err := parsePositiveDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid backup retention age: %w", err)
+			}
+
+			p.BackupRetentionAge = d
 		default:
 			log.WithField("key", k).Warn("ignoring unknown snapshot parameter key")
 		}
@@ -82,6 +124,14 @@ func NewSnapshotParameters(params, secrets map[string]string) (*SnapshotParamete
 		return nil, fmt.Errorf("snapshots of type `%s` require specifying a %s/remote-name", p.Type, linstor.SnapshotParameterNamespace)
 	}
 
+	if p.BackupSchedule != 0 && p.Type != SnapshotTypeS3 {
+		return nil, fmt.Errorf("scheduled backups are only supported for snapshots of type `%s`", SnapshotTypeS3)
+	}
+
+	if (p.BackupRetentionCount != 0 || p.BackupRetentionAge != 0) && p.BackupSchedule == 0 {
+		return nil, fmt.Errorf("backup retention requires a %s/backup-schedule", linstor.SnapshotParameterNamespace)
+	}
+
 	p.S3AccessKey = secrets["access-key"]
 	p.S3SecretKey = secrets["secret-key"]
 
@@ -91,14 +141,33 @@ func NewSnapshotParameters(params, secrets map[string]string) (*SnapshotParamete
 func (s *SnapshotParameters) String() string {
 	// NB: we use a value here instead of a pointer, so we don't recurse endlessly.
 	return fmt.Sprint(SnapshotParameters{
-		Type:             s.Type,
-		AllowIncremental: s.AllowIncremental,
-		RemoteName:       s.RemoteName,
-		S3Endpoint:       s.S3Endpoint,
-		S3Bucket:         s.S3Bucket,
-		S3SigningRegion:  s.S3SigningRegion,
-		S3UsePathStyle:   s.S3UsePathStyle,
-		S3AccessKey:      "***",
-		S3SecretKey:      "***",
+		Type:                     s.Type,
+		AllowIncremental:         s.AllowIncremental,
+		RemoteName:               s.RemoteName,
+		S3Endpoint:               s.S3Endpoint,
+		S3Bucket:                 s.S3Bucket,
+		S3SigningRegion:          s.S3SigningRegion,
+		S3UsePathStyle:           s.S3UsePathStyle,
+		S3AccessKey:              "***",
+		S3SecretKey:              "***",
+		LinstorTargetUrl:         s.LinstorTargetUrl,
+		LinstorTargetClusterID:   s.LinstorTargetClusterID,
+		LinstorTargetStoragePool: s.LinstorTargetStoragePool,
+		BackupSchedule:           s.BackupSchedule,
+		BackupRetentionCount:     s.BackupRetentionCount,
+		BackupRetentionAge:       s.BackupRetentionAge,
 	})
 }
+
+func parsePositiveDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", d)
+	}
+
+	return d, nil
+}
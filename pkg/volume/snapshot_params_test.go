@@ -3,6 +3,7 @@ package volume_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -65,6 +66,75 @@ func TestNewSnapshotParameters(t *testing.T) {
 			},
 			expectedErr: fmt.Sprintf("snapshots of type `S3` require specifying a %s/remote-name", linstor.SnapshotParameterNamespace),
 		},
+		{
+			name: "linstor-with-target",
+			rawParameters: map[string]string{
+				linstor.SnapshotParameterNamespace + "/type":                        "Linstor",
+				linstor.SnapshotParameterNamespace + "/remote-name":                 "dr-cluster",
+				linstor.SnapshotParameterNamespace + "/linstor-target-url":          "https://dr.example.com:3371",
+				linstor.SnapshotParameterNamespace + "/linstor-target-cluster-id":   "9f6a1f42-4b8d-4b4e-8d2b-5d0c2f5f4e0a",
+				linstor.SnapshotParameterNamespace + "/linstor-target-storage-pool": "thinpool",
+			},
+			expected: &volume.SnapshotParameters{
+				Type:                     volume.SnapshotTypeLinstor,
+				RemoteName:               "dr-cluster",
+				LinstorTargetUrl:         "https://dr.example.com:3371",
+				LinstorTargetClusterID:   "9f6a1f42-4b8d-4b4e-8d2b-5d0c2f5f4e0a",
+				LinstorTargetStoragePool: "thinpool",
+			},
+		},
+		{
+			name: "linstor-without-name",
+			rawParameters: map[string]string{
+				linstor.SnapshotParameterNamespace + "/type":               "Linstor",
+				linstor.SnapshotParameterNamespace + "/linstor-target-url": "https://dr.example.com:3371",
+			},
+			expectedErr: fmt.Sprintf("snapshots of type `Linstor` require specifying a %s/remote-name", linstor.SnapshotParameterNamespace),
+		},
+		{
+			name: "s3-with-schedule",
+			rawParameters: map[string]string{
+				linstor.SnapshotParameterNamespace + "/type":                   "S3",
+				linstor.SnapshotParameterNamespace + "/remote-name":            "my-remote",
+				linstor.SnapshotParameterNamespace + "/allow-incremental":      "true",
+				linstor.SnapshotParameterNamespace + "/backup-schedule":        "24h",
+				linstor.SnapshotParameterNamespace + "/backup-retention-count": "7",
+				linstor.SnapshotParameterNamespace + "/backup-retention-age":   "720h",
+			},
+			expected: &volume.SnapshotParameters{
+				Type:                 volume.SnapshotTypeS3,
+				RemoteName:           "my-remote",
+				AllowIncremental:     true,
+				BackupSchedule:       24 * time.Hour,
+				BackupRetentionCount: 7,
+				BackupRetentionAge:   720 * time.Hour,
+			},
+		},
+		{
+			name: "in-cluster-with-schedule",
+			rawParameters: map[string]string{
+				linstor.SnapshotParameterNamespace + "/backup-schedule": "24h",
+			},
+			expectedErr: "scheduled backups are only supported for snapshots of type `S3`",
+		},
+		{
+			name: "retention-without-schedule",
+			rawParameters: map[string]string{
+				linstor.SnapshotParameterNamespace + "/type":                   "S3",
+				linstor.SnapshotParameterNamespace + "/remote-name":            "my-remote",
+				linstor.SnapshotParameterNamespace + "/backup-retention-count": "7",
+			},
+			expectedErr: fmt.Sprintf("backup retention requires a %s/backup-schedule", linstor.SnapshotParameterNamespace),
+		},
+		{
+			name: "negative-schedule",
+			rawParameters: map[string]string{
+				linstor.SnapshotParameterNamespace + "/type":            "S3",
+				linstor.SnapshotParameterNamespace + "/remote-name":     "my-remote",
+				linstor.SnapshotParameterNamespace + "/backup-schedule": "-1h",
+			},
+			expectedErr: "invalid backup schedule: duration must be positive, got -1h0m0s",
+		},
 	}
 
 	for i := range cases {
@@ -20,12 +20,30 @@ package volume
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"time"
 
 	lc "github.com/LINBIT/golinstor"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
 )
 
+// MinimumSizeBytes is the smallest volume size LINSTOR provisions. Smaller requests are rounded up.
+const MinimumSizeBytes = 4096
+
+// ErrCloneNotSupported is returned by CreateDeleter.VolFromVol if the backend can't clone the volume directly.
+var ErrCloneNotSupported = errors.New("cloning not supported")
+
+// ErrLuksPassphraseMismatch is returned by Mounter.CheckLuksPassphrase if the passphrase does not unlock the device.
+var ErrLuksPassphraseMismatch = errors.New("LUKS passphrase does not match")
+
+// ErrTooManyWriters is returned by AttacherDettacher.Attach if a multi-writer volume is already published read-write
+// on two nodes. DRBD supports at most two primaries.
+var ErrTooManyWriters = errors.New("DRBD supports at most two primaries")
+
 // Info provides the everything need to manipulate volumes.
 type Info struct {
 	ID            string
@@ -35,6 +53,17 @@ type Info struct {
 	Properties    map[string]string
 }
 
+// LogFields returns the fields describing the volume in log lines. Properties are left out, they are not needed to
+// follow what happens to the volume.
+func (i *Info) LogFields() logrus.Fields {
+	return logrus.Fields{
+		logging.FieldVolume: i.ID,
+		"sizeBytes":         i.SizeBytes,
+		"resourceGroup":     i.ResourceGroup,
+		"fsType":            i.FsType,
+	}
+}
+
 // Assignment represents a volume situated on a particular node.
 type Assignment struct {
 	// Node is the node that the assignment is valid for.
@@ -43,6 +72,33 @@ type Assignment struct {
 	Path string
 	// ReadOnly indicates if this volume was published as read only.
 	ReadOnly *bool
+	// LuksBackingDevice is the device holding the LUKS header, if the volume is encrypted on the Node.
+	LuksBackingDevice string
+}
+
+// LogFields returns the fields describing the assignment in log lines.
+func (a *Assignment) LogFields() logrus.Fields {
+	fields := logrus.Fields{
+		logging.FieldNode:   a.Node,
+		"path":              a.Path,
+		"luksBackingDevice": a.LuksBackingDevice,
+	}
+
+	if a.ReadOnly != nil {
+		fields["readOnly"] = *a.ReadOnly
+	}
+
+	return fields
+}
+
+// SnapshotLogFields returns the fields describing a CSI snapshot in log lines.
+func SnapshotLogFields(snap *csi.Snapshot) logrus.Fields {
+	return logrus.Fields{
+		logging.FieldSnapshot: snap.GetSnapshotId(),
+		"sourceVolume":        snap.GetSourceVolumeId(),
+		"sizeBytes":           snap.GetSizeBytes(),
+		"readyToUse":          snap.GetReadyToUse(),
+	}
 }
 
 // CreateDeleter handles the creation and deletion of volumes.
@@ -58,6 +114,18 @@ type CreateDeleter interface {
 
 	// GetLegacyVolumeContext tries to fetch the volume context from legacy properties.
 	GetLegacyVolumeParameters(ctx context.Context, volId string) (*Parameters, error)
+
+	// ResourceGroupParameters returns parameters that create volumes in the existing resource group, using its
+	// placement settings without modifying it.
+	ResourceGroupParameters(ctx context.Context, rg string) (*Parameters, error)
+
+	// VolFromVol creates a new volume as a clone of the source volume. It returns ErrCloneNotSupported if the volume
+	// can't be cloned directly, in which case the caller may fall back to restoring a snapshot of the source.
+	VolFromVol(ctx context.Context, sourceVol, vol *Info, params *Parameters, topologies *csi.TopologyRequirement) error
+
+	// Adopt marks an existing volume, not created by CreateVolume, as managed by the plugin. The filesystem type and
+	// the given parameters are stored on the volume, so it can be used like a volume provisioned by the plugin.
+	Adopt(ctx context.Context, vol *Info, rawParams map[string]string) error
 }
 
 // SnapshotCreateDeleter handles the creation and deletion of snapshots.
@@ -82,10 +150,14 @@ type SnapshotCreateDeleter interface {
 // AttacherDettacher handles operations relating to volume accessiblity on nodes.
 type AttacherDettacher interface {
 	Querier
-	Attach(ctx context.Context, volId, node string, readOnly bool) error
+	// Attach makes the volume available on the node. If multiWriter is set, the volume may be attached read-write to
+	// a second node at the same time.
+	Attach(ctx context.Context, volId, node string, readOnly, multiWriter bool) error
 	Detach(ctx context.Context, volId, node string) error
 	NodeAvailable(ctx context.Context, node string) error
 	FindAssignmentOnNode(ctx context.Context, volId, node string) (*Assignment, error)
+	// Status returns the nodes the volume is published on, and the current condition of the volume.
+	Status(ctx context.Context, volId string) ([]string, *csi.VolumeCondition, error)
 }
 
 // Querier retrives various states of volumes.
@@ -96,15 +168,68 @@ type Querier interface {
 	FindByID(ctx context.Context, ID string) (*Info, error)
 	// AllocationSizeKiB returns the number of KiB required to provision required bytes.
 	AllocationSizeKiB(requiredBytes, limitBytes int64) (int64, error)
-	// CapacityBytes returns the amount of free space, in bytes, in the storage pool specified by the params and topology.
-	CapacityBytes(ctx context.Context, pool string, segments map[string]string) (int64, error)
+	// CapacityBytes returns the size, in bytes, of the largest volume with placementCount replicas that can be
+	// provisioned in the storage pool specified by the params and topology.
+	CapacityBytes(ctx context.Context, pool string, placementCount int32, segments map[string]string) (int64, error)
 }
 
 // Mounter handles the filesystems located on volumes.
 type Mounter interface {
+	// Mount makes the device at source available at target. Filesystems are mounted (and resized if needed), block
+	// devices are bind mounted.
 	Mount(ctx context.Context, source, target, fsType string, readonly bool, mntOpts []string) error
+	// BindMount makes an already mounted source available at target.
+	BindMount(ctx context.Context, source, target string, block, readonly bool) error
+	// MountNFS mounts the path exported by the NFS server at target.
+	MountNFS(ctx context.Context, server, exportPath, target string, readonly bool, mntOpts []string) error
 	Unmount(target string) error
 	IsNotMountPoint(target string) (bool, error)
+	// CheckLuksPassphrase verifies that the passphrase unlocks the LUKS device.
+	CheckLuksPassphrase(ctx context.Context, device, passphrase string) error
+}
+
+// NFSVolume is a volume shared over NFS.
+type NFSVolume struct {
+	ID string
+	// FsType is the filesystem of the volume, used to mount it on the server.
+	FsType string
+	// Server is the node currently serving the volume.
+	Server string
+	// Address is the floating address of the volume, moved to the node serving the volume. Empty if no floating
+	// addresses are configured, in which case clients mount the export from the address of the server node.
+	Address string
+	// Clients are the nodes the volume is published on, including the server if it is used there.
+	Clients []string
+	// ServerInUse is true while the volume is opened on the server node.
+	ServerInUse bool
+}
+
+// NFSExporter serves filesystem volumes to multiple nodes over NFS.
+type NFSExporter interface {
+	// NFSServer returns the node serving the volume over NFS and the address clients mount the export from. This is
+	// the node where the volume is currently in use. If the volume is not in use, the last server is kept if it is
+	// still online, otherwise the preferred node becomes the new server. The address is the floating address of the
+	// volume if configured, otherwise the address of the server node.
+	NFSServer(ctx context.Context, volId, preferredNode string) (node, address string, err error)
+	// AddNFSClient records that the volume is published on the node.
+	AddNFSClient(ctx context.Context, volId, node string) error
+	// RemoveNFSClient removes the node from the clients of the volume.
+	RemoveNFSClient(ctx context.Context, volId, node string) error
+	// NFSVolume returns the volume shared over NFS, or nil if the volume is not shared over NFS.
+	NFSVolume(ctx context.Context, volId string) (*NFSVolume, error)
+	// NFSVolumes returns all volumes shared over NFS.
+	NFSVolumes(ctx context.Context) ([]NFSVolume, error)
+	// ClaimNFSServer makes the node the new server of the volume if the current server is offline. It returns true
+	// if the node is now the server.
+	ClaimNFSServer(ctx context.Context, volId, node string) (bool, error)
+	// Export makes the filesystem mounted at path available to other nodes over NFS.
+	Export(ctx context.Context, path string) error
+	// Unexport stops serving the path over NFS. Paths that are not exported are ignored.
+	Unexport(ctx context.Context, path string) error
+	// AddFloatingAddress assigns the floating address to this node and announces it to the network.
+	AddFloatingAddress(ctx context.Context, address string) error
+	// RemoveFloatingAddress removes the floating address from this node. Addresses not assigned are ignored.
+	RemoveFloatingAddress(ctx context.Context, address string) error
 }
 
 // VolumeStats provides details about filesystem usage.
@@ -133,6 +258,55 @@ type Expander interface {
 	ControllerExpand(ctx context.Context, vol *Info) error
 }
 
+// Modifier changes the parameters of existing volumes.
+type Modifier interface {
+	// Modify applies the mutable parameters to the volume: it moves the volume to the resource group, adds or removes
+	// diskful replicas to match the placement count, and sets the properties on the resource definition.
+	Modify(ctx context.Context, volId string, params *MutableParameters) error
+}
+
+// Attachment is a volume that the CO expects to be attached to a node.
+type Attachment struct {
+	VolumeID string
+	Node     string
+}
+
+// GarbageCollector removes objects left behind by interrupted or failed operations.
+type GarbageCollector interface {
+	// RemoveOrphanedTemporaryResources removes diskless resources created by Attach that are no longer attached. If
+	// attachments is nil, only resources no longer marked as published are considered orphaned. It returns the
+	// number of removed resources.
+	RemoveOrphanedTemporaryResources(ctx context.Context, attachments map[Attachment]struct{}) (int, error)
+	// RemoveOrphanedTemporarySnapshots removes snapshots created to clone a volume that are older than maxAge. It
+	// returns the number of removed snapshots.
+	RemoveOrphanedTemporarySnapshots(ctx context.Context, maxAge time.Duration) (int, error)
+	// RemoveOrphanedResourceGroups removes resource groups generated for storage classes that are no longer used by
+	// any volume. It returns the number of removed resource groups.
+	RemoveOrphanedResourceGroups(ctx context.Context) (int, error)
+}
+
+// GroupSnapshotCreateDeleter handles snapshots of multiple volumes taken at the same point in time.
+type GroupSnapshotCreateDeleter interface {
+	// CompatibleGroupSnapshotId returns an ID unique to the suggested name.
+	CompatibleGroupSnapshotId(name string) string
+	// GroupSnapCreate creates consistent snapshots of all source volumes. If the group snapshot already exists for
+	// the same volumes, it is returned as is.
+	GroupSnapCreate(ctx context.Context, id string, sourceVolIds []string, params *SnapshotParameters) (*csi.VolumeGroupSnapshot, error)
+	// GroupSnapGet returns the group snapshot made up of the given snapshots. It returns false if no snapshots are
+	// given, or if one of the snapshots does not exist.
+	GroupSnapGet(ctx context.Context, id string, snapshotIds []string) (*csi.VolumeGroupSnapshot, bool, error)
+	// GroupSnapDelete deletes the given snapshots of the group.
+	GroupSnapDelete(ctx context.Context, id string, snapshotIds []string) error
+}
+
+// BackupScheduler creates and prunes backups of volumes that opted in to scheduled backups.
+type BackupScheduler interface {
+	// ReconcileScheduledBackups creates a backup of every volume that opted in to scheduled backups using the named
+	// snapshot class, if its last scheduled backup is older than the schedule. Scheduled backups exceeding the
+	// retention are deleted. It returns the number of created and deleted backups.
+	ReconcileScheduledBackups(ctx context.Context, class string, params *SnapshotParameters) (created, deleted int, err error)
+}
+
 func maybeAddAux(props ...string) []string {
 	const auxPrefix = lc.NamespcAuxiliary + "/"
 
@@ -1,14 +1,18 @@
 package volume_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	lc "github.com/LINBIT/golinstor"
 	lapi "github.com/LINBIT/golinstor/client"
 	"github.com/LINBIT/golinstor/devicelayerkind"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/logging"
 	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
 )
 
@@ -45,6 +49,37 @@ func TestNewParameters(t *testing.T) {
 	assert.Equal(t, expected, generalProps.Properties)
 }
 
+func TestParameters_ApplySecrets(t *testing.T) {
+	plain, err := volume.NewParameters(nil)
+	assert.NoError(t, err)
+
+	err = plain.ApplySecrets(map[string]string{volume.LuksPassphraseKey: "hunter2"})
+	assert.Error(t, err, "passphrase requires LUKS layer")
+
+	encrypted, err := volume.NewParameters(map[string]string{"layerlist": "drbd luks storage"})
+	assert.NoError(t, err)
+
+	err = encrypted.ApplySecrets(map[string]string{volume.LuksPassphraseKey: ""})
+	assert.Error(t, err, "empty passphrase")
+
+	err = encrypted.ApplySecrets(map[string]string{"unrelated": "value"})
+	assert.NoError(t, err)
+	assert.Empty(t, encrypted.LuksPassphrase)
+
+	err = encrypted.ApplySecrets(map[string]string{volume.LuksPassphraseKey: "hunter2"})
+	assert.NoError(t, err)
+	assert.Equal(t, volume.Secret("hunter2"), encrypted.LuksPassphrase)
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		assert.NotContains(t, fmt.Sprintf(format, encrypted), "hunter2")
+		assert.NotContains(t, fmt.Sprintf(format, &encrypted), "hunter2")
+	}
+
+	encoded, err := json.Marshal(encrypted)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(encoded), "hunter2")
+}
+
 func TestDisklessFlag(t *testing.T) {
 	testcases := []struct {
 		name     string
@@ -155,3 +190,22 @@ func TestParameters_ToResourceGroupModify(t *testing.T) {
 		})
 	}
 }
+
+func TestInfo_LogFields(t *testing.T) {
+	t.Parallel()
+
+	info := &volume.Info{
+		ID:            "pvc-1",
+		SizeBytes:     1 << 30,
+		ResourceGroup: "rg1",
+		FsType:        "xfs",
+		Properties:    map[string]string{linstor.PropertyProvisioningCompletedBy: "linstor-csi/test"},
+	}
+
+	assert.Equal(t, logrus.Fields{
+		logging.FieldVolume: "pvc-1",
+		"sizeBytes":         int64(1 << 30),
+		"resourceGroup":     "rg1",
+		"fsType":            "xfs",
+	}, info.LogFields())
+}
@@ -0,0 +1,222 @@
+// Package webhook implements a validating admission webhook for the StorageClass and VolumeSnapshotClass objects of
+// the driver. Parameters are checked the same way as during volume and snapshot creation, so mistakes are reported
+// when the class is applied, instead of on the first provisioning attempt.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler"
+	"github.com/piraeusdatastore/linstor-csi/pkg/volume"
+
+	// Register the schedulers, so placement policies can be checked.
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/autoplace"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/autoplacetopology"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/balancer"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/followtopology"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/manual"
+	_ "github.com/piraeusdatastore/linstor-csi/pkg/topology/scheduler/scored"
+)
+
+// maxRequestBytes limits the size of admission reviews. The API server sends at most the old and new object, which are
+// small for class objects.
+const maxRequestBytes = 1 << 20
+
+var (
+	storageClassKind        = schema.GroupKind{Group: "storage.k8s.io", Kind: "StorageClass"}
+	volumeSnapshotClassKind = schema.GroupKind{Group: "snapshot.storage.k8s.io", Kind: "VolumeSnapshotClass"}
+)
+
+// Validator reviews StorageClass and VolumeSnapshotClass objects. Classes of other drivers and other kinds of objects
+// are always allowed.
+type Validator struct {
+	driverName string
+	log        *logrus.Entry
+}
+
+// NewValidator creates a new validator for classes using the given driver name.
+func NewValidator(driverName string, options ...func(*Validator) error) (*Validator, error) {
+	v := &Validator{
+		driverName: driverName,
+		log:        logrus.NewEntry(logrus.New()),
+	}
+
+	for _, opt := range options {
+		err := opt(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	v.log = v.log.WithField("component", "webhook")
+
+	return v, nil
+}
+
+// LogOut sets the validator's log output.
+func LogOut(out io.Writer) func(*Validator) error {
+	return func(v *Validator) error {
+		v.log.Logger.SetOutput(out)
+		return nil
+	}
+}
+
+// LogFmt sets the format of the validator's log output.
+func LogFmt(fmt logrus.Formatter) func(*Validator) error {
+	return func(v *Validator) error {
+		v.log.Logger.SetFormatter(fmt)
+		return nil
+	}
+}
+
+// LogLevel sets the validator's log level.
+func LogLevel(s string) func(*Validator) error {
+	return func(v *Validator) error {
+		level, err := logrus.ParseLevel(s)
+		if err != nil {
+			return err
+		}
+
+		v.log.Logger.SetLevel(level)
+
+		return nil
+	}
+}
+
+// ServeHTTP answers an admission.k8s.io/v1 AdmissionReview.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+
+	err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBytes)).Decode(&review)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if review.Request == nil {
+		http.Error(w, "admission review without request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = v.Review(review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(&review)
+	if err != nil {
+		v.log.WithError(err).Warn("failed to send admission review response")
+	}
+}
+
+// Review validates the object of the admission request.
+func (v *Validator) Review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return resp
+	}
+
+	log := v.log.WithFields(logrus.Fields{
+		"kind": req.Kind.Kind,
+		"name": req.Name,
+	})
+
+	kind := schema.GroupKind{Group: req.Kind.Group, Kind: req.Kind.Kind}
+
+	var warnings []string
+	var err error
+
+	switch kind {
+	case storageClassKind:
+		warnings, err = v.validateStorageClass(req.Object.Raw)
+	case volumeSnapshotClassKind:
+		warnings, err = v.validateVolumeSnapshotClass(req.Object.Raw)
+	default:
+		log.Debug("allowing object of unknown kind")
+		return resp
+	}
+
+	resp.Warnings = warnings
+
+	if err != nil {
+		log.WithError(err).Info("rejecting invalid class")
+
+		resp.Allowed = false
+		resp.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: err.Error(),
+		}
+	}
+
+	return resp
+}
+
+func (v *Validator) validateStorageClass(raw []byte) ([]string, error) {
+	var sc storagev1.StorageClass
+
+	err := json.Unmarshal(raw, &sc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode storage class: %w", err)
+	}
+
+	if sc.Provisioner != v.driverName {
+		return nil, nil
+	}
+
+	params, err := volume.NewParameters(sc.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters in storage class %s: %w", sc.Name, err)
+	}
+
+	err = scheduler.Supported(&params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters in storage class %s: %w", sc.Name, err)
+	}
+
+	return volume.DeprecatedParameters(sc.Parameters), nil
+}
+
+func (v *Validator) validateVolumeSnapshotClass(raw []byte) ([]string, error) {
+	var vsc unstructured.Unstructured
+
+	err := vsc.UnmarshalJSON(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode volume snapshot class: %w", err)
+	}
+
+	driver, _, _ := unstructured.NestedString(vsc.Object, "driver")
+	if driver != v.driverName {
+		return nil, nil
+	}
+
+	params, _, err := unstructured.NestedStringMap(vsc.Object, "parameters")
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters in volume snapshot class %s: %w", vsc.GetName(), err)
+	}
+
+	// Secrets are only read when a snapshot is created, they are not required to validate the parameters.
+	_, err = volume.NewSnapshotParameters(params, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters in volume snapshot class %s: %w", vsc.GetName(), err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,230 @@
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/piraeusdatastore/linstor-csi/pkg/linstor"
+	"github.com/piraeusdatastore/linstor-csi/pkg/webhook"
+)
+
+const driverName = "linstor.csi.linbit.com"
+
+func storageClass(provisioner string, params map[string]string) runtime.RawExtension {
+	return rawObject(map[string]interface{}{
+		"apiVersion":  "storage.k8s.io/v1",
+		"kind":        "StorageClass",
+		"metadata":    map[string]interface{}{"name": "example"},
+		"provisioner": provisioner,
+		"parameters":  params,
+	})
+}
+
+func volumeSnapshotClass(driver string, params map[string]string) runtime.RawExtension {
+	return rawObject(map[string]interface{}{
+		"apiVersion":     "snapshot.storage.k8s.io/v1",
+		"kind":           "VolumeSnapshotClass",
+		"metadata":       map[string]interface{}{"name": "example"},
+		"driver":         driver,
+		"deletionPolicy": "Delete",
+		"parameters":     params,
+	})
+}
+
+func rawObject(obj map[string]interface{}) runtime.RawExtension {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+
+	return runtime.RawExtension{Raw: raw}
+}
+
+func TestValidator_Review(t *testing.T) {
+	t.Parallel()
+
+	scKind := metav1.GroupVersionKind{Group: "storage.k8s.io", Version: "v1", Kind: "StorageClass"}
+	vscKind := metav1.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshotClass"}
+
+	testcases := []struct {
+		name         string
+		kind         metav1.GroupVersionKind
+		operation    admissionv1.Operation
+		object       runtime.RawExtension
+		wantAllowed  bool
+		wantWarnings []string
+	}{
+		{
+			name:      "valid-storage-class",
+			kind:      scKind,
+			operation: admissionv1.Create,
+			object: storageClass(driverName, map[string]string{
+				linstor.ParameterNamespace + "/storagePool":    "pool1",
+				linstor.ParameterNamespace + "/placementCount": "2",
+				"csi.storage.k8s.io/fstype":                    "xfs",
+				"DrbdOptions/Net/protocol":                     "C",
+			}),
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid-layer-list",
+			kind:        scKind,
+			operation:   admissionv1.Create,
+			object:      storageClass(driverName, map[string]string{linstor.ParameterNamespace + "/layerList": "drbd foo"}),
+			wantAllowed: false,
+		},
+		{
+			name:        "unknown-parameter",
+			kind:        scKind,
+			operation:   admissionv1.Update,
+			object:      storageClass(driverName, map[string]string{"placementcnt": "2"}),
+			wantAllowed: false,
+		},
+		{
+			name:        "invalid-remote-access",
+			kind:        scKind,
+			operation:   admissionv1.Create,
+			object:      storageClass(driverName, map[string]string{"allowRemoteVolumeAccess": "maybe: [}"}),
+			wantAllowed: false,
+		},
+		{
+			name:        "unknown-placement-policy",
+			kind:        scKind,
+			operation:   admissionv1.Create,
+			object:      storageClass(driverName, map[string]string{linstor.ParameterNamespace + "/placementPolicy": "Random"}),
+			wantAllowed: false,
+		},
+		{
+			name:        "known-placement-policy",
+			kind:        scKind,
+			operation:   admissionv1.Create,
+			object:      storageClass(driverName, map[string]string{linstor.ParameterNamespace + "/placementPolicy": "FollowTopology"}),
+			wantAllowed: true,
+		},
+		{
+			name:        "other-provisioner",
+			kind:        scKind,
+			operation:   admissionv1.Create,
+			object:      storageClass("example.com/other", map[string]string{"placementcnt": "2"}),
+			wantAllowed: true,
+		},
+		{
+			name:         "deprecated-size",
+			kind:         scKind,
+			operation:    admissionv1.Create,
+			object:       storageClass(driverName, map[string]string{linstor.ParameterNamespace + "/sizeKiB": "1024"}),
+			wantAllowed:  true,
+			wantWarnings: []string{"parameter '" + linstor.ParameterNamespace + "/sizeKiB' is deprecated and has no effect: volume sizes are set by the PersistentVolumeClaim"},
+		},
+		{
+			name:        "delete-is-allowed",
+			kind:        scKind,
+			operation:   admissionv1.Delete,
+			wantAllowed: true,
+		},
+		{
+			name:      "valid-snapshot-class",
+			kind:      vscKind,
+			operation: admissionv1.Create,
+			object: volumeSnapshotClass(driverName, map[string]string{
+				linstor.SnapshotParameterNamespace + "/type":        "S3",
+				linstor.SnapshotParameterNamespace + "/remote-name": "my-remote",
+			}),
+			wantAllowed: true,
+		},
+		{
+			name:        "snapshot-class-without-remote",
+			kind:        vscKind,
+			operation:   admissionv1.Create,
+			object:      volumeSnapshotClass(driverName, map[string]string{linstor.SnapshotParameterNamespace + "/type": "S3"}),
+			wantAllowed: false,
+		},
+		{
+			name:        "other-snapshot-driver",
+			kind:        vscKind,
+			operation:   admissionv1.Create,
+			object:      volumeSnapshotClass("example.com/other", map[string]string{linstor.SnapshotParameterNamespace + "/type": "S3"}),
+			wantAllowed: true,
+		},
+		{
+			name:        "other-kind",
+			kind:        metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			operation:   admissionv1.Create,
+			object:      rawObject(map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}),
+			wantAllowed: true,
+		},
+	}
+
+	v, err := webhook.NewValidator(driverName)
+	assert.NoError(t, err)
+
+	for i := range testcases {
+		tcase := &testcases[i]
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := v.Review(&admissionv1.AdmissionRequest{
+				UID:       types.UID(tcase.name),
+				Kind:      tcase.kind,
+				Name:      "example",
+				Operation: tcase.operation,
+				Object:    tcase.object,
+			})
+
+			assert.Equal(t, types.UID(tcase.name), resp.UID)
+			assert.Equal(t, tcase.wantAllowed, resp.Allowed)
+			assert.Equal(t, tcase.wantWarnings, resp.Warnings)
+
+			if !tcase.wantAllowed {
+				assert.NotEmpty(t, resp.Result.Message)
+			}
+		})
+	}
+}
+
+func TestValidator_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	v, err := webhook.NewValidator(driverName)
+	assert.NoError(t, err)
+
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "1234",
+			Kind:      metav1.GroupVersionKind{Group: "storage.k8s.io", Version: "v1", Kind: "StorageClass"},
+			Operation: admissionv1.Create,
+			Object:    storageClass(driverName, map[string]string{"layerList": "foo"}),
+		},
+	}
+
+	body, err := json.Marshal(&review)
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	v.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result admissionv1.AdmissionReview
+
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, review.TypeMeta, result.TypeMeta)
+	assert.Nil(t, result.Request)
+	assert.Equal(t, types.UID("1234"), result.Response.UID)
+	assert.False(t, result.Response.Allowed)
+
+	rec = httptest.NewRecorder()
+	v.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader([]byte("{}"))))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}